@@ -8,10 +8,17 @@ import (
 	"strconv"
 	"time"
 
+	"storage-gateway/application/api/handlers/delete_object"
 	"storage-gateway/application/api/handlers/get_object"
+	"storage-gateway/application/api/handlers/head_object"
+	"storage-gateway/application/api/handlers/list_objects"
+	"storage-gateway/application/api/handlers/multipart_upload"
 	"storage-gateway/application/api/handlers/put_object"
+	"storage-gateway/application/api/handlers/rebalance_progress"
+	"storage-gateway/application/api/handlers/ring_distribution"
 	"storage-gateway/application/api/middlewares"
 	"storage-gateway/config"
+	"storage-gateway/domain/ports"
 	"storage-gateway/domain/services"
 	"storage-gateway/internal/context-wrapper"
 	"storage-gateway/internal/log"
@@ -26,9 +33,10 @@ type API struct {
 	Addr   string
 }
 
-func NewApi(nps *services.NodePoolService, config config.Config) *API {
+// NewApi creates the gateway API, rbs being nil when rebalancing is disabled and mus when multipart uploads are
+func NewApi(nps *services.NodePoolService, storage ports.ObjectStorage, rbs *services.RebalanceService, mus *services.MultipartUploadService, config config.Config) *API {
 	return &API{
-		server: echoServer(nps, config),
+		server: echoServer(nps, storage, rbs, mus, config),
 		config: config,
 		Addr:   apiAddr(config.Api),
 	}
@@ -50,7 +58,7 @@ func (a *API) Shutdown() {
 }
 
 // echoServer sets up an Echo server with various middlewares for handling HTTP requests
-func echoServer(nps *services.NodePoolService, config config.Config) *echo.Echo {
+func echoServer(nps *services.NodePoolService, storage ports.ObjectStorage, rbs *services.RebalanceService, mus *services.MultipartUploadService, config config.Config) *echo.Echo {
 	e := echo.New()
 
 	e.Logger.SetLevel(log.Lvl(config.App.LogLevel))
@@ -68,6 +76,11 @@ func echoServer(nps *services.NodePoolService, config config.Config) *echo.Echo
 	}))
 
 	e.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
+		// object transfers are skipped, since they can last longer than the timeout for large objects
+		// and the timeout handler would buffer their whole response
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/object/:objectID"
+		},
 		Timeout: time.Duration(config.Api.TimeoutInSeconds) * time.Second,
 	}))
 
@@ -82,7 +95,13 @@ func echoServer(nps *services.NodePoolService, config config.Config) *echo.Echo
 
 	e.Use(middlewares.CorrelationID())
 
-	e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+	e.Use(middlewares.Gzip(middleware.GzipConfig{
+		// HEAD responses have no body, and the gzip writer would drop the Content-Length they advertise.
+		// Partial content is skipped as well since Content-Range refers to the uncompressed bytes.
+		// Objects served encoded as they are stored already carry a Content-Encoding, and are sent as they are
+		Skipper: func(c echo.Context) bool {
+			return c.Request().Method == http.MethodHead || c.Request().Header.Get("Range") != ""
+		},
 		Level: 5,
 	}))
 
@@ -90,16 +109,67 @@ func echoServer(nps *services.NodePoolService, config config.Config) *echo.Echo
 		return c.JSON(http.StatusOK, nil)
 	})
 
-	getObjectHandler := get_object.NewGetObjectHandler(services.NewGetObjectService(nps))
+	objectID := middlewares.ObjectID()
+
+	// multipart uploads share the object routes, told apart by their query parameters like in S3
+	multipartUploadHandler := multipart_upload.NewMultipartUploadHandler(mus)
+	e.POST("/object/:objectID", func(c echo.Context) error {
+		if c.QueryParams().Has("uploads") {
+			return multipartUploadHandler.CreateUpload(c)
+		}
+		return multipartUploadHandler.CompleteUpload(c)
+	}, objectID)
+
+	getObjectHandler := get_object.NewGetObjectHandler(
+		services.NewGetObjectService(storage, config.Api.VerifyDigestsOnRead),
+		services.NewStatObjectService(storage),
+	)
 	e.GET("/object/:objectID", func(c echo.Context) error {
+		if c.QueryParams().Has("uploadId") {
+			return multipartUploadHandler.ListParts(c)
+		}
 		return getObjectHandler.GetObject(c)
-	})
+	}, objectID)
 
-	putObjectHandler := put_object.NewPutObjectHandler(services.NewPutObjectService(nps))
+	headObjectHandler := head_object.NewHeadObjectHandler(services.NewStatObjectService(storage))
+	e.HEAD("/object/:objectID", func(c echo.Context) error {
+		return headObjectHandler.HeadObject(c)
+	}, objectID)
+
+	putObjectHandler := put_object.NewPutObjectHandler(services.NewPutObjectService(storage, config.Api.MaxObjectSizeInBytes))
 	e.PUT("/object/:objectID", func(c echo.Context) error {
+		if c.QueryParams().Has("uploadId") {
+			return multipartUploadHandler.UploadPart(c)
+		}
 		return putObjectHandler.PutObject(c)
+	}, objectID)
+
+	resolver, _ := storage.(ports.ListingResolver)
+	listObjectsHandler := list_objects.NewListObjectsHandler(services.NewListObjectsService(nps, resolver))
+	e.GET("/objects", func(c echo.Context) error {
+		return listObjectsHandler.ListObjects(c)
 	})
 
+	deleteObjectHandler := delete_object.NewDeleteObjectHandler(services.NewDeleteObjectService(storage))
+	e.DELETE("/object/:objectID", func(c echo.Context) error {
+		if c.QueryParams().Has("uploadId") {
+			return multipartUploadHandler.AbortUpload(c)
+		}
+		return deleteObjectHandler.DeleteObject(c)
+	}, objectID)
+
+	ringDistributionHandler := ring_distribution.NewRingDistributionHandler(nps)
+	e.GET("/admin/ring/distribution", func(c echo.Context) error {
+		return ringDistributionHandler.RingDistribution(c)
+	})
+
+	if rbs != nil {
+		rebalanceProgressHandler := rebalance_progress.NewRebalanceProgressHandler(rbs)
+		e.GET("/admin/rebalance", func(c echo.Context) error {
+			return rebalanceProgressHandler.RebalanceProgress(c)
+		})
+	}
+
 	return e
 }
 
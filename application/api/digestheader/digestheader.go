@@ -0,0 +1,44 @@
+package digestheader
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"storage-gateway/domain/models"
+)
+
+const (
+	HeaderContentMD5     = "Content-MD5"
+	HeaderChecksumSHA256 = "X-Checksum-Sha256"
+)
+
+// requestHeaders maps the digest metadata keys to the request headers carrying them
+var requestHeaders = map[string]string{
+	models.MetadataMD5:    HeaderContentMD5,
+	models.MetadataSHA256: HeaderChecksumSHA256,
+}
+
+// Metadata returns the digests sent in the request headers as object metadata, nil when there are none
+func Metadata(header http.Header) map[string]string {
+	var metadata map[string]string
+	for key, name := range requestHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[key] = value
+	}
+
+	return metadata
+}
+
+// Set sets the headers of the object digests, base64 encoded, for responses carrying the whole object
+func Set(header http.Header, obj *models.Object) {
+	for key, digest := range obj.Digests() {
+		header.Set(requestHeaders[key], base64.StdEncoding.EncodeToString(digest))
+	}
+}
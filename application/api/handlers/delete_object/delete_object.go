@@ -0,0 +1,45 @@
+package delete_object
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"storage-gateway/application/api/apierror"
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+type DeleteObjectHandler struct {
+	deleteObjectService *services.DeleteObjectService
+}
+
+func NewDeleteObjectHandler(deleteObjectService *services.DeleteObjectService) *DeleteObjectHandler {
+	return &DeleteObjectHandler{
+		deleteObjectService: deleteObjectService,
+	}
+}
+
+func (h *DeleteObjectHandler) DeleteObject(c echo.Context) error {
+	id := c.Param("objectID")
+
+	err := h.deleteObjectService.DeleteObject(c.Request().Context(), models.ObjectID(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrObjectIDNotValid):
+			return apierror.Err(c, http.StatusBadRequest, err)
+		case errors.Is(err, models.ErrObjectNotFound):
+			return apierror.Err(c, http.StatusNotFound, err)
+		case errors.Is(err, models.ErrObjectStorageNotAvailable):
+			return apierror.Err(c, http.StatusServiceUnavailable, err)
+		case os.IsTimeout(err):
+			return apierror.Err(c, http.StatusBadGateway, err)
+		default:
+			return apierror.Err(c, http.StatusInternalServerError, err)
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -2,37 +2,58 @@ package get_object
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 
 	"storage-gateway/application/api/apierror"
+	"storage-gateway/application/api/digestheader"
 	"storage-gateway/domain/models"
 	"storage-gateway/domain/services"
+	"storage-gateway/internal/context-wrapper"
 
 	"github.com/labstack/echo/v4"
 )
 
 type GetObjectHandler struct {
-	getObjectService *services.GetObjectService
+	getObjectService  *services.GetObjectService
+	statObjectService *services.StatObjectService
 }
 
-func NewGetObjectHandler(getObjectService *services.GetObjectService) *GetObjectHandler {
+func NewGetObjectHandler(getObjectService *services.GetObjectService, statObjectService *services.StatObjectService) *GetObjectHandler {
 	return &GetObjectHandler{
-		getObjectService: getObjectService,
+		getObjectService:  getObjectService,
+		statObjectService: statObjectService,
 	}
 }
 
 func (h *GetObjectHandler) GetObject(c echo.Context) error {
 	id := c.Param("objectID")
 
-	obj, err := h.getObjectService.GetObject(c.Request().Context(), models.ObjectID(id))
+	// malformed or multi-range headers are ignored and answered with the full content
+	rng, _ := models.ParseByteRange(c.Request().Header.Get("Range"))
+
+	header := c.Response().Header()
+	header.Set("Accept-Ranges", "bytes")
+
+	// the storage may return the content as stored when the client accepts its encoding
+	ctx := context_wrapper.WithAcceptEncoding(c.Request().Context(), c.Request().Header.Get(echo.HeaderAcceptEncoding))
+
+	obj, err := h.getObjectService.GetObject(ctx, models.ObjectID(id), rng)
 	if err != nil {
 		switch {
 		case errors.Is(err, models.ErrObjectIDNotValid):
 			return apierror.Err(c, http.StatusBadRequest, err)
 		case errors.Is(err, models.ErrObjectNotFound):
 			return apierror.Err(c, http.StatusNotFound, err)
+		case errors.Is(err, models.ErrRangeNotSatisfiable):
+			// the client learns the current size of the object to build a satisfiable range
+			if stat, statErr := h.statObjectService.StatObject(ctx, models.ObjectID(id)); statErr == nil {
+				header.Set("Content-Range", fmt.Sprintf("bytes */%d", stat.Size))
+			}
+			return apierror.Err(c, http.StatusRequestedRangeNotSatisfiable, err)
 		case errors.Is(err, models.ErrObjectStorageNotAvailable):
 			return apierror.Err(c, http.StatusServiceUnavailable, err)
 		case os.IsTimeout(err):
@@ -42,13 +63,48 @@ func (h *GetObjectHandler) GetObject(c echo.Context) error {
 		}
 	}
 
-	_, err = io.Copy(c.Response().Writer, obj.Content)
-	if err != nil {
-		return apierror.Err(c, http.StatusInternalServerError, err)
+	if closer, ok := obj.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	status := http.StatusOK
+	contentLength := obj.Size
+	if obj.Range != nil {
+		status = http.StatusPartialContent
+		contentLength = obj.Range.Length()
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", obj.Range.Start, obj.Range.End, obj.Size))
+	}
+
+	header.Set(echo.HeaderContentType, obj.ContentType)
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(contentLength, 10))
+	if header.Get(echo.HeaderVary) == "" {
+		header.Set(echo.HeaderVary, echo.HeaderAcceptEncoding)
+	}
+	if obj.ContentEncoding != "" {
+		header.Set(echo.HeaderContentEncoding, obj.ContentEncoding)
+	}
+	if etag := obj.DigestETag(); etag != "" {
+		// the encoded representation is a different one, so it can't share the ETag of the decoded content
+		if obj.ContentEncoding != "" {
+			etag += "-" + obj.ContentEncoding
+		}
+		header.Set("ETag", strconv.Quote(etag))
 	}
+	if obj.Range == nil && obj.ContentEncoding == "" {
+		digestheader.Set(header, obj)
+	}
+	if !obj.LastModified.IsZero() {
+		header.Set(echo.HeaderLastModified, obj.LastModified.UTC().Format(http.TimeFormat))
+	}
+	c.Response().WriteHeader(status)
 
-	c.Response().Header().Set(echo.HeaderContentType, obj.ContentType)
-	c.Response().WriteHeader(http.StatusOK)
+	// the status line is already sent at this point, so a failed copy is only returned to be logged
+	_, err = io.Copy(c.Response(), obj.Content)
+	if errors.Is(err, models.ErrDigestMismatch) {
+		// the connection is dropped so that the client can't take a compressed or chunked response for a complete one
+		c.Logger().Errorf("object %s failed its digest verification", id)
+		panic(http.ErrAbortHandler)
+	}
 
-	return nil
+	return err
 }
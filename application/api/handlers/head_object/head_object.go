@@ -0,0 +1,59 @@
+package head_object
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"storage-gateway/application/api/apierror"
+	"storage-gateway/application/api/digestheader"
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+type HeadObjectHandler struct {
+	statObjectService *services.StatObjectService
+}
+
+func NewHeadObjectHandler(statObjectService *services.StatObjectService) *HeadObjectHandler {
+	return &HeadObjectHandler{
+		statObjectService: statObjectService,
+	}
+}
+
+func (h *HeadObjectHandler) HeadObject(c echo.Context) error {
+	id := c.Param("objectID")
+
+	obj, err := h.statObjectService.StatObject(c.Request().Context(), models.ObjectID(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrObjectIDNotValid):
+			return apierror.Err(c, http.StatusBadRequest, err)
+		case errors.Is(err, models.ErrObjectNotFound):
+			return apierror.Err(c, http.StatusNotFound, err)
+		case errors.Is(err, models.ErrObjectStorageNotAvailable):
+			return apierror.Err(c, http.StatusServiceUnavailable, err)
+		case os.IsTimeout(err):
+			return apierror.Err(c, http.StatusBadGateway, err)
+		default:
+			return apierror.Err(c, http.StatusInternalServerError, err)
+		}
+	}
+
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(obj.Size, 10))
+	header.Set(echo.HeaderContentType, obj.ContentType)
+	header.Set("Accept-Ranges", "bytes")
+	if etag := obj.DigestETag(); etag != "" {
+		header.Set("ETag", strconv.Quote(etag))
+	}
+	digestheader.Set(header, obj)
+	if !obj.LastModified.IsZero() {
+		header.Set(echo.HeaderLastModified, obj.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,78 @@
+package list_objects
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"storage-gateway/application/api/apierror"
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ListObjectsHandler struct {
+	listObjectsService *services.ListObjectsService
+}
+
+type ObjectResponse struct {
+	ID           string    `json:"id"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+type ListObjectsResponse struct {
+	Objects    []ObjectResponse `json:"objects"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+func NewListObjectsHandler(listObjectsService *services.ListObjectsService) *ListObjectsHandler {
+	return &ListObjectsHandler{
+		listObjectsService: listObjectsService,
+	}
+}
+
+func (h *ListObjectsHandler) ListObjects(c echo.Context) error {
+	var limit int
+	if rawLimit := c.QueryParam("limit"); rawLimit != "" {
+		var err error
+		if limit, err = strconv.Atoi(rawLimit); err != nil || limit <= 0 {
+			return apierror.Err(c, http.StatusBadRequest, models.ErrLimitNotValid)
+		}
+	}
+
+	list, err := h.listObjectsService.ListObjects(c.Request().Context(), c.QueryParam("prefix"), limit, c.QueryParam("cursor"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrLimitNotValid), errors.Is(err, models.ErrCursorNotValid):
+			return apierror.Err(c, http.StatusBadRequest, err)
+		case errors.Is(err, models.ErrObjectStorageNotAvailable):
+			return apierror.Err(c, http.StatusServiceUnavailable, err)
+		case os.IsTimeout(err):
+			return apierror.Err(c, http.StatusBadGateway, err)
+		default:
+			return apierror.Err(c, http.StatusInternalServerError, err)
+		}
+	}
+
+	resp := ListObjectsResponse{
+		Objects:    make([]ObjectResponse, 0, len(list.Objects)),
+		NextCursor: list.NextCursor,
+	}
+	for _, obj := range list.Objects {
+		resp.Objects = append(resp.Objects, ObjectResponse{
+			ID:           obj.ID.Value(),
+			Size:         obj.Size,
+			ContentType:  obj.ContentType,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+		})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
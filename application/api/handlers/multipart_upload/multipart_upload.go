@@ -0,0 +1,198 @@
+package multipart_upload
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"storage-gateway/application/api/apierror"
+	"storage-gateway/application/api/digestheader"
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MultipartUploadHandler serves the multipart uploads, answering 501 when multipartUploadService is nil
+type MultipartUploadHandler struct {
+	multipartUploadService *services.MultipartUploadService
+}
+
+type CreateUploadResponse struct {
+	UploadID string `json:"uploadId"`
+}
+
+type PartResponse struct {
+	PartNumber   int        `json:"partNumber"`
+	ETag         string     `json:"etag"`
+	Size         int64      `json:"size,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+}
+
+type ListPartsResponse struct {
+	Parts []PartResponse `json:"parts"`
+}
+
+type CompletePart struct {
+	PartNumber int    `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+type CompleteUploadRequest struct {
+	Parts []CompletePart `json:"parts"`
+}
+
+type CompleteUploadResponse struct {
+	ID           string    `json:"id"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"contentType,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+func NewMultipartUploadHandler(multipartUploadService *services.MultipartUploadService) *MultipartUploadHandler {
+	return &MultipartUploadHandler{
+		multipartUploadService: multipartUploadService,
+	}
+}
+
+// CreateUpload starts an upload of the object, the Content-Type of the request being the one of the object
+func (h *MultipartUploadHandler) CreateUpload(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return apierror.Err(c, http.StatusNotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	obj := &models.Object{
+		ID:          models.ObjectID(c.Param("objectID")),
+		ContentType: c.Request().Header.Get("Content-Type"),
+	}
+
+	uploadID, err := h.multipartUploadService.CreateUpload(c.Request().Context(), obj)
+	if err != nil {
+		return multipartErr(c, err)
+	}
+
+	return c.JSON(http.StatusOK, CreateUploadResponse{UploadID: uploadID})
+}
+
+// UploadPart streams the body of the request as the part partNumber of the upload uploadId
+func (h *MultipartUploadHandler) UploadPart(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return apierror.Err(c, http.StatusNotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	number, err := strconv.Atoi(c.QueryParam("partNumber"))
+	if err != nil {
+		return apierror.Err(c, http.StatusBadRequest, models.ErrPartNotValid)
+	}
+
+	part := &models.Object{
+		ID:       models.ObjectID(c.Param("objectID")),
+		Content:  c.Request().Body,
+		Size:     c.Request().ContentLength,
+		Metadata: digestheader.Metadata(c.Request().Header),
+	}
+
+	stored, err := h.multipartUploadService.UploadPart(c.Request().Context(), c.QueryParam("uploadId"), number, part)
+	if err != nil {
+		return multipartErr(c, err)
+	}
+
+	c.Response().Header().Set("ETag", strconv.Quote(stored.ETag))
+
+	return c.JSON(http.StatusOK, PartResponse{PartNumber: stored.Number, ETag: stored.ETag, Size: stored.Size})
+}
+
+// ListParts lists the parts uploaded so far to the upload uploadId
+func (h *MultipartUploadHandler) ListParts(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return apierror.Err(c, http.StatusNotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	parts, err := h.multipartUploadService.ListParts(c.Request().Context(), c.Param("objectID"), c.QueryParam("uploadId"))
+	if err != nil {
+		return multipartErr(c, err)
+	}
+
+	resp := ListPartsResponse{Parts: make([]PartResponse, 0, len(parts))}
+	for _, part := range parts {
+		resp.Parts = append(resp.Parts, PartResponse{
+			PartNumber:   part.Number,
+			ETag:         part.ETag,
+			Size:         part.Size,
+			LastModified: &part.LastModified,
+		})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// CompleteUpload assembles the object from the parts listed in the request body
+func (h *MultipartUploadHandler) CompleteUpload(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return apierror.Err(c, http.StatusNotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	var req CompleteUploadRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.Err(c, http.StatusBadRequest, models.ErrPartNotValid)
+	}
+
+	parts := make([]*models.Part, 0, len(req.Parts))
+	for _, part := range req.Parts {
+		parts = append(parts, &models.Part{Number: part.PartNumber, ETag: part.ETag})
+	}
+
+	obj, err := h.multipartUploadService.CompleteUpload(c.Request().Context(), c.Param("objectID"), c.QueryParam("uploadId"), parts)
+	if err != nil {
+		return multipartErr(c, err)
+	}
+
+	return c.JSON(http.StatusOK, CompleteUploadResponse{
+		ID:           obj.ID.Value(),
+		Size:         obj.Size,
+		ContentType:  obj.ContentType,
+		ETag:         obj.ETag,
+		LastModified: obj.LastModified,
+	})
+}
+
+// AbortUpload drops the upload uploadId and its parts
+func (h *MultipartUploadHandler) AbortUpload(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return apierror.Err(c, http.StatusNotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	if err := h.multipartUploadService.AbortUpload(c.Request().Context(), c.Param("objectID"), c.QueryParam("uploadId")); err != nil {
+		return multipartErr(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func multipartErr(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, models.ErrObjectIDNotValid),
+		errors.Is(err, models.ErrPartNotValid),
+		errors.Is(err, models.ErrPartTooSmall),
+		errors.Is(err, models.ErrDigestNotValid),
+		errors.Is(err, models.ErrDigestMismatch):
+		return apierror.Err(c, http.StatusBadRequest, err)
+	case errors.Is(err, models.ErrPartLengthNotValid):
+		return apierror.Err(c, http.StatusLengthRequired, err)
+	case errors.Is(err, models.ErrUploadNotFound):
+		return apierror.Err(c, http.StatusNotFound, err)
+	case errors.Is(err, models.ErrObjectTooLarge):
+		return apierror.Err(c, http.StatusRequestEntityTooLarge, err)
+	case errors.Is(err, models.ErrMultipartNotSupported):
+		return apierror.Err(c, http.StatusNotImplemented, err)
+	case errors.Is(err, models.ErrObjectStorageNotAvailable):
+		return apierror.Err(c, http.StatusServiceUnavailable, err)
+	case os.IsTimeout(err):
+		return apierror.Err(c, http.StatusBadGateway, err)
+	default:
+		return apierror.Err(c, http.StatusInternalServerError, err)
+	}
+}
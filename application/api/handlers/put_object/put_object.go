@@ -1,13 +1,12 @@
 package put_object
 
 import (
-	"bytes"
 	"errors"
-	"io"
 	"net/http"
 	"os"
 
 	"storage-gateway/application/api/apierror"
+	"storage-gateway/application/api/digestheader"
 	"storage-gateway/domain/models"
 	"storage-gateway/domain/services"
 
@@ -27,23 +26,24 @@ func NewPutObjectHandler(putObjectService *services.PutObjectService) *PutObject
 func (h *PutObjectHandler) PutObject(c echo.Context) error {
 	id := c.Param("objectID")
 
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, c.Request().Body); err != nil || c.Request().Body == nil {
-		return apierror.Err(c, http.StatusBadRequest, err)
-	}
-
+	// the body is streamed to the storage node as it arrives, ContentLength is -1 for chunked uploads
 	obj := &models.Object{
 		ID:          models.ObjectID(id),
-		Content:     &buf,
+		Content:     c.Request().Body,
 		ContentType: c.Request().Header.Get("Content-Type"),
 		Size:        c.Request().ContentLength,
+		Metadata:    digestheader.Metadata(c.Request().Header),
 	}
 
 	err := h.putObjectService.PutObject(c.Request().Context(), obj)
 	if err != nil {
 		switch {
-		case errors.Is(err, models.ErrObjectIDNotValid):
+		case errors.Is(err, models.ErrObjectIDNotValid),
+			errors.Is(err, models.ErrDigestNotValid),
+			errors.Is(err, models.ErrDigestMismatch):
 			return apierror.Err(c, http.StatusBadRequest, err)
+		case errors.Is(err, models.ErrObjectTooLarge):
+			return apierror.Err(c, http.StatusRequestEntityTooLarge, err)
 		case errors.Is(err, models.ErrObjectStorageNotAvailable):
 			return apierror.Err(c, http.StatusServiceUnavailable, err)
 		case os.IsTimeout(err):
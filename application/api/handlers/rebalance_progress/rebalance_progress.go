@@ -0,0 +1,56 @@
+package rebalance_progress
+
+import (
+	"net/http"
+	"time"
+
+	"storage-gateway/domain/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+type RebalanceProgressHandler struct {
+	rebalanceService *services.RebalanceService
+}
+
+type RebalanceProgressResponse struct {
+	Active         bool       `json:"active"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time `json:"finishedAt,omitempty"`
+	Ranges         int        `json:"ranges"`
+	MigratedRanges int        `json:"migratedRanges"`
+	Scanned        int64      `json:"scanned"`
+	Copied         int64      `json:"copied"`
+	Skipped        int64      `json:"skipped"`
+	Removed        int64      `json:"removed"`
+	Failed         int64      `json:"failed"`
+}
+
+func NewRebalanceProgressHandler(rebalanceService *services.RebalanceService) *RebalanceProgressHandler {
+	return &RebalanceProgressHandler{
+		rebalanceService: rebalanceService,
+	}
+}
+
+func (h *RebalanceProgressHandler) RebalanceProgress(c echo.Context) error {
+	progress := h.rebalanceService.Progress()
+
+	resp := RebalanceProgressResponse{
+		Active:         progress.Active,
+		Ranges:         progress.Ranges,
+		MigratedRanges: progress.MigratedRanges,
+		Scanned:        progress.Scanned,
+		Copied:         progress.Copied,
+		Skipped:        progress.Skipped,
+		Removed:        progress.Removed,
+		Failed:         progress.Failed,
+	}
+	if !progress.StartedAt.IsZero() {
+		resp.StartedAt = &progress.StartedAt
+	}
+	if !progress.FinishedAt.IsZero() {
+		resp.FinishedAt = &progress.FinishedAt
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
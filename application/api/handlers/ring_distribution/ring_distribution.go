@@ -0,0 +1,76 @@
+package ring_distribution
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"storage-gateway/application/api/apierror"
+	"storage-gateway/domain/services"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSamples = 10000
+	maxSamples     = 1000000
+)
+
+var errSamplesNotValid = errors.New("samples not valid")
+
+type RingDistributionHandler struct {
+	nps *services.NodePoolService
+}
+
+type NodeDistributionResponse struct {
+	NodeID       string  `json:"nodeID"`
+	Zone         string  `json:"zone,omitempty"`
+	VirtualNodes int     `json:"virtualNodes"`
+	Keys         int     `json:"keys"`
+	Share        float64 `json:"share"`
+}
+
+type RingDistributionResponse struct {
+	Samples int                        `json:"samples"`
+	Nodes   []NodeDistributionResponse `json:"nodes"`
+}
+
+func NewRingDistributionHandler(nps *services.NodePoolService) *RingDistributionHandler {
+	return &RingDistributionHandler{
+		nps: nps,
+	}
+}
+
+// RingDistribution hashes a sample of random object IDs onto the ring and reports how many of them each physical node owns
+func (h *RingDistributionHandler) RingDistribution(c echo.Context) error {
+	samples := defaultSamples
+	if rawSamples := c.QueryParam("samples"); rawSamples != "" {
+		var err error
+		if samples, err = strconv.Atoi(rawSamples); err != nil || samples <= 0 || samples > maxSamples {
+			return apierror.Err(c, http.StatusBadRequest, errSamplesNotValid)
+		}
+	}
+
+	keys := make([]string, samples)
+	for i := range keys {
+		keys[i] = strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+
+	resp := RingDistributionResponse{
+		Samples: samples,
+		Nodes:   make([]NodeDistributionResponse, 0),
+	}
+	for _, node := range h.nps.DistributionReport(keys) {
+		resp.Nodes = append(resp.Nodes, NodeDistributionResponse{
+			NodeID:       node.NodeID,
+			Zone:         node.Zone,
+			VirtualNodes: node.VirtualNodes,
+			Keys:         node.Keys,
+			Share:        node.Share,
+		})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Gzip returns Echo's gzip middleware, except that responses already carrying a Content-Encoding when their header is written,
+// such as objects served encoded as they are stored, are sent as they are instead of being compressed twice
+func Gzip(config middleware.GzipConfig) echo.MiddlewareFunc {
+	gzip := middleware.GzipWithConfig(config)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			raw := res.Writer
+
+			return gzip(func(c echo.Context) error {
+				// the gzip writer is only installed when the client accepts gzip
+				if res.Writer != raw {
+					res.Writer = &encodedResponseWriter{gzip: res.Writer, raw: raw}
+				}
+
+				return next(c)
+			})(c)
+		}
+	}
+}
+
+// encodedResponseWriter chooses, when the header is written, between the gzip writer and the raw one
+type encodedResponseWriter struct {
+	gzip   http.ResponseWriter
+	raw    http.ResponseWriter
+	target http.ResponseWriter
+}
+
+func (w *encodedResponseWriter) Header() http.Header {
+	return w.raw.Header()
+}
+
+func (w *encodedResponseWriter) WriteHeader(code int) {
+	w.chooseTarget()
+	w.target.WriteHeader(code)
+}
+
+func (w *encodedResponseWriter) Write(b []byte) (int, error) {
+	w.chooseTarget()
+	return w.target.Write(b)
+}
+
+func (w *encodedResponseWriter) Flush() {
+	w.chooseTarget()
+	if flusher, ok := w.target.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *encodedResponseWriter) chooseTarget() {
+	if w.target != nil {
+		return
+	}
+
+	w.target = w.gzip
+	if w.raw.Header().Get(echo.HeaderContentEncoding) != "" {
+		w.target = w.raw
+	}
+}
@@ -0,0 +1,80 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"storage-gateway/application/api/middlewares"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestGzipSendsEncodedResponsesAsTheyAre(t *testing.T) {
+	content := strings.Repeat("stored content ", 100)
+
+	var stored bytes.Buffer
+	zw := gzip.NewWriter(&stored)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(middlewares.Gzip(middleware.GzipConfig{}))
+	e.GET("/encoded", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentEncoding, "gzip")
+		return c.Blob(http.StatusOK, "text/plain", stored.Bytes())
+	})
+	e.GET("/plain", func(c echo.Context) error {
+		return c.String(http.StatusOK, content)
+	})
+
+	// the stored encoding is sent without being compressed again
+	rec := serve(e, "/encoded")
+	if !bytes.Equal(rec.Body.Bytes(), stored.Bytes()) {
+		t.Fatalf("encoded response of %d bytes, want the %d stored bytes", rec.Body.Len(), stored.Len())
+	}
+	if got := gunzip(t, rec.Body); got != content {
+		t.Fatalf("decoded content of %d bytes, want %d bytes", len(got), len(content))
+	}
+
+	rec = serve(e, "/plain")
+	if encoding := rec.Header().Get(echo.HeaderContentEncoding); encoding != "gzip" {
+		t.Fatalf("plain response Content-Encoding = %q, want gzip", encoding)
+	}
+	if got := gunzip(t, rec.Body); got != content {
+		t.Fatalf("decoded content of %d bytes, want %d bytes", len(got), len(content))
+	}
+}
+
+func serve(e *echo.Echo, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func gunzip(t *testing.T, r io.Reader) string {
+	t.Helper()
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gunzip: %v", err)
+	}
+
+	return string(content)
+}
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"storage-gateway/application/api/apierror"
+	"storage-gateway/domain/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ObjectID returns an Echo middleware answering 400 to requests whose objectID parameter doesn't follow the object ID rules
+// of the gateway API, which are stricter than the keys the services accept through the S3 API
+func ObjectID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !models.ObjectID(c.Param("objectID")).IsValidID() {
+				return apierror.Err(c, http.StatusBadRequest, models.ErrObjectIDNotValid)
+			}
+
+			return next(c)
+		}
+	}
+}
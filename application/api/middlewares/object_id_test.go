@@ -0,0 +1,33 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"testing"
+
+	"storage-gateway/application/api/middlewares"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestObjectIDKeepsTheGatewayRules(t *testing.T) {
+	e := echo.New()
+	e.GET("/object/:objectID", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, middlewares.ObjectID())
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{path: "/object/weg231", status: http.StatusOK},
+		{path: "/object/part-0000", status: http.StatusBadRequest},
+		{path: "/object/_SUCCESS", status: http.StatusBadRequest},
+		{path: "/object/abcdefghijklmnopqrstuvwxyz0123456", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		if rec := serve(e, tt.path); rec.Code != tt.status {
+			t.Fatalf("%s status = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+	}
+}
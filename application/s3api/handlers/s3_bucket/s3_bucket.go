@@ -0,0 +1,338 @@
+package s3_bucket
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"storage-gateway/application/s3api/s3error"
+	"storage-gateway/application/s3api/s3header"
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	// timeFormat is the ISO 8601 format of the dates in S3 responses
+	timeFormat = "2006-01-02T15:04:05.000Z"
+	// defaultMaxKeys is the S3 page size when the request doesn't set max-keys
+	defaultMaxKeys = 1000
+)
+
+// S3BucketHandler serves the operations of the single bucket the whole pool is exposed as
+type S3BucketHandler struct {
+	listObjectsService *services.ListObjectsService
+	bucket             string
+	region             string
+	created            time.Time
+}
+
+type Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type Bucket struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type ListAllMyBucketsResult struct {
+	XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Owner   Owner    `xml:"Owner"`
+	Buckets []Bucket `xml:"Buckets>Bucket"`
+}
+
+type LocationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+type Contents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type ListBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Marker                *string        `xml:"Marker"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	KeyCount              *int           `xml:"KeyCount"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []Contents     `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix `xml:"CommonPrefixes"`
+}
+
+// NewS3BucketHandler creates a new instance of S3BucketHandler for the bucket of the given name and region
+func NewS3BucketHandler(listObjectsService *services.ListObjectsService, bucket, region string) *S3BucketHandler {
+	return &S3BucketHandler{
+		listObjectsService: listObjectsService,
+		bucket:             bucket,
+		region:             region,
+		created:            time.Now().UTC(),
+	}
+}
+
+// ListBuckets lists the single bucket
+func (h *S3BucketHandler) ListBuckets(c echo.Context) error {
+	return c.XML(http.StatusOK, ListAllMyBucketsResult{
+		Xmlns:   namespace,
+		Owner:   Owner{ID: "storage-gateway", DisplayName: "storage-gateway"},
+		Buckets: []Bucket{{Name: h.bucket, CreationDate: h.created.Format(timeFormat)}},
+	})
+}
+
+func (h *S3BucketHandler) HeadBucket(c echo.Context) error {
+	c.Response().Header().Set("X-Amz-Bucket-Region", h.region)
+
+	return c.NoContent(http.StatusOK)
+}
+
+// CreateBucket only succeeds for the existing bucket, answering it is already owned like S3 does
+func (h *S3BucketHandler) CreateBucket(c echo.Context) error {
+	return s3error.Err(c, s3error.BucketAlreadyOwnedByYou, errors.New("bucket already owned by you"))
+}
+
+// GetBucketLocation answers the region of the bucket, us-east-1 being the empty location
+func (h *S3BucketHandler) GetBucketLocation(c echo.Context) error {
+	location := h.region
+	if location == "us-east-1" {
+		location = ""
+	}
+
+	return c.XML(http.StatusOK, LocationConstraint{Xmlns: namespace, Location: location})
+}
+
+// ListObjectsV2 lists a page of objects, the continuation token being the cursor of the listing service
+func (h *S3BucketHandler) ListObjectsV2(c echo.Context) error {
+	maxKeys, err := maxKeys(c)
+	if err != nil {
+		return s3error.Err(c, s3error.InvalidArgument, err)
+	}
+
+	result := h.listBucketResult(c, maxKeys)
+	result.ContinuationToken = c.QueryParam("continuation-token")
+	result.StartAfter = c.QueryParam("start-after")
+
+	cursor := result.ContinuationToken
+	if cursor == "" && result.StartAfter != "" {
+		if cursor, err = h.listObjectsService.StartAfterCursor(result.StartAfter); err != nil {
+			return s3error.Err(c, s3error.FromErr(err), err)
+		}
+	}
+
+	if maxKeys > 0 {
+		page, err := h.listPage(c.Request().Context(), result.Prefix, result.Delimiter, maxKeys, cursor)
+		if err != nil {
+			return s3error.Err(c, s3error.FromErr(err), err)
+		}
+
+		result.Contents, result.CommonPrefixes = page.contents, page.commonPrefixes
+		result.NextContinuationToken = page.nextCursor
+		result.IsTruncated = page.nextCursor != ""
+	}
+
+	keyCount := len(result.Contents) + len(result.CommonPrefixes)
+	result.KeyCount = &keyCount
+
+	encodeResult(&result)
+
+	return c.XML(http.StatusOK, result)
+}
+
+// ListObjects lists a page of objects after the marker, the next marker being the last key or common prefix of the page
+func (h *S3BucketHandler) ListObjects(c echo.Context) error {
+	maxKeys, err := maxKeys(c)
+	if err != nil {
+		return s3error.Err(c, s3error.InvalidArgument, err)
+	}
+
+	result := h.listBucketResult(c, maxKeys)
+	marker := c.QueryParam("marker")
+	result.Marker = &marker
+
+	if maxKeys > 0 {
+		cursor := ""
+		if marker != "" {
+			if cursor, err = h.listObjectsService.StartAfterCursor(h.startAfter(marker, result.Prefix, result.Delimiter)); err != nil {
+				return s3error.Err(c, s3error.FromErr(err), err)
+			}
+		}
+
+		page, err := h.listPage(c.Request().Context(), result.Prefix, result.Delimiter, maxKeys, cursor)
+		if err != nil {
+			return s3error.Err(c, s3error.FromErr(err), err)
+		}
+
+		result.Contents, result.CommonPrefixes = page.contents, page.commonPrefixes
+		result.IsTruncated = page.nextCursor != ""
+		if result.IsTruncated {
+			result.NextMarker = page.last
+		}
+	}
+
+	encodeResult(&result)
+
+	return c.XML(http.StatusOK, result)
+}
+
+// listPage is a page of a bucket listing, with the keys under a common prefix grouped into it
+type listPage struct {
+	contents       []Contents
+	commonPrefixes []CommonPrefix
+	// last is the last key or common prefix of the page
+	last string
+	// nextCursor resumes the listing after the page, being empty once the listing is over
+	nextCursor string
+}
+
+// listPage lists up to maxKeys keys and common prefixes from the cursor on. Pages of the listing service emptied by
+// its resolver are skipped, and the rest of a common prefix is skipped by resuming the listing after every key it holds
+func (h *S3BucketHandler) listPage(ctx context.Context, prefix, delimiter string, maxKeys int, cursor string) (*listPage, error) {
+	page := &listPage{contents: []Contents{}}
+
+	for {
+		list, err := h.listObjectsService.ListObjects(ctx, prefix, maxKeys-len(page.contents)-len(page.commonPrefixes), cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		next := list.NextCursor
+		for i, obj := range list.Objects {
+			key := obj.ID.Value()
+			commonPrefix, grouped := commonPrefixOf(key, prefix, delimiter)
+			if grouped && commonPrefix == page.last {
+				continue
+			}
+
+			if grouped {
+				page.commonPrefixes = append(page.commonPrefixes, CommonPrefix{Prefix: commonPrefix})
+				page.last = commonPrefix
+			} else {
+				page.contents = append(page.contents, contents(obj))
+				page.last = key
+			}
+
+			if grouped || (i < len(list.Objects)-1 && len(page.contents)+len(page.commonPrefixes) == maxKeys) {
+				if next, err = h.listObjectsService.StartAfterCursor(h.startAfter(page.last, prefix, delimiter)); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+
+		if len(page.contents)+len(page.commonPrefixes) == maxKeys || next == "" {
+			page.nextCursor = next
+			return page, nil
+		}
+		cursor = next
+	}
+}
+
+// startAfter returns the key a listing resumes after from the given key, the largest key under it when it's a common prefix
+func (h *S3BucketHandler) startAfter(key, prefix, delimiter string) string {
+	if commonPrefix, grouped := commonPrefixOf(key, prefix, delimiter); grouped && commonPrefix == key {
+		return key + string(utf8.MaxRune)
+	}
+
+	return key
+}
+
+// commonPrefixOf returns the common prefix grouping the key, up to the first delimiter after the listing prefix
+func commonPrefixOf(key, prefix, delimiter string) (string, bool) {
+	if delimiter == "" || !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+
+	i := strings.Index(key[len(prefix):], delimiter)
+	if i < 0 {
+		return "", false
+	}
+
+	return key[:len(prefix)+i+len(delimiter)], true
+}
+
+// encodeResult URL encodes the keys of the result when the request asked for it, since XML can't carry every key
+func encodeResult(result *ListBucketResult) {
+	if result.EncodingType != "url" {
+		return
+	}
+
+	result.Prefix = url.QueryEscape(result.Prefix)
+	result.Delimiter = url.QueryEscape(result.Delimiter)
+	result.StartAfter = url.QueryEscape(result.StartAfter)
+	result.NextMarker = url.QueryEscape(result.NextMarker)
+	if result.Marker != nil {
+		marker := url.QueryEscape(*result.Marker)
+		result.Marker = &marker
+	}
+	for i := range result.Contents {
+		result.Contents[i].Key = url.QueryEscape(result.Contents[i].Key)
+	}
+	for i := range result.CommonPrefixes {
+		result.CommonPrefixes[i].Prefix = url.QueryEscape(result.CommonPrefixes[i].Prefix)
+	}
+}
+
+func (h *S3BucketHandler) listBucketResult(c echo.Context, maxKeys int) ListBucketResult {
+	return ListBucketResult{
+		Xmlns:        namespace,
+		Name:         h.bucket,
+		Prefix:       c.QueryParam("prefix"),
+		Delimiter:    c.QueryParam("delimiter"),
+		EncodingType: c.QueryParam("encoding-type"),
+		MaxKeys:      maxKeys,
+		Contents:     []Contents{},
+	}
+}
+
+// maxKeys returns the max-keys of the request, capped to the largest page of the listing service
+func maxKeys(c echo.Context) (int, error) {
+	raw := c.QueryParam("max-keys")
+	if raw == "" {
+		return min(defaultMaxKeys, services.MaxListLimit), nil
+	}
+
+	maxKeys, err := strconv.Atoi(raw)
+	if err != nil || maxKeys < 0 {
+		return 0, models.ErrLimitNotValid
+	}
+
+	return min(maxKeys, services.MaxListLimit), nil
+}
+
+func contents(obj *models.Object) Contents {
+	return Contents{
+		Key:          obj.ID.Value(),
+		LastModified: obj.LastModified.UTC().Format(timeFormat),
+		ETag:         s3header.ETag(obj),
+		Size:         obj.Size,
+		StorageClass: "STANDARD",
+	}
+}
@@ -0,0 +1,268 @@
+package s3_multipart
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"storage-gateway/application/s3api/s3error"
+	"storage-gateway/application/s3api/s3header"
+	"storage-gateway/application/s3api/sigv4"
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	// timeFormat is the ISO 8601 format of the dates in S3 responses
+	timeFormat = "2006-01-02T15:04:05.000Z"
+	// maxCompleteBodySize bounds the part list of a complete request, enough for models.MaxPartNumber parts
+	maxCompleteBodySize = 2 << 20
+	// defaultMaxParts is the S3 page size of part listings
+	defaultMaxParts = 1000
+)
+
+// S3MultipartHandler serves the S3 multipart uploads, answering NotImplemented when multipartUploadService is nil
+type S3MultipartHandler struct {
+	multipartUploadService *services.MultipartUploadService
+	bucket                 string
+}
+
+type InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type Part struct {
+	PartNumber   int    `xml:"PartNumber"`
+	LastModified string `xml:"LastModified,omitempty"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size,omitempty"`
+}
+
+type ListPartsResult struct {
+	XMLName              xml.Name `xml:"ListPartsResult"`
+	Xmlns                string   `xml:"xmlns,attr"`
+	Bucket               string   `xml:"Bucket"`
+	Key                  string   `xml:"Key"`
+	UploadID             string   `xml:"UploadId"`
+	StorageClass         string   `xml:"StorageClass"`
+	PartNumberMarker     int      `xml:"PartNumberMarker"`
+	NextPartNumberMarker int      `xml:"NextPartNumberMarker"`
+	MaxParts             int      `xml:"MaxParts"`
+	IsTruncated          bool     `xml:"IsTruncated"`
+	Parts                []Part   `xml:"Part"`
+}
+
+type CompleteMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []Part   `xml:"Part"`
+}
+
+type CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func NewS3MultipartHandler(multipartUploadService *services.MultipartUploadService, bucket string) *S3MultipartHandler {
+	return &S3MultipartHandler{
+		multipartUploadService: multipartUploadService,
+		bucket:                 bucket,
+	}
+}
+
+// CreateMultipartUpload starts an upload of the object, the Content-Type of the request being the one of the object
+func (h *S3MultipartHandler) CreateMultipartUpload(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return s3error.Err(c, s3error.NotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	key := c.Param("*")
+	obj := &models.Object{
+		ID:          models.ObjectID(key),
+		ContentType: c.Request().Header.Get("Content-Type"),
+	}
+
+	uploadID, err := h.multipartUploadService.CreateUpload(c.Request().Context(), obj)
+	if err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	return c.XML(http.StatusOK, InitiateMultipartUploadResult{
+		Xmlns:    namespace,
+		Bucket:   h.bucket,
+		Key:      key,
+		UploadID: uploadID,
+	})
+}
+
+// UploadPart streams the body of the request as the part partNumber of the upload uploadId
+func (h *S3MultipartHandler) UploadPart(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return s3error.Err(c, s3error.NotImplemented, models.ErrMultipartNotSupported)
+	}
+	if c.Request().Header.Get("X-Amz-Copy-Source") != "" {
+		return s3error.Err(c, s3error.NotImplemented, errors.New("part copy not supported"))
+	}
+
+	number, err := strconv.Atoi(c.QueryParam("partNumber"))
+	if err != nil {
+		return s3error.Err(c, s3error.InvalidArgument, models.ErrPartNotValid)
+	}
+
+	part := &models.Object{
+		ID:       models.ObjectID(c.Param("*")),
+		Content:  c.Request().Body,
+		Size:     c.Request().ContentLength,
+		Metadata: s3header.Metadata(c.Request().Header),
+	}
+
+	stored, err := h.multipartUploadService.UploadPart(c.Request().Context(), c.QueryParam("uploadId"), number, part)
+	if err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	c.Response().Header().Set("ETag", strconv.Quote(stored.ETag))
+
+	return c.NoContent(http.StatusOK)
+}
+
+// ListParts lists a page of the parts uploaded so far to the upload uploadId, after part-number-marker
+func (h *S3MultipartHandler) ListParts(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return s3error.Err(c, s3error.NotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	key := c.Param("*")
+	result := ListPartsResult{
+		Xmlns:        namespace,
+		Bucket:       h.bucket,
+		Key:          key,
+		UploadID:     c.QueryParam("uploadId"),
+		StorageClass: "STANDARD",
+		MaxParts:     defaultMaxParts,
+		Parts:        []Part{},
+	}
+
+	var err error
+	if raw := c.QueryParam("max-parts"); raw != "" {
+		if result.MaxParts, err = strconv.Atoi(raw); err != nil || result.MaxParts < 0 {
+			return s3error.Err(c, s3error.InvalidArgument, errors.New("max-parts not valid"))
+		}
+		result.MaxParts = min(result.MaxParts, defaultMaxParts)
+	}
+	if raw := c.QueryParam("part-number-marker"); raw != "" {
+		if result.PartNumberMarker, err = strconv.Atoi(raw); err != nil || result.PartNumberMarker < 0 {
+			return s3error.Err(c, s3error.InvalidArgument, errors.New("part-number-marker not valid"))
+		}
+	}
+
+	parts, err := h.multipartUploadService.ListParts(c.Request().Context(), key, result.UploadID)
+	if err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	for _, part := range parts {
+		if part.Number <= result.PartNumberMarker {
+			continue
+		}
+		if len(result.Parts) == result.MaxParts {
+			result.IsTruncated = true
+			break
+		}
+
+		result.Parts = append(result.Parts, Part{
+			PartNumber:   part.Number,
+			LastModified: part.LastModified.UTC().Format(timeFormat),
+			ETag:         strconv.Quote(part.ETag),
+			Size:         part.Size,
+		})
+		result.NextPartNumberMarker = part.Number
+	}
+
+	return c.XML(http.StatusOK, result)
+}
+
+// CompleteMultipartUpload assembles the object from the parts listed in the XML body of the request
+func (h *S3MultipartHandler) CompleteMultipartUpload(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return s3error.Err(c, s3error.NotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	body, err := readBody(c.Request())
+	if err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	var req CompleteMultipartUpload
+	if err = xml.Unmarshal(body, &req); err != nil {
+		return s3error.Err(c, s3error.MalformedXML, err)
+	}
+
+	parts := make([]*models.Part, 0, len(req.Parts))
+	for _, part := range req.Parts {
+		parts = append(parts, &models.Part{Number: part.PartNumber, ETag: strings.Trim(part.ETag, `"`)})
+	}
+
+	key := c.Param("*")
+	obj, err := h.multipartUploadService.CompleteUpload(c.Request().Context(), key, c.QueryParam("uploadId"), parts)
+	if err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	return c.XML(http.StatusOK, CompleteMultipartUploadResult{
+		Xmlns:    namespace,
+		Location: c.Scheme() + "://" + c.Request().Host + "/" + h.bucket + "/" + key,
+		Bucket:   h.bucket,
+		Key:      key,
+		ETag:     s3header.ETag(obj),
+	})
+}
+
+// AbortMultipartUpload drops the upload uploadId and its parts
+func (h *S3MultipartHandler) AbortMultipartUpload(c echo.Context) error {
+	if h.multipartUploadService == nil {
+		return s3error.Err(c, s3error.NotImplemented, models.ErrMultipartNotSupported)
+	}
+
+	if err := h.multipartUploadService.AbortUpload(c.Request().Context(), c.Param("*"), c.QueryParam("uploadId")); err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// readBody reads a request body of up to maxCompleteBodySize bytes, checking it against its signed SHA-256
+func readBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCompleteBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxCompleteBodySize {
+		return nil, models.ErrObjectTooLarge
+	}
+
+	payloadHash := r.Header.Get(sigv4.HeaderContentSHA256)
+	if expected, err := hex.DecodeString(payloadHash); err == nil && len(expected) == sha256.Size {
+		if hash := sha256.Sum256(body); !bytes.Equal(hash[:], expected) {
+			return nil, models.ErrDigestMismatch
+		}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,151 @@
+package s3_object
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"storage-gateway/application/s3api/s3error"
+	"storage-gateway/application/s3api/s3header"
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+
+	"github.com/labstack/echo/v4"
+)
+
+// S3ObjectHandler serves the S3 object operations, the object ID being the key of the request
+type S3ObjectHandler struct {
+	getObjectService    *services.GetObjectService
+	statObjectService   *services.StatObjectService
+	putObjectService    *services.PutObjectService
+	deleteObjectService *services.DeleteObjectService
+}
+
+func NewS3ObjectHandler(
+	getObjectService *services.GetObjectService,
+	statObjectService *services.StatObjectService,
+	putObjectService *services.PutObjectService,
+	deleteObjectService *services.DeleteObjectService,
+) *S3ObjectHandler {
+	return &S3ObjectHandler{
+		getObjectService:    getObjectService,
+		statObjectService:   statObjectService,
+		putObjectService:    putObjectService,
+		deleteObjectService: deleteObjectService,
+	}
+}
+
+// GetObject streams the object, or the part of it requested with a Range header
+func (h *S3ObjectHandler) GetObject(c echo.Context) error {
+	id := c.Param("*")
+
+	// malformed or multi-range headers are ignored and answered with the full content
+	rng, _ := models.ParseByteRange(c.Request().Header.Get("Range"))
+
+	// S3 clients expect the content as uploaded, so the context carries no Accept-Encoding
+	obj, err := h.getObjectService.GetObject(c.Request().Context(), models.ObjectID(id), rng)
+	if err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	if closer, ok := obj.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	header := c.Response().Header()
+	setObjectHeaders(header, obj)
+
+	status := http.StatusOK
+	contentLength := obj.Size
+	if obj.Range != nil {
+		status = http.StatusPartialContent
+		contentLength = obj.Range.Length()
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", obj.Range.Start, obj.Range.End, obj.Size))
+	}
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(contentLength, 10))
+	c.Response().WriteHeader(status)
+
+	// the status line is already sent at this point, so a failed copy is only returned to be logged
+	_, err = io.Copy(c.Response(), obj.Content)
+	if errors.Is(err, models.ErrDigestMismatch) {
+		// the connection is dropped so that the client can't take the response for a complete one
+		c.Logger().Errorf("object %s failed its digest verification", id)
+		panic(http.ErrAbortHandler)
+	}
+
+	return err
+}
+
+// HeadObject answers the headers GetObject would send for the whole object
+func (h *S3ObjectHandler) HeadObject(c echo.Context) error {
+	obj, err := h.statObjectService.StatObject(c.Request().Context(), models.ObjectID(c.Param("*")))
+	if err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	header := c.Response().Header()
+	setObjectHeaders(header, obj)
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(obj.Size, 10))
+
+	return c.NoContent(http.StatusOK)
+}
+
+// PutObject streams the body of the request to the storage, and answers the ETag HEAD, GET and listings answer for the object.
+// Without a Content-MD5, that is the ETag of the storage, which compression, encryption or deduplication set to something else
+// than the MD5 of the content, so it is read back once the object is stored. The MD5 of the content is answered
+// when the object can't be read back, such as when it was deleted in the meantime
+func (h *S3ObjectHandler) PutObject(c echo.Context) error {
+	if c.Request().Header.Get("X-Amz-Copy-Source") != "" {
+		return s3error.Err(c, s3error.NotImplemented, errors.New("object copy not supported"))
+	}
+
+	hash := md5.New()
+	obj := &models.Object{
+		ID:          models.ObjectID(c.Param("*")),
+		Content:     io.TeeReader(c.Request().Body, hash),
+		ContentType: c.Request().Header.Get("Content-Type"),
+		Size:        c.Request().ContentLength,
+		Metadata:    s3header.Metadata(c.Request().Header),
+	}
+
+	if err := h.putObjectService.PutObject(c.Request().Context(), obj); err != nil {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	etag := strconv.Quote(hex.EncodeToString(hash.Sum(nil)))
+	if stored, err := h.statObjectService.StatObject(c.Request().Context(), obj.ID); err == nil && s3header.ETag(stored) != "" {
+		etag = s3header.ETag(stored)
+	}
+	c.Response().Header().Set("ETag", etag)
+
+	return c.NoContent(http.StatusOK)
+}
+
+// DeleteObject deletes the object, deleting a missing object succeeding like in S3
+func (h *S3ObjectHandler) DeleteObject(c echo.Context) error {
+	err := h.deleteObjectService.DeleteObject(c.Request().Context(), models.ObjectID(c.Param("*")))
+	if err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+		return s3error.Err(c, s3error.FromErr(err), err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func setObjectHeaders(header http.Header, obj *models.Object) {
+	header.Set("Accept-Ranges", "bytes")
+	if obj.ContentType != "" {
+		header.Set(echo.HeaderContentType, obj.ContentType)
+	} else {
+		header.Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	}
+	if etag := s3header.ETag(obj); etag != "" {
+		header.Set("ETag", etag)
+	}
+	if !obj.LastModified.IsZero() {
+		header.Set(echo.HeaderLastModified, obj.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
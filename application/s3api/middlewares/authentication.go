@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"storage-gateway/application/s3api/s3error"
+	"storage-gateway/application/s3api/sigv4"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Authentication returns an Echo middleware that rejects the requests whose signature the verifier doesn't accept
+func Authentication(verifier *sigv4.Verifier) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := verifier.Verify(c.Request()); err != nil {
+				return s3error.Err(c, s3error.FromErr(err), err)
+			}
+
+			return next(c)
+		}
+	}
+}
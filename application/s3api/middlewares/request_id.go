@@ -0,0 +1,18 @@
+package middlewares
+
+import (
+	"storage-gateway/internal/context-wrapper"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequestID returns an Echo middleware that sends the correlation ID of the request as its S3 request ID
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set("X-Amz-Request-Id", context_wrapper.GetCorrelationID(c.Request().Context()))
+
+			return next(c)
+		}
+	}
+}
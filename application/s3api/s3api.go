@@ -0,0 +1,240 @@
+package s3api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"storage-gateway/application/api/middlewares"
+	"storage-gateway/application/s3api/handlers/s3_bucket"
+	"storage-gateway/application/s3api/handlers/s3_multipart"
+	"storage-gateway/application/s3api/handlers/s3_object"
+	s3middlewares "storage-gateway/application/s3api/middlewares"
+	"storage-gateway/application/s3api/s3error"
+	"storage-gateway/application/s3api/sigv4"
+	"storage-gateway/config"
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/services"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// subresources are the S3 query parameters selecting operations the gateway doesn't implement
+var subresources = []string{
+	"acl", "analytics", "attributes", "cors", "delete", "encryption", "intelligent-tiering", "inventory", "legal-hold",
+	"lifecycle", "logging", "metrics", "notification", "object-lock", "ownershipControls", "policy", "policyStatus",
+	"publicAccessBlock", "replication", "requestPayment", "restore", "retention", "select", "tagging", "torrent",
+	"versioning", "versions", "website",
+}
+
+// S3API serves the whole pool as a single bucket through the S3 wire protocol, with path-style requests
+type S3API struct {
+	server *echo.Echo
+	config config.Config
+	Addr   string
+}
+
+// NewS3Api creates the S3 API, mus being nil when multipart uploads are disabled
+func NewS3Api(nps *services.NodePoolService, storage ports.ObjectStorage, mus *services.MultipartUploadService, config config.Config) *S3API {
+	return &S3API{
+		server: echoServer(nps, storage, mus, config),
+		config: config,
+		Addr:   net.JoinHostPort(config.S3Api.Host, strconv.Itoa(config.S3Api.Port)),
+	}
+}
+
+func (a *S3API) Start() error {
+	log.Infof("S3 listener running on %s", a.Addr)
+	return a.server.Start(a.Addr)
+}
+
+// Shutdown gracefully shuts down the S3 API server
+func (a *S3API) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.config.App.ShutdownTimeoutInSeconds)*time.Second)
+	defer cancel()
+
+	if err := a.server.Shutdown(ctx); err != nil {
+		log.Fatalf("could not shutdown S3 API server gracefully with error %s", err)
+	}
+}
+
+// echoServer sets up an Echo server answering S3 requests. Unlike the gateway API it has no timeout,
+// since S3 clients upload large objects in a single request, and no gzip, since S3 clients don't expect encoded content
+func echoServer(nps *services.NodePoolService, storage ports.ObjectStorage, mus *services.MultipartUploadService, config config.Config) *echo.Echo {
+	e := echo.New()
+
+	e.Logger.SetLevel(log.Lvl(config.App.LogLevel))
+
+	e.Server.ReadHeaderTimeout = time.Duration(config.Api.ReadHeaderTimeoutInSeconds) * time.Second
+
+	// routing errors, such as unknown methods, are answered as S3 errors as well
+	e.HTTPErrorHandler = func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			_ = s3error.Err(c, s3error.NotImplemented, fmt.Errorf("%v", httpErr.Message))
+			return
+		}
+		_ = s3error.Err(c, s3error.InternalError, err)
+	}
+
+	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
+		Skipper: middleware.DefaultSkipper,
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			log.Errort(context_wrapper.GetCorrelationID(c.Request().Context()), fmt.Sprintf("[PANIC RECOVER] Error: %s, Stack trace: %s", err, string(stack)))
+			return err
+		},
+	}))
+
+	e.Use(middleware.LoggerWithConfig(
+		middleware.LoggerConfig{
+			Output: e.Logger.Output(),
+			Format: `{"time":"${time_rfc3339_nano}","trackID":"${id}","remote_ip":"${remote_ip}",` +
+				`"host":"${host}","method":"${method}","uri":"${uri}","user_agent":"${user_agent}",` +
+				`"status":${status},"error":"${error}","latency":${latency},"latency_human":"${latency_human}"` +
+				`,"bytes_in":${bytes_in},"bytes_out":${bytes_out}}` + "\n",
+		}))
+
+	e.Use(middlewares.CorrelationID())
+
+	e.Use(s3middlewares.RequestID())
+
+	verifier := sigv4.NewVerifier(config.S3Api.Region, sigv4.Credentials{
+		AccessKey: config.S3Api.AccessKey,
+		SecretKey: config.S3Api.SecretKey,
+	})
+	e.Use(s3middlewares.Authentication(verifier))
+
+	resolver, _ := storage.(ports.ListingResolver)
+	bucketHandler := s3_bucket.NewS3BucketHandler(services.NewListObjectsService(nps, resolver), config.S3Api.Bucket, config.S3Api.Region)
+	objectHandler := s3_object.NewS3ObjectHandler(
+		services.NewGetObjectService(storage, config.Api.VerifyDigestsOnRead),
+		services.NewStatObjectService(storage),
+		services.NewPutObjectService(storage, config.Api.MaxObjectSizeInBytes),
+		services.NewDeleteObjectService(storage),
+	)
+	multipartHandler := s3_multipart.NewS3MultipartHandler(mus, config.S3Api.Bucket)
+
+	e.GET("/", func(c echo.Context) error {
+		return bucketHandler.ListBuckets(c)
+	})
+
+	// requests on the bucket and on its objects share the routes, told apart by the key and the query parameters
+	bucket := e.Group("/:bucket", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := unescapeParams(c); err != nil {
+				return s3error.Err(c, s3error.InvalidArgument, err)
+			}
+			if c.Param("bucket") != config.S3Api.Bucket {
+				return s3error.Err(c, s3error.NoSuchBucket, fmt.Errorf("bucket %s not found", c.Param("bucket")))
+			}
+			if subresource, ok := unsupportedSubresource(c); ok {
+				return s3error.Err(c, s3error.NotImplemented, fmt.Errorf("%s not supported", subresource))
+			}
+			return next(c)
+		}
+	})
+
+	for _, path := range []string{"", "/*"} {
+		bucket.GET(path, func(c echo.Context) error {
+			query := c.QueryParams()
+			switch {
+			case c.Param("*") != "" && query.Has("uploadId"):
+				return multipartHandler.ListParts(c)
+			case c.Param("*") != "":
+				return objectHandler.GetObject(c)
+			case query.Has("location"):
+				return bucketHandler.GetBucketLocation(c)
+			case query.Has("uploads"):
+				return s3error.Err(c, s3error.NotImplemented, errors.New("multipart upload listing not supported"))
+			case query.Get("list-type") == "2":
+				return bucketHandler.ListObjectsV2(c)
+			default:
+				return bucketHandler.ListObjects(c)
+			}
+		})
+
+		bucket.HEAD(path, func(c echo.Context) error {
+			if c.Param("*") == "" {
+				return bucketHandler.HeadBucket(c)
+			}
+			return objectHandler.HeadObject(c)
+		})
+
+		bucket.PUT(path, func(c echo.Context) error {
+			switch {
+			case c.Param("*") == "":
+				return bucketHandler.CreateBucket(c)
+			case c.QueryParams().Has("uploadId"):
+				return multipartHandler.UploadPart(c)
+			default:
+				return objectHandler.PutObject(c)
+			}
+		})
+
+		bucket.POST(path, func(c echo.Context) error {
+			switch {
+			case c.Param("*") != "" && c.QueryParams().Has("uploads"):
+				return multipartHandler.CreateMultipartUpload(c)
+			case c.Param("*") != "" && c.QueryParams().Has("uploadId"):
+				return multipartHandler.CompleteMultipartUpload(c)
+			default:
+				return s3error.Err(c, s3error.NotImplemented, errors.New("operation not supported"))
+			}
+		})
+
+		bucket.DELETE(path, func(c echo.Context) error {
+			switch {
+			case c.Param("*") == "":
+				return s3error.Err(c, s3error.NotImplemented, errors.New("bucket deletion not supported"))
+			case c.QueryParams().Has("uploadId"):
+				return multipartHandler.AbortMultipartUpload(c)
+			default:
+				return objectHandler.DeleteObject(c)
+			}
+		})
+	}
+
+	return e
+}
+
+// unescapeParams decodes the route parameters, which Echo takes from the escaped path when it differs from the decoded one,
+// as it does for keys holding a '+' or a '%'
+func unescapeParams(c echo.Context) error {
+	if c.Request().URL.RawPath == "" {
+		return nil
+	}
+
+	values := c.ParamValues()
+	for i, value := range values {
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return err
+		}
+		values[i] = unescaped
+	}
+	c.SetParamValues(values...)
+
+	return nil
+}
+
+func unsupportedSubresource(c echo.Context) (string, bool) {
+	query := c.QueryParams()
+	for _, subresource := range subresources {
+		if query.Has(subresource) {
+			return subresource, true
+		}
+	}
+
+	return "", false
+}
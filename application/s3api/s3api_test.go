@@ -0,0 +1,250 @@
+package s3api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"storage-gateway/config"
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/discovery-service"
+	"storage-gateway/infrastructure/object-storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const bucket = "storage-gateway"
+
+// keys are S3 keys which aren't object IDs of the gateway API
+var keys = []string{"_SUCCESS", "dir/file.txt", "dir/sub/nested.txt", "part-0000.parquet", "with space+plus.txt"}
+
+func TestS3ApiObjectKeys(t *testing.T) {
+	ctx := context.Background()
+	client := newS3Client(t, nil)
+
+	for _, key := range keys {
+		content := "content of " + key
+		if _, err := client.PutObject(ctx, bucket, key, bytes.NewReader([]byte(content)), int64(len(content)), minio.PutObjectOptions{}); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+
+		info, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+		if err != nil {
+			t.Fatalf("stat %s: %v", key, err)
+		}
+		if info.Key != key || info.Size != int64(len(content)) {
+			t.Fatalf("stat %s = key %q size %d, want key %q size %d", key, info.Key, info.Size, key, len(content))
+		}
+
+		if got := readObject(t, client, key); got != content {
+			t.Fatalf("get %s = %q, want %q", key, got, content)
+		}
+	}
+
+	for _, key := range keys {
+		if err := client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{}); err != nil {
+			t.Fatalf("remove %s: %v", key, err)
+		}
+		if _, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{}); minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			t.Fatalf("stat %s after remove error = %v, want NoSuchKey", key, err)
+		}
+	}
+
+	// keys reserved for the gateway are rejected
+	_, err := client.PutObject(ctx, bucket, "~reserved", bytes.NewReader([]byte("content")), 7, minio.PutObjectOptions{})
+	if err == nil {
+		t.Fatalf("put of a reserved key succeeded")
+	}
+}
+
+func TestS3ApiListObjectsDelimiter(t *testing.T) {
+	ctx := context.Background()
+	client := newS3Client(t, nil)
+
+	for _, key := range keys {
+		if _, err := client.PutObject(ctx, bucket, key, bytes.NewReader([]byte(key)), int64(len(key)), minio.PutObjectOptions{}); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts minio.ListObjectsOptions
+		want []string
+	}{
+		{
+			name: "recursive",
+			opts: minio.ListObjectsOptions{Recursive: true},
+			want: keys,
+		},
+		{
+			// keys come before the common prefixes of a page
+			name: "delimiter",
+			opts: minio.ListObjectsOptions{},
+			want: []string{"_SUCCESS", "part-0000.parquet", "with space+plus.txt", "dir/"},
+		},
+		{
+			name: "prefix and delimiter",
+			opts: minio.ListObjectsOptions{Prefix: "dir/"},
+			want: []string{"dir/file.txt", "dir/sub/"},
+		},
+		{
+			name: "pages of one key",
+			opts: minio.ListObjectsOptions{MaxKeys: 1},
+			want: []string{"_SUCCESS", "dir/", "part-0000.parquet", "with space+plus.txt"},
+		},
+		{
+			name: "version 1 pages of one key",
+			opts: minio.ListObjectsOptions{MaxKeys: 1, UseV1: true},
+			want: []string{"_SUCCESS", "dir/", "part-0000.parquet", "with space+plus.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for info := range client.ListObjects(ctx, bucket, tt.opts) {
+				if info.Err != nil {
+					t.Fatalf("list: %v", info.Err)
+				}
+				got = append(got, info.Key)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("listed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3ApiMultipartUploadKey(t *testing.T) {
+	ctx := context.Background()
+	client := newS3Client(t, nil)
+
+	key := "dir/large file.bin"
+	content := bytes.Repeat([]byte("0123456789abcdef"), (6<<20)/16)
+	_, err := client.PutObject(ctx, bucket, key, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{PartSize: 5 << 20})
+	if err != nil {
+		t.Fatalf("multipart put %s: %v", key, err)
+	}
+
+	if got := readObject(t, client, key); got != string(content) {
+		t.Fatalf("get %s returned %d bytes, want the %d uploaded", key, len(got), len(content))
+	}
+}
+
+func TestS3ApiPutAnswersTheStoredETag(t *testing.T) {
+	ctx := context.Background()
+	client := newS3Client(t, func(storage ports.ObjectStorage) ports.ObjectStorage {
+		compressed, err := services.NewCompressedStorage(storage, services.CompressionOptions{
+			Rules: []services.CompressionRule{{ContentType: "*", Codec: services.CodecGzip}},
+		})
+		if err != nil {
+			t.Fatalf("create compressed storage: %v", err)
+		}
+		return compressed
+	})
+
+	content := bytes.Repeat([]byte("compressible content "), 100)
+	info, err := client.PutObject(ctx, bucket, "dir/compressed.txt", bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{
+		ContentType: "text/plain",
+	})
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	stat, err := client.StatObject(ctx, bucket, "dir/compressed.txt", minio.StatObjectOptions{})
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.ETag == "" || info.ETag != stat.ETag {
+		t.Fatalf("put ETag = %q, stat ETag = %q, want the same", info.ETag, stat.ETag)
+	}
+
+	for listed := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: "dir/"}) {
+		if listed.Err != nil {
+			t.Fatalf("list: %v", listed.Err)
+		}
+		if listed.ETag != stat.ETag || listed.Size != int64(len(content)) {
+			t.Fatalf("listed ETag %q and size %d, want %q and %d", listed.ETag, listed.Size, stat.ETag, len(content))
+		}
+	}
+}
+
+// newS3Client serves the S3 API over a pool of three in-memory nodes, returning a client of it.
+// wrap, when not nil, wraps the replicated storage of the pool like the layers configured on top of it
+func newS3Client(t *testing.T, wrap func(ports.ObjectStorage) ports.ObjectStorage) *minio.Client {
+	t.Helper()
+
+	discovered := make([]ports.ObjectStorage, 0, 3)
+	for i := 0; i < 3; i++ {
+		discovered = append(discovered, object_storage.NewMemoryObjectStore(fmt.Sprintf("node-%d", i), 0))
+	}
+	nps := services.NewNodePoolService(discovery_service.NewMemoryDiscoveryService(discovered...), services.RingOptions{})
+	nps.RefreshNodes()
+
+	replicated, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{Replicas: 2})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+
+	cfg := config.Config{
+		App: config.App{LogLevel: "error"},
+		Api: config.Api{MaxObjectSizeInBytes: 16 << 20},
+		S3Api: config.S3Api{
+			Bucket:    bucket,
+			Region:    "us-east-1",
+			AccessKey: "gatewaykey",
+			SecretKey: "gatewaysecret",
+		},
+	}
+	mus := services.NewMultipartUploadService(nps, replicated, cfg.Api.MaxObjectSizeInBytes)
+
+	storage := ports.ObjectStorage(replicated)
+	if wrap != nil {
+		storage = wrap(storage)
+	}
+
+	server := httptest.NewServer(echoServer(nps, storage, mus, cfg))
+	t.Cleanup(server.Close)
+
+	endpoint, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parse server URL: %v", err)
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.S3Api.AccessKey, cfg.S3Api.SecretKey, ""),
+		Region:       cfg.S3Api.Region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+
+	return client
+}
+
+func readObject(t *testing.T, client *minio.Client, key string) string {
+	t.Helper()
+
+	obj, err := client.GetObject(context.Background(), bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer obj.Close()
+
+	content, err := io.ReadAll(obj)
+	if err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+
+	return string(content)
+}
@@ -0,0 +1,133 @@
+package s3error
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"os"
+
+	"storage-gateway/application/s3api/sigv4"
+	"storage-gateway/domain/models"
+	"storage-gateway/internal/context-wrapper"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Code is an S3 error code along with the status it is answered with
+type Code struct {
+	Name   string
+	Status int
+}
+
+var (
+	AccessDenied                 = Code{"AccessDenied", http.StatusForbidden}
+	AuthorizationHeaderMalformed = Code{"AuthorizationHeaderMalformed", http.StatusBadRequest}
+	BadDigest                    = Code{"BadDigest", http.StatusBadRequest}
+	BucketAlreadyOwnedByYou      = Code{"BucketAlreadyOwnedByYou", http.StatusConflict}
+	EntityTooLarge               = Code{"EntityTooLarge", http.StatusBadRequest}
+	EntityTooSmall               = Code{"EntityTooSmall", http.StatusBadRequest}
+	IncompleteBody               = Code{"IncompleteBody", http.StatusBadRequest}
+	InternalError                = Code{"InternalError", http.StatusInternalServerError}
+	InvalidAccessKeyID           = Code{"InvalidAccessKeyId", http.StatusForbidden}
+	InvalidArgument              = Code{"InvalidArgument", http.StatusBadRequest}
+	InvalidDigest                = Code{"InvalidDigest", http.StatusBadRequest}
+	InvalidPart                  = Code{"InvalidPart", http.StatusBadRequest}
+	InvalidRange                 = Code{"InvalidRange", http.StatusRequestedRangeNotSatisfiable}
+	InvalidRequest               = Code{"InvalidRequest", http.StatusBadRequest}
+	MalformedXML                 = Code{"MalformedXML", http.StatusBadRequest}
+	MissingContentLength         = Code{"MissingContentLength", http.StatusLengthRequired}
+	NoSuchBucket                 = Code{"NoSuchBucket", http.StatusNotFound}
+	NoSuchKey                    = Code{"NoSuchKey", http.StatusNotFound}
+	NoSuchUpload                 = Code{"NoSuchUpload", http.StatusNotFound}
+	NotImplemented               = Code{"NotImplemented", http.StatusNotImplemented}
+	RequestTimeTooSkewed         = Code{"RequestTimeTooSkewed", http.StatusForbidden}
+	ServiceUnavailable           = Code{"ServiceUnavailable", http.StatusServiceUnavailable}
+	SignatureDoesNotMatch        = Code{"SignatureDoesNotMatch", http.StatusForbidden}
+	XAmzContentSHA256Mismatch    = Code{"XAmzContentSHA256Mismatch", http.StatusBadRequest}
+)
+
+type ErrorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// Err answers an S3 XML error, whose message is the one of reqErr
+func Err(c echo.Context, code Code, reqErr error) error {
+	resp := ErrorResponse{
+		Code:      code.Name,
+		Message:   reqErr.Error(),
+		Resource:  c.Request().URL.Path,
+		RequestID: context_wrapper.GetCorrelationID(c.Request().Context()),
+	}
+
+	// HEAD responses can't carry the error, so only its status is sent
+	if c.Request().Method == http.MethodHead {
+		if err := c.NoContent(code.Status); err != nil {
+			reqErr = err
+		}
+		return reqErr
+	}
+
+	if err := c.XML(code.Status, resp); err != nil {
+		reqErr = err
+	}
+
+	return reqErr
+}
+
+// FromErr returns the S3 error code of an error returned by the services or by the signature verification
+func FromErr(err error) Code {
+	switch {
+	case errors.Is(err, sigv4.ErrMissingAuthentication),
+		errors.Is(err, sigv4.ErrRequestExpired):
+		return AccessDenied
+	case errors.Is(err, sigv4.ErrAuthorizationNotValid):
+		return AuthorizationHeaderMalformed
+	case errors.Is(err, sigv4.ErrAccessKeyNotFound):
+		return InvalidAccessKeyID
+	case errors.Is(err, sigv4.ErrSignatureMismatch):
+		return SignatureDoesNotMatch
+	case errors.Is(err, sigv4.ErrRequestTimeTooSkewed):
+		return RequestTimeTooSkewed
+	case errors.Is(err, sigv4.ErrContentSHA256NotValid),
+		errors.Is(err, sigv4.ErrTrailerNotSupported):
+		return InvalidRequest
+	case errors.Is(err, sigv4.ErrDecodedLengthMissing),
+		errors.Is(err, models.ErrPartLengthNotValid):
+		return MissingContentLength
+	case errors.Is(err, sigv4.ErrChunkNotValid):
+		return IncompleteBody
+	case errors.Is(err, sigv4.ErrContentSHA256Mismatch):
+		return XAmzContentSHA256Mismatch
+	case errors.Is(err, sigv4.ErrTrailerChecksumMismatch),
+		errors.Is(err, models.ErrDigestMismatch):
+		return BadDigest
+	case errors.Is(err, models.ErrObjectIDNotValid),
+		errors.Is(err, models.ErrLimitNotValid),
+		errors.Is(err, models.ErrCursorNotValid):
+		return InvalidArgument
+	case errors.Is(err, models.ErrDigestNotValid):
+		return InvalidDigest
+	case errors.Is(err, models.ErrObjectNotFound):
+		return NoSuchKey
+	case errors.Is(err, models.ErrRangeNotSatisfiable):
+		return InvalidRange
+	case errors.Is(err, models.ErrObjectTooLarge):
+		return EntityTooLarge
+	case errors.Is(err, models.ErrUploadNotFound):
+		return NoSuchUpload
+	case errors.Is(err, models.ErrPartNotValid):
+		return InvalidPart
+	case errors.Is(err, models.ErrPartTooSmall):
+		return EntityTooSmall
+	case errors.Is(err, models.ErrMultipartNotSupported):
+		return NotImplemented
+	case errors.Is(err, models.ErrObjectStorageNotAvailable), os.IsTimeout(err):
+		return ServiceUnavailable
+	default:
+		return InternalError
+	}
+}
@@ -0,0 +1,54 @@
+package s3header
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"storage-gateway/application/api/digestheader"
+	"storage-gateway/application/s3api/sigv4"
+	"storage-gateway/domain/models"
+)
+
+const HeaderChecksumSHA256 = "X-Amz-Checksum-Sha256"
+
+// Metadata returns the digests of an S3 request as object metadata, nil when there are none.
+// The signature verification already checks the body against the signed payload hash, which is stored as the SHA-256 digest
+// unless the request carries an X-Amz-Checksum-Sha256. That checksum may not be signed, so it is only checked in addition.
+// User metadata is left out, as it could overwrite the metadata the gateway stores with objects
+func Metadata(header http.Header) map[string]string {
+	metadata := digestheader.Metadata(header)
+
+	sha256 := header.Get(HeaderChecksumSHA256)
+	if payloadHash := header.Get(sigv4.HeaderContentSHA256); sha256 == "" && isHexSHA256(payloadHash) {
+		sha256 = payloadHash
+	}
+	if sha256 == "" {
+		return metadata
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string, 1)
+	}
+	metadata[models.MetadataSHA256] = sha256
+
+	return metadata
+}
+
+// ETag returns the quoted entity tag of an object, the hex MD5 of its content when it was uploaded with one
+// like S3 does, the storage one otherwise
+func ETag(obj *models.Object) string {
+	if digest, ok := obj.Digests()[models.MetadataMD5]; ok {
+		return strconv.Quote(hex.EncodeToString(digest))
+	}
+	if obj.ETag == "" {
+		return ""
+	}
+
+	return strconv.Quote(obj.ETag)
+}
+
+func isHexSHA256(value string) bool {
+	decoded, err := hex.DecodeString(value)
+	return err == nil && len(decoded) == 32
+}
@@ -0,0 +1,317 @@
+package sigv4
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxChunkSize bounds the memory a chunk is buffered in while its signature is checked
+	maxChunkSize = 16 << 20
+	// maxChunkLineSize bounds the chunk headers and trailer lines
+	maxChunkLineSize = 4 << 10
+
+	chunkAlgorithm   = "AWS4-HMAC-SHA256-PAYLOAD"
+	trailerAlgorithm = "AWS4-HMAC-SHA256-TRAILER"
+)
+
+// trailerChecksums are the trailing checksums that can be checked, by their header name
+var trailerChecksums = map[string]func() hash.Hash{
+	"x-amz-checksum-crc32":     func() hash.Hash { return crc32.NewIEEE() },
+	"x-amz-checksum-crc32c":    func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+	"x-amz-checksum-crc64nvme": func() hash.Hash { return crc64.New(crc64.MakeTable(0x9a6c9329ac4bc9b5)) },
+	"x-amz-checksum-sha1":      sha1.New,
+	"x-amz-checksum-sha256":    sha256.New,
+}
+
+// decodeChunked replaces the body of an aws-chunked request with its decoded payload
+func decodeChunked(r *http.Request, sig *signature, key []byte) error {
+	length, err := strconv.ParseInt(r.Header.Get(HeaderDecodedContentLength), 10, 64)
+	if err != nil || length < 0 {
+		return ErrDecodedLengthMissing
+	}
+
+	cr := &chunkedReader{
+		r:         bufio.NewReaderSize(r.Body, maxChunkLineSize),
+		body:      r.Body,
+		remaining: length,
+	}
+
+	if sig.payloadHash != StreamingUnsignedPayloadTrailer {
+		cr.signed = true
+		cr.key = key
+		cr.date = sig.date.Format(timeFormat)
+		cr.scope = sig.scope
+		cr.previous = sig.signature
+	}
+
+	if sig.payloadHash != StreamingPayload {
+		cr.trailer = strings.ToLower(strings.TrimSpace(r.Header.Get(HeaderTrailer)))
+		newHash, ok := trailerChecksums[cr.trailer]
+		if !ok {
+			return ErrTrailerNotSupported
+		}
+		cr.checksum = newHash()
+	}
+
+	r.Body = cr
+	r.ContentLength = length
+
+	return nil
+}
+
+// chunkedReader decodes an aws-chunked payload. Chunks are only released once their signature is checked,
+// and the last one once the final chunk and the trailer are checked as well, so that a storage never sees
+// a complete content that fails its verification
+type chunkedReader struct {
+	r    *bufio.Reader
+	body io.ReadCloser
+
+	signed   bool
+	key      []byte
+	date     string
+	scope    string
+	previous string
+
+	trailer  string
+	checksum hash.Hash
+
+	remaining int64
+	pending   []byte
+	finished  bool
+	err       error
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for len(cr.pending) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		cr.err = cr.next()
+	}
+
+	n := copy(p, cr.pending)
+	cr.pending = cr.pending[n:]
+
+	return n, nil
+}
+
+func (cr *chunkedReader) Close() error {
+	return cr.body.Close()
+}
+
+// next reads the next data chunk into pending, io.EOF meaning the whole payload was read and checked
+func (cr *chunkedReader) next() error {
+	if cr.finished {
+		return io.EOF
+	}
+	if cr.remaining == 0 {
+		if err := cr.readFinal(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	size, chunkSignature, err := cr.readChunkHeader()
+	if err != nil {
+		return err
+	}
+	if size == 0 || size > cr.remaining || size > maxChunkSize {
+		return fmt.Errorf("%w: chunk size %d not valid", ErrChunkNotValid, size)
+	}
+
+	data := make([]byte, size)
+	if _, err = io.ReadFull(cr.r, data); err != nil {
+		return fmt.Errorf("%w: %s", ErrChunkNotValid, err)
+	}
+	if err = cr.readCRLF(); err != nil {
+		return err
+	}
+
+	if err = cr.verifyChunk(chunkSignature, data); err != nil {
+		return err
+	}
+	if cr.checksum != nil {
+		cr.checksum.Write(data)
+	}
+
+	cr.remaining -= size
+	if cr.remaining == 0 {
+		if err = cr.readFinal(); err != nil {
+			return err
+		}
+	}
+
+	cr.pending = data
+
+	return nil
+}
+
+// readFinal reads and checks the final empty chunk and the trailer following it
+func (cr *chunkedReader) readFinal() error {
+	size, chunkSignature, err := cr.readChunkHeader()
+	if err != nil {
+		return err
+	}
+	if size != 0 {
+		return fmt.Errorf("%w: payload larger than its decoded length", ErrChunkNotValid)
+	}
+	if err = cr.verifyChunk(chunkSignature, nil); err != nil {
+		return err
+	}
+
+	// without trailer the payload ends with an empty line, which some clients leave out
+	if cr.checksum == nil {
+		line, err := cr.readLine()
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line != "" {
+			return fmt.Errorf("%w: payload not terminated", ErrChunkNotValid)
+		}
+		cr.finished = true
+		return nil
+	}
+
+	if err = cr.readTrailer(); err != nil {
+		return err
+	}
+	cr.finished = true
+
+	return nil
+}
+
+// readTrailer reads the trailer lines up to the empty one, checking the trailing checksum and the trailer signature
+func (cr *chunkedReader) readTrailer() error {
+	var checksum, trailerSignature string
+	var canonical bytes.Buffer
+	for {
+		line, err := cr.readLine()
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// signed trailers end with the signature, some clients separating it from the checksum with an empty line
+		if line == "" && (!cr.signed || trailerSignature != "") {
+			break
+		}
+		if line == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("%w: trailer %q not valid", ErrChunkNotValid, line)
+		}
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+
+		switch name {
+		case "x-amz-trailer-signature":
+			trailerSignature = value
+		case cr.trailer:
+			checksum = value
+			canonical.WriteString(name + ":" + value + "\n")
+		}
+	}
+
+	if cr.signed {
+		hash := sha256.Sum256(canonical.Bytes())
+		expected := cr.sign(trailerAlgorithm, hex.EncodeToString(hash[:]))
+		if !hmac.Equal([]byte(expected), []byte(trailerSignature)) {
+			return ErrSignatureMismatch
+		}
+	}
+
+	if checksum != base64.StdEncoding.EncodeToString(cr.checksum.Sum(nil)) {
+		return ErrTrailerChecksumMismatch
+	}
+
+	return nil
+}
+
+// readChunkHeader reads a "<hex size>;chunk-signature=<signature>" line, the signature being absent from unsigned payloads
+func (cr *chunkedReader) readChunkHeader() (int64, string, error) {
+	line, err := cr.readLine()
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %s", ErrChunkNotValid, err)
+	}
+
+	rawSize, extension, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(rawSize, 16, 64)
+	if err != nil || size < 0 {
+		return 0, "", fmt.Errorf("%w: chunk size %q not valid", ErrChunkNotValid, rawSize)
+	}
+
+	chunkSignature, _ := strings.CutPrefix(extension, "chunk-signature=")
+
+	return size, chunkSignature, nil
+}
+
+// verifyChunk checks the signature of a chunk, chained to the signature of the previous one
+func (cr *chunkedReader) verifyChunk(chunkSignature string, data []byte) error {
+	if !cr.signed {
+		return nil
+	}
+
+	hash := sha256.Sum256(data)
+	expected := cr.sign(chunkAlgorithm, emptySHA256+"\n"+hex.EncodeToString(hash[:]))
+	if !hmac.Equal([]byte(expected), []byte(chunkSignature)) {
+		return ErrSignatureMismatch
+	}
+	cr.previous = expected
+
+	return nil
+}
+
+func (cr *chunkedReader) sign(algorithm, hashes string) string {
+	stringToSign := algorithm + "\n" + cr.date + "\n" + cr.scope + "\n" + cr.previous + "\n" + hashes
+
+	return hex.EncodeToString(hmacSHA256(cr.key, []byte(stringToSign)))
+}
+
+func (cr *chunkedReader) readCRLF() error {
+	line, err := cr.readLine()
+	if err == io.EOF {
+		return fmt.Errorf("%w: %s", ErrChunkNotValid, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return fmt.Errorf("%w: missing CRLF after chunk", ErrChunkNotValid)
+	}
+
+	return nil
+}
+
+// readLine reads a line without its CRLF, failing on lines longer than maxChunkLineSize.
+// io.EOF is only returned when the payload ends right before the line
+func (cr *chunkedReader) readLine() (string, error) {
+	line, err := cr.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("%w: line too long", ErrChunkNotValid)
+	}
+	if err == io.EOF && len(line) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
@@ -0,0 +1,61 @@
+package sigv4
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// verifyPayload replaces the body of a request with a reader checking it against the signed payload hash
+func verifyPayload(r *http.Request, payloadHash string) {
+	expected, _ := hex.DecodeString(payloadHash)
+
+	r.Body = &payloadReader{
+		body:     r.Body,
+		size:     r.ContentLength,
+		expected: expected,
+		hash:     sha256.New(),
+	}
+}
+
+// payloadReader hashes the body read and compares it with the signed payload hash as soon as size bytes have been read,
+// or at the end of the body when its size is unknown. The read completing the body fails on a mismatch,
+// so that a storage never receives the whole of a payload that isn't the signed one
+type payloadReader struct {
+	body     io.ReadCloser
+	size     int64
+	read     int64
+	expected []byte
+	hash     hash.Hash
+	verified bool
+	err      error
+}
+
+func (pr *payloadReader) Read(p []byte) (int, error) {
+	if pr.err != nil {
+		return 0, pr.err
+	}
+
+	n, err := pr.body.Read(p)
+	pr.hash.Write(p[:n])
+	pr.read += int64(n)
+
+	if err == io.EOF || (pr.size >= 0 && pr.read >= pr.size) {
+		if !pr.verified {
+			pr.verified = true
+			if !bytes.Equal(pr.hash.Sum(nil), pr.expected) {
+				pr.err = ErrContentSHA256Mismatch
+				return 0, pr.err
+			}
+		}
+	}
+
+	return n, err
+}
+
+func (pr *payloadReader) Close() error {
+	return pr.body.Close()
+}
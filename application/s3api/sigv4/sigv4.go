@@ -0,0 +1,388 @@
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Algorithm = "AWS4-HMAC-SHA256"
+
+	// Payload hashes standing for a payload that isn't hashed, or that is sent in signed or unsigned aws-chunked encoding
+	UnsignedPayload                 = "UNSIGNED-PAYLOAD"
+	StreamingPayload                = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	StreamingPayloadTrailer         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	StreamingUnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	HeaderContentSHA256        = "X-Amz-Content-Sha256"
+	HeaderDate                 = "X-Amz-Date"
+	HeaderDecodedContentLength = "X-Amz-Decoded-Content-Length"
+	HeaderTrailer              = "X-Amz-Trailer"
+
+	service     = "s3"
+	terminator  = "aws4_request"
+	timeFormat  = "20060102T150405Z"
+	dateFormat  = "20060102"
+	maxSkew     = 15 * time.Minute
+	maxExpires  = 7 * 24 * time.Hour
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+var (
+	ErrMissingAuthentication   = errors.New("request not signed")
+	ErrAuthorizationNotValid   = errors.New("authorization not valid")
+	ErrAccessKeyNotFound       = errors.New("access key not found")
+	ErrSignatureMismatch       = errors.New("signature mismatch")
+	ErrRequestTimeTooSkewed    = errors.New("request time too skewed")
+	ErrRequestExpired          = errors.New("request expired")
+	ErrContentSHA256NotValid   = errors.New("x-amz-content-sha256 not valid")
+	ErrContentSHA256Mismatch   = errors.New("x-amz-content-sha256 doesn't match the payload")
+	ErrDecodedLengthMissing    = errors.New("x-amz-decoded-content-length missing")
+	ErrChunkNotValid           = errors.New("aws-chunked payload not valid")
+	ErrTrailerNotSupported     = errors.New("trailing checksum not supported")
+	ErrTrailerChecksumMismatch = errors.New("trailing checksum mismatch")
+)
+
+type Credentials struct {
+	AccessKey string
+	SecretKey string
+}
+
+// Verifier checks the AWS Signature Version 4 of S3 requests, sent in the Authorization header or in presigned URLs
+type Verifier struct {
+	secrets map[string]string
+	region  string
+	now     func() time.Time
+}
+
+// signature is what a request is signed with
+type signature struct {
+	accessKey     string
+	date          time.Time
+	scope         string
+	region        string
+	signedHeaders []string
+	signature     string
+	payloadHash   string
+	presigned     bool
+}
+
+// NewVerifier creates a new instance of Verifier accepting requests of the given region signed with any of the credentials
+func NewVerifier(region string, credentials ...Credentials) *Verifier {
+	secrets := make(map[string]string, len(credentials))
+	for _, c := range credentials {
+		secrets[c.AccessKey] = c.SecretKey
+	}
+
+	return &Verifier{
+		secrets: secrets,
+		region:  region,
+		now:     time.Now,
+	}
+}
+
+// Verify checks the signature of a request. The body of aws-chunked requests is replaced with the decoded payload,
+// whose chunk signatures and trailing checksum are checked as it is read, and its ContentLength with the decoded one.
+// The body of other requests with a signed payload hash is checked against it as it is read
+func (v *Verifier) Verify(r *http.Request) error {
+	sig, err := parseSignature(r)
+	if err != nil {
+		return err
+	}
+
+	secret, ok := v.secrets[sig.accessKey]
+	if !ok {
+		return ErrAccessKeyNotFound
+	}
+	if sig.region != v.region {
+		return fmt.Errorf("%w: region %s is wrong, expecting %s", ErrAuthorizationNotValid, sig.region, v.region)
+	}
+
+	if err = v.checkTime(r, sig); err != nil {
+		return err
+	}
+
+	key := signingKey(secret, sig.date, sig.region)
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign(sig, canonicalRequest(r, sig))))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return ErrSignatureMismatch
+	}
+
+	switch sig.payloadHash {
+	case UnsignedPayload:
+		return nil
+	case StreamingPayload, StreamingPayloadTrailer, StreamingUnsignedPayloadTrailer:
+		return decodeChunked(r, sig, key)
+	}
+
+	if _, err = hex.DecodeString(sig.payloadHash); err != nil || len(sig.payloadHash) != 2*sha256.Size {
+		return ErrContentSHA256NotValid
+	}
+	verifyPayload(r, sig.payloadHash)
+
+	return nil
+}
+
+// checkTime fails when a request is too far from now, or when its presigned URL expired
+func (v *Verifier) checkTime(r *http.Request, sig *signature) error {
+	now := v.now()
+
+	if !sig.presigned {
+		if now.Sub(sig.date).Abs() > maxSkew {
+			return ErrRequestTimeTooSkewed
+		}
+		return nil
+	}
+
+	expires, err := strconv.Atoi(r.URL.Query().Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxExpires {
+		return fmt.Errorf("%w: X-Amz-Expires must be between 0 and 604800 seconds", ErrAuthorizationNotValid)
+	}
+
+	if sig.date.Sub(now) > maxSkew {
+		return ErrRequestTimeTooSkewed
+	}
+	if now.After(sig.date.Add(time.Duration(expires) * time.Second)) {
+		return ErrRequestExpired
+	}
+
+	return nil
+}
+
+// parseSignature reads the signature of a request from its Authorization header or from its presigned URL query
+func parseSignature(r *http.Request) (*signature, error) {
+	query := r.URL.Query()
+
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sig, err := parseAuthorization(auth)
+		if err != nil {
+			return nil, err
+		}
+
+		rawDate := r.Header.Get(HeaderDate)
+		if rawDate == "" {
+			return nil, fmt.Errorf("%w: missing %s header", ErrAuthorizationNotValid, HeaderDate)
+		}
+		if sig.date, err = time.Parse(timeFormat, rawDate); err != nil {
+			return nil, fmt.Errorf("%w: %s not valid", ErrAuthorizationNotValid, HeaderDate)
+		}
+
+		if sig.payloadHash = r.Header.Get(HeaderContentSHA256); sig.payloadHash == "" {
+			return nil, ErrContentSHA256NotValid
+		}
+
+		return sig, checkScope(sig)
+	}
+
+	if query.Has("X-Amz-Signature") {
+		if query.Get("X-Amz-Algorithm") != Algorithm {
+			return nil, fmt.Errorf("%w: unsupported algorithm", ErrAuthorizationNotValid)
+		}
+
+		sig := &signature{
+			signature:     query.Get("X-Amz-Signature"),
+			signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+			payloadHash:   UnsignedPayload,
+			presigned:     true,
+		}
+		if err := parseCredential(sig, query.Get("X-Amz-Credential")); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if sig.date, err = time.Parse(timeFormat, query.Get("X-Amz-Date")); err != nil {
+			return nil, fmt.Errorf("%w: X-Amz-Date not valid", ErrAuthorizationNotValid)
+		}
+
+		if hash := query.Get("X-Amz-Content-Sha256"); hash != "" {
+			sig.payloadHash = hash
+		} else if hash = r.Header.Get(HeaderContentSHA256); hash != "" {
+			sig.payloadHash = hash
+		}
+
+		return sig, checkScope(sig)
+	}
+
+	return nil, ErrMissingAuthentication
+}
+
+// parseAuthorization parses an "AWS4-HMAC-SHA256 Credential=..., SignedHeaders=..., Signature=..." header
+func parseAuthorization(auth string) (*signature, error) {
+	algorithm, fields, ok := strings.Cut(auth, " ")
+	if !ok || algorithm != Algorithm {
+		return nil, fmt.Errorf("%w: unsupported algorithm", ErrAuthorizationNotValid)
+	}
+
+	sig := &signature{}
+	var credential string
+	for _, field := range strings.Split(fields, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "Credential":
+			credential = value
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			sig.signature = value
+		}
+	}
+
+	if credential == "" || len(sig.signedHeaders) == 0 || sig.signature == "" {
+		return nil, fmt.Errorf("%w: missing Credential, SignedHeaders or Signature", ErrAuthorizationNotValid)
+	}
+
+	return sig, parseCredential(sig, credential)
+}
+
+// parseCredential parses a "<access key>/<date>/<region>/s3/aws4_request" credential
+func parseCredential(sig *signature, credential string) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) < 5 || parts[len(parts)-2] != service || parts[len(parts)-1] != terminator {
+		return fmt.Errorf("%w: credential not valid", ErrAuthorizationNotValid)
+	}
+
+	sig.accessKey = strings.Join(parts[:len(parts)-4], "/")
+	sig.region = parts[len(parts)-3]
+	sig.scope = strings.Join(parts[len(parts)-4:], "/")
+
+	return nil
+}
+
+// checkScope fails when the credential scope isn't the one of the request date, or when the host isn't signed
+func checkScope(sig *signature) error {
+	if !strings.HasPrefix(sig.scope, sig.date.Format(dateFormat)+"/") {
+		return fmt.Errorf("%w: credential date doesn't match the request date", ErrAuthorizationNotValid)
+	}
+
+	for _, name := range sig.signedHeaders {
+		if name == "host" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: host header not signed", ErrAuthorizationNotValid)
+}
+
+func canonicalRequest(r *http.Request, sig *signature) string {
+	var b strings.Builder
+
+	b.WriteString(r.Method)
+	b.WriteByte('\n')
+
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(uriEncode(path, false))
+	b.WriteByte('\n')
+
+	b.WriteString(canonicalQuery(r.URL.Query()))
+	b.WriteByte('\n')
+
+	for _, name := range sig.signedHeaders {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(canonicalHeaderValue(r, name))
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+
+	b.WriteString(strings.Join(sig.signedHeaders, ";"))
+	b.WriteByte('\n')
+
+	b.WriteString(sig.payloadHash)
+
+	return b.String()
+}
+
+// canonicalQuery sorts the query parameters by name then value, the signature of presigned URLs excepted
+func canonicalQuery(query url.Values) string {
+	params := make([]string, 0, len(query))
+	for name, values := range query {
+		if name == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+
+	return strings.Join(params, "&")
+}
+
+// canonicalHeaderValue returns the trimmed values of a header, the ones Go moves out of the header map included
+func canonicalHeaderValue(r *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{r.Host}
+	case "content-length":
+		if r.ContentLength >= 0 {
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		}
+	case "transfer-encoding":
+		values = r.TransferEncoding
+	default:
+		values = r.Header.Values(name)
+	}
+
+	// the values are shared with the request, so the trimmed ones are collected in a copy
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.Join(strings.Fields(value), " ")
+	}
+
+	return strings.Join(trimmed, ",")
+}
+
+func stringToSign(sig *signature, canonical string) []byte {
+	hash := sha256.Sum256([]byte(canonical))
+
+	return []byte(Algorithm + "\n" + sig.date.Format(timeFormat) + "\n" + sig.scope + "\n" + hex.EncodeToString(hash[:]))
+}
+
+func signingKey(secret string, date time.Time, region string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), []byte(date.Format(dateFormat)))
+	key = hmacSHA256(key, []byte(region))
+	key = hmacSHA256(key, []byte(service))
+
+	return hmacSHA256(key, []byte(terminator))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, and slashes when encodeSlash is false
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0x0f])
+		}
+	}
+
+	return b.String()
+}
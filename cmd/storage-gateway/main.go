@@ -4,19 +4,28 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"net/http"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"storage-gateway/application/api"
+	"storage-gateway/application/s3api"
 	"storage-gateway/config"
+	"storage-gateway/domain/ports"
 	"storage-gateway/domain/services"
 	"storage-gateway/infrastructure/discovery-service"
+	"storage-gateway/infrastructure/kms"
+	"storage-gateway/infrastructure/object-storage"
 	"storage-gateway/internal/log"
 )
 
 func main() {
 	configFile := flag.String("conf", "config/config.local.json", "Config file path")
+	backend := flag.String("backend", "", `Object storage backend, "memory" runs in-memory nodes instead of the configured discovery`)
+	memoryNodes := flag.Int("memory-nodes", 3, "Number of in-memory nodes of the memory backend")
+	memoryCapacity := flag.Int64("memory-capacity", 0, "Capacity in bytes of every in-memory node, unlimited when 0")
 	flag.Parse()
 
 	shutdownCtx, cancel := signal.NotifyContext(context.Background(), syscall.SIGQUIT, syscall.SIGINT, syscall.SIGTERM)
@@ -29,26 +38,296 @@ func main() {
 
 	log.SetupLogging(appConfig.App.LogLevel)
 
-	dds, err := discovery_service.NewDockerDiscoveryService()
+	var ds ports.DiscoveryService
+	switch *backend {
+	case "":
+		ds, err = newDiscoveryService(appConfig.Discovery)
+	case "memory":
+		ds = newMemoryDiscoveryService(*memoryNodes, *memoryCapacity)
+	default:
+		err = fmt.Errorf("unknown backend %q", *backend)
+	}
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	nps := services.NewNodePoolService(dds)
+	if appConfig.Encryption.Enabled {
+		keys, err := kms.NewKeyFileKMS(appConfig.Encryption.KeyFile)
+		if err != nil {
+			log.Fatalf("could not load encryption keys with error %s", err)
+		}
+		ds = services.NewEncryptedDiscoveryService(ds, keys, appConfig.Encryption.ChunkSizeInBytes)
+	}
+
+	hash, err := services.NewHashFunc(appConfig.Ring.HashFunction)
+	if err != nil {
+		log.Fatalf("could not create ring hash function with error %s", err)
+	}
+
+	nps := services.NewNodePoolService(ds, services.RingOptions{
+		VirtualNodes: appConfig.Ring.VirtualNodes,
+		Hash:         hash,
+	})
+
+	var handoff, hints *services.HintedHandoffService
+	var rbs *services.RebalanceService
+	if appConfig.Erasure.Enabled {
+		if appConfig.Failover.Enabled || appConfig.Rebalance.Enabled {
+			log.Warn("failover and rebalance don't apply to erasure coded objects, they stay disabled")
+		}
+	} else {
+		// hints replay the deletes missed by offline replicas, and with failover the writes handed off to their successors
+		hints, err = services.NewHintedHandoffService(nps, services.HintedHandoffOptions{
+			ReplayInterval: time.Duration(appConfig.Failover.HintReplayIntervalInSeconds) * time.Second,
+			HintsFile:      appConfig.Failover.HintsFile,
+		})
+		if err != nil {
+			log.Fatalf("could not create hinted handoff service with error %s", err)
+		}
+		if appConfig.Failover.Enabled {
+			handoff = hints
+		}
+
+		if appConfig.Rebalance.Enabled {
+			rbs, err = services.NewRebalanceService(nps, services.RebalanceOptions{
+				Replicas:         appConfig.Replication.Replicas,
+				ObjectsPerSecond: appConfig.Rebalance.ObjectsPerSecond,
+				StateFile:        appConfig.Rebalance.StateFile,
+			})
+			if err != nil {
+				log.Fatalf("could not create rebalance service with error %s", err)
+			}
+			nps.SetRingChangeListener(rbs)
+		}
+	}
+
+	var krs *services.KeyRotationService
+	if appConfig.Encryption.Enabled {
+		krs = services.NewKeyRotationService(nps, time.Duration(appConfig.Encryption.RewrapIntervalInSeconds)*time.Second)
+	}
+
+	var storage ports.ObjectStorage
+	var replicated *services.ReplicatedStorage
+	var ers *services.ErasureRepairService
+	if appConfig.Erasure.Enabled {
+		erasure, err := services.NewErasureStorage(nps, services.ErasureOptions{
+			DataShards:   appConfig.Erasure.DataShards,
+			ParityShards: appConfig.Erasure.ParityShards,
+			WriteQuorum:  appConfig.Erasure.WriteQuorum,
+			ChunkSize:    appConfig.Erasure.ChunkSizeInBytes,
+			SpoolDir:     appConfig.Erasure.SpoolDir,
+		})
+		if err != nil {
+			log.Fatalf("could not create erasure coded storage with error %s", err)
+		}
+		storage = erasure
+		ers = services.NewErasureRepairService(erasure, time.Duration(appConfig.Erasure.RepairIntervalInSeconds)*time.Second)
+	} else {
+		replicated, err = services.NewReplicatedStorage(nps, services.ReplicationOptions{
+			Replicas:    appConfig.Replication.Replicas,
+			WriteQuorum: appConfig.Replication.WriteQuorum,
+			ReadQuorum:  appConfig.Replication.ReadQuorum,
+			Handoff:     handoff,
+			Hints:       hints,
+			Rebalance:   rbs,
+		})
+		if err != nil {
+			log.Fatalf("could not create replicated storage with error %s", err)
+		}
+		storage = replicated
+	}
+
+	objectStorage := storage
+	if appConfig.Compression.Enabled {
+		objectStorage, err = services.NewCompressedStorage(storage, services.CompressionOptions{
+			Rules:   compressionRules(appConfig.Compression.Rules),
+			MinSize: appConfig.Compression.MinSizeInBytes,
+		})
+		if err != nil {
+			log.Fatalf("could not create compressed storage with error %s", err)
+		}
+	}
+
+	var gcs *services.GarbageCollectionService
+	if appConfig.Dedup.Enabled {
+		dedup := services.NewDedupStorage(objectStorage, services.DedupOptions{
+			SpoolDir:    appConfig.Dedup.SpoolDir,
+			GracePeriod: time.Duration(appConfig.Dedup.GCGracePeriodInSeconds) * time.Second,
+		})
+		objectStorage = dedup
+		gcs = services.NewGarbageCollectionService(dedup, time.Duration(appConfig.Dedup.GCIntervalInSeconds)*time.Second)
+	}
+
+	var mus *services.MultipartUploadService
+	var mjs *services.MultipartJanitorService
+	if appConfig.Multipart.Enabled {
+		switch {
+		case appConfig.Erasure.Enabled:
+			log.Warn("multipart uploads don't apply to erasure coded objects, they stay disabled")
+		case appConfig.Compression.Enabled || appConfig.Dedup.Enabled:
+			// completed uploads are assembled by the nodes, which would store them neither compressed nor deduplicated
+			log.Warn("multipart uploads don't apply to compressed or deduplicated objects, they stay disabled")
+		default:
+			mus = services.NewMultipartUploadService(nps, replicated, appConfig.Api.MaxObjectSizeInBytes)
+			mjs = services.NewMultipartJanitorService(
+				mus,
+				time.Duration(appConfig.Multipart.JanitorIntervalInSeconds)*time.Second,
+				time.Duration(appConfig.Multipart.UploadTTLInSeconds)*time.Second,
+			)
+		}
+	}
 
 	go func() {
-		if err = nps.StartRefreshingNodes(); err != nil {
+		if err = nps.StartRefreshingNodes(time.Duration(appConfig.Discovery.ResyncIntervalInSeconds) * time.Second); err != nil {
 			log.Fatalf("could not start refresh nodes scheduler with error %s", err)
 		}
 	}()
 
-	gateway := api.NewApi(nps, *appConfig)
+	if hints != nil {
+		if err = hints.StartReplayingHints(); err != nil {
+			log.Fatalf("could not start hint replay scheduler with error %s", err)
+		}
+	}
+
+	if krs != nil {
+		if err = krs.StartRewrapping(); err != nil {
+			log.Fatalf("could not start key rotation scheduler with error %s", err)
+		}
+	}
+
+	if gcs != nil {
+		if err = gcs.StartCollecting(); err != nil {
+			log.Fatalf("could not start garbage collection scheduler with error %s", err)
+		}
+	}
+
+	if ers != nil {
+		if err = ers.StartRepairing(); err != nil {
+			log.Fatalf("could not start erasure repair scheduler with error %s", err)
+		}
+	}
+
+	if mjs != nil {
+		if err = mjs.StartCleaning(); err != nil {
+			log.Fatalf("could not start multipart janitor scheduler with error %s", err)
+		}
+	}
+
+	gateway := api.NewApi(nps, objectStorage, rbs, mus, *appConfig)
 
 	go runApiHandler(gateway)
 
+	var s3Gateway *s3api.S3API
+	if appConfig.S3Api.Enabled {
+		if appConfig.S3Api.AccessKey == "" || appConfig.S3Api.SecretKey == "" {
+			log.Fatal("the S3 API needs an access key and a secret key")
+		}
+		s3Gateway = s3api.NewS3Api(nps, objectStorage, mus, *appConfig)
+		go runS3ApiHandler(s3Gateway)
+	}
+
 	<-shutdownCtx.Done()
 	gateway.Shutdown()
+	if s3Gateway != nil {
+		s3Gateway.Shutdown()
+	}
 	nps.StopRefreshingNodes()
+	if hints != nil {
+		hints.StopReplayingHints()
+	}
+	if rbs != nil {
+		rbs.Stop()
+	}
+	if krs != nil {
+		krs.StopRewrapping()
+	}
+	if gcs != nil {
+		gcs.StopCollecting()
+	}
+	if ers != nil {
+		ers.StopRepairing()
+	}
+	if mjs != nil {
+		mjs.StopCleaning()
+	}
+}
+
+// newMemoryDiscoveryService creates a discovery service returning in-memory nodes, so the gateway runs without any container
+func newMemoryDiscoveryService(count int, capacity int64) ports.DiscoveryService {
+	nodes := make([]ports.ObjectStorage, 0, count)
+	for i := 1; i <= count; i++ {
+		nodes = append(nodes, object_storage.NewMemoryObjectStore(fmt.Sprintf("memory-node-%d", i), capacity))
+	}
+
+	return discovery_service.NewMemoryDiscoveryService(nodes...)
+}
+
+func compressionRules(cfg []config.CompressionRule) []services.CompressionRule {
+	rules := make([]services.CompressionRule, 0, len(cfg))
+	for _, rule := range cfg {
+		rules = append(rules, services.CompressionRule{ContentType: rule.ContentType, Codec: rule.Codec})
+	}
+
+	return rules
+}
+
+// s3NodeConfig returns the S3 configuration shared by the nodes of the discovery services that don't describe each node
+func s3NodeConfig(cfg config.S3Node) object_storage.S3NodeConfig {
+	return object_storage.S3NodeConfig{
+		Bucket:       cfg.Bucket,
+		Region:       cfg.Region,
+		Secure:       cfg.Secure,
+		CAFile:       cfg.CAFile,
+		BucketLookup: cfg.BucketLookup,
+		Credentials: object_storage.S3Credentials{
+			Provider: cfg.CredentialsProvider,
+			File:     cfg.CredentialsFile,
+			Profile:  cfg.CredentialsProfile,
+		},
+	}
+}
+
+// newDiscoveryService creates the discovery service selected in the configuration
+func newDiscoveryService(cfg config.Discovery) (ports.DiscoveryService, error) {
+	node := s3NodeConfig(cfg.S3)
+
+	switch cfg.Type {
+	case "", "docker":
+		return discovery_service.NewDockerDiscoveryService(discovery_service.DockerOptions{
+			NameFilter:   cfg.Docker.NameFilter,
+			Network:      cfg.Docker.Network,
+			Port:         cfg.Docker.Port,
+			AccessKeyEnv: cfg.Docker.AccessKeyEnv,
+			SecretKeyEnv: cfg.Docker.SecretKeyEnv,
+			Node:         node,
+		})
+	case "file":
+		return discovery_service.NewFileDiscoveryService(cfg.File.Path, time.Duration(cfg.File.WatchIntervalInSeconds)*time.Second)
+	case "dns":
+		node.Credentials.AccessKey, node.Credentials.SecretKey = cfg.DNS.AccessKey, cfg.DNS.SecretKey
+		return discovery_service.NewDNSDiscoveryService(
+			discovery_service.NewDNSResolver(cfg.DNS.Server),
+			cfg.DNS.Service, cfg.DNS.Proto, cfg.DNS.Name,
+			node,
+			cfg.DNS.SecretsFile,
+		)
+	case "kubernetes":
+		client, err := discovery_service.NewKubernetesClient(cfg.Kubernetes.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return discovery_service.NewKubernetesDiscoveryService(client, discovery_service.KubernetesOptions{
+			Namespace:      cfg.Kubernetes.Namespace,
+			LabelSelector:  cfg.Kubernetes.LabelSelector,
+			PortName:       cfg.Kubernetes.PortName,
+			SecretName:     cfg.Kubernetes.SecretName,
+			AccessKeyField: cfg.Kubernetes.AccessKeyField,
+			SecretKeyField: cfg.Kubernetes.SecretKeyField,
+			Node:           node,
+		})
+	default:
+		return nil, fmt.Errorf("unknown discovery type %q", cfg.Type)
+	}
 }
 
 func runApiHandler(gateway *api.API) {
@@ -56,3 +335,9 @@ func runApiHandler(gateway *api.API) {
 		log.Fatalf("could not start API server with error %s", err)
 	}
 }
+
+func runS3ApiHandler(gateway *s3api.S3API) {
+	if err := gateway.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("could not start S3 API server with error %s", err)
+	}
+}
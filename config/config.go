@@ -8,9 +8,20 @@ import (
 )
 
 type Config struct {
-	App  App
-	Api  Api
-	Http Http
+	App         App
+	Api         Api
+	Http        Http
+	Ring        Ring
+	Replication Replication
+	Failover    Failover
+	Rebalance   Rebalance
+	Discovery   Discovery
+	Encryption  Encryption
+	Compression Compression
+	Dedup       Dedup
+	Erasure     Erasure
+	Multipart   Multipart
+	S3Api       S3Api
 }
 
 type App struct {
@@ -23,6 +34,9 @@ type Api struct {
 	Port                       int
 	TimeoutInSeconds           int
 	ReadHeaderTimeoutInSeconds int
+	MaxObjectSizeInBytes       int64
+	// VerifyDigestsOnRead checks full reads against the digests stored on upload, cutting corrupted responses short
+	VerifyDigestsOnRead bool
 }
 
 type Http struct {
@@ -32,6 +46,152 @@ type Http struct {
 	TimeoutInSeconds    int
 }
 
+type Ring struct {
+	VirtualNodes int
+	HashFunction string
+}
+
+type Replication struct {
+	Replicas    int
+	WriteQuorum int
+	ReadQuorum  int
+}
+
+type Failover struct {
+	Enabled                     bool
+	HintReplayIntervalInSeconds int
+	HintsFile                   string
+}
+
+type Rebalance struct {
+	Enabled          bool
+	ObjectsPerSecond float64
+	StateFile        string
+}
+
+type Discovery struct {
+	// Type selects the discovery service, "docker" (default), "file", "dns" or "kubernetes"
+	Type string
+	// ResyncIntervalInSeconds is the interval of the full node refreshes, which back up the watched membership changes
+	ResyncIntervalInSeconds int
+	// S3 is the configuration shared by the nodes found with the docker, dns and kubernetes discovery
+	S3         S3Node
+	Docker     DockerDiscovery
+	File       FileDiscovery
+	DNS        DNSDiscovery
+	Kubernetes KubernetesDiscovery
+}
+
+type S3Node struct {
+	Bucket       string
+	Region       string
+	Secure       bool
+	CAFile       string
+	BucketLookup string
+	// CredentialsProvider is "static" (default), "env", "file", "iam" or "chain",
+	// static credentials being discovered along with the nodes
+	CredentialsProvider string
+	CredentialsFile     string
+	CredentialsProfile  string
+}
+
+// DockerDiscovery holds the values used for containers that don't set them with storage-gateway labels
+type DockerDiscovery struct {
+	NameFilter   string
+	Network      string
+	Port         string
+	AccessKeyEnv string
+	SecretKeyEnv string
+}
+
+type FileDiscovery struct {
+	Path                   string
+	WatchIntervalInSeconds int
+}
+
+type DNSDiscovery struct {
+	Service     string
+	Proto       string
+	Name        string
+	Server      string
+	AccessKey   string
+	SecretKey   string
+	SecretsFile string
+}
+
+type KubernetesDiscovery struct {
+	// Kubeconfig is the path of the kubeconfig file, the in-cluster configuration being used when empty
+	Kubeconfig     string
+	Namespace      string
+	LabelSelector  string
+	PortName       string
+	SecretName     string
+	AccessKeyField string
+	SecretKeyField string
+}
+
+// Encryption encrypts the objects of every node at rest with data keys wrapped by the master keys of KeyFile
+type Encryption struct {
+	Enabled                 bool
+	KeyFile                 string
+	ChunkSizeInBytes        int
+	RewrapIntervalInSeconds int
+}
+
+// Compression stores objects compressed with the codec of the first rule matching their content type
+type Compression struct {
+	Enabled        bool
+	MinSizeInBytes int64
+	Rules          []CompressionRule
+}
+
+type CompressionRule struct {
+	// ContentType is a media type, text/* matching every text type and * matching anything
+	ContentType string
+	// Codec is "zstd", "gzip" or "none"
+	Codec string
+}
+
+// Dedup stores every distinct content once, objects pointing at the blob of their content
+type Dedup struct {
+	Enabled bool
+	// SpoolDir holds the uploads being hashed, the system temporary directory when empty
+	SpoolDir               string
+	GCIntervalInSeconds    int
+	GCGracePeriodInSeconds int
+}
+
+// Erasure splits objects into Reed-Solomon data and parity shards instead of replicating them
+type Erasure struct {
+	Enabled      bool
+	DataShards   int
+	ParityShards int
+	// WriteQuorum is the number of shards a write must store, DataShards+1 when 0
+	WriteQuorum      int
+	ChunkSizeInBytes int
+	// SpoolDir holds the uploads of unknown size, the system temporary directory when empty
+	SpoolDir                string
+	RepairIntervalInSeconds int
+}
+
+// Multipart lets clients upload objects in parts, unfinished uploads being aborted after UploadTTLInSeconds
+type Multipart struct {
+	Enabled                  bool
+	UploadTTLInSeconds       int
+	JanitorIntervalInSeconds int
+}
+
+// S3Api serves the whole pool as a single S3 bucket on its own listener, requests being signed with AccessKey and SecretKey
+type S3Api struct {
+	Enabled   bool
+	Host      string
+	Port      int
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
 func Read(filename string) (*Config, error) {
 	var config Config
 
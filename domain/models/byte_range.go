@@ -0,0 +1,88 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+const byteRangeUnit = "bytes="
+
+// ByteRange is an inclusive range of bytes within an object content.
+// A negative Start selects the last End bytes, and a negative End reads until the end of the content
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// ParseByteRange parses a single range of an HTTP Range header such as "bytes=0-99", "bytes=100-" or "bytes=-100".
+// It reports false for malformed or multi-range values, which callers should answer with the full content
+func ParseByteRange(header string) (*ByteRange, bool) {
+	if !strings.HasPrefix(header, byteRangeUnit) {
+		return nil, false
+	}
+
+	spec := strings.TrimSpace(strings.TrimPrefix(header, byteRangeUnit))
+	if strings.Contains(spec, ",") {
+		return nil, false
+	}
+
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		return nil, false
+	}
+
+	if startStr == "" {
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix < 0 {
+			return nil, false
+		}
+		return &ByteRange{Start: -1, End: suffix}, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return nil, false
+	}
+
+	if endStr == "" {
+		return &ByteRange{Start: start, End: -1}, true
+	}
+
+	end, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil || end < start {
+		return nil, false
+	}
+
+	return &ByteRange{Start: start, End: end}, true
+}
+
+// Resolve turns the range into absolute offsets within content of the given size,
+// returning ErrRangeNotSatisfiable when no byte of the content is selected
+func (r ByteRange) Resolve(size int64) (ByteRange, error) {
+	if r.Start < 0 {
+		if r.End == 0 || size == 0 {
+			return ByteRange{}, ErrRangeNotSatisfiable
+		}
+		suffix := r.End
+		if suffix > size {
+			suffix = size
+		}
+		return ByteRange{Start: size - suffix, End: size - 1}, nil
+	}
+
+	if r.Start >= size {
+		return ByteRange{}, ErrRangeNotSatisfiable
+	}
+
+	end := r.End
+	if end < 0 || end >= size {
+		end = size - 1
+	}
+
+	return ByteRange{Start: r.Start, End: end}, nil
+}
+
+// Length returns the number of bytes covered by an absolute range
+func (r ByteRange) Length() int64 {
+	return r.End - r.Start + 1
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Metadata keys of the object digests, stored hex encoded.
+// Keys are canonical header names so that they round-trip through S3 user metadata unchanged
+const (
+	MetadataSHA256 = "Checksum-Sha256"
+	MetadataMD5    = "Content-Md5"
+)
+
+// digestSizes are the byte sizes of the supported digests
+var digestSizes = map[string]int{
+	MetadataSHA256: sha256.Size,
+	MetadataMD5:    md5.Size,
+}
+
+// ParseDigest decodes a base64 or hex encoded digest of the given metadata key
+func ParseDigest(key, value string) ([]byte, error) {
+	size, ok := digestSizes[key]
+	if !ok {
+		return nil, ErrDigestNotValid
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+
+	if decoded, err := hex.DecodeString(value); err == nil && len(decoded) == size {
+		return decoded, nil
+	}
+
+	return nil, ErrDigestNotValid
+}
+
+// Digests returns the decoded digests stored in the object metadata
+func (o *Object) Digests() map[string][]byte {
+	digests := make(map[string][]byte)
+	for key := range digestSizes {
+		value, ok := o.Metadata[key]
+		if !ok {
+			continue
+		}
+
+		if decoded, err := ParseDigest(key, value); err == nil {
+			digests[key] = decoded
+		}
+	}
+
+	return digests
+}
+
+// DigestETag returns the strongest digest of the object as its entity tag, the storage one when the object has no digest
+func (o *Object) DigestETag() string {
+	digests := o.Digests()
+	if digest, ok := digests[MetadataSHA256]; ok {
+		return hex.EncodeToString(digest)
+	}
+	if digest, ok := digests[MetadataMD5]; ok {
+		return hex.EncodeToString(digest)
+	}
+
+	return o.ETag
+}
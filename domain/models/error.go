@@ -14,18 +14,61 @@ type (
 	ErrNotAvailable struct {
 		value string
 	}
+
+	ErrTooLarge struct {
+		value string
+	}
+
+	ErrNotSatisfiable struct {
+		value string
+	}
+
+	ErrTooSmall struct {
+		value string
+	}
+
+	ErrNotSupported struct {
+		value string
+	}
+
+	ErrModified struct {
+		value string
+	}
 )
 
 const (
 	object        = "object"
 	objectStorage = "object storage"
 	objectID      = "object ID"
+	byteRange     = "range"
+	listCursor    = "cursor"
+	listLimit     = "limit"
+	digest        = "digest"
+	objectContent = "object content"
+	upload        = "upload"
+	part          = "part"
+	partLength    = "part length"
+	multipart     = "multipart upload"
+	metadata      = "metadata replacement"
 )
 
 var (
 	ErrObjectNotFound            = NewErrNotFound(object)
 	ErrObjectIDNotValid          = NewErrObjectIDNotValid(objectID)
 	ErrObjectStorageNotAvailable = NewErrObjectStorageNotAvailable(objectStorage)
+	ErrObjectTooLarge            = NewErrObjectTooLarge(object)
+	ErrRangeNotSatisfiable       = NewErrRangeNotSatisfiable(byteRange)
+	ErrCursorNotValid            = NewErrListingNotValid(listCursor)
+	ErrLimitNotValid             = NewErrListingNotValid(listLimit)
+	ErrDigestNotValid            = NewErrDigestNotValid(digest)
+	ErrDigestMismatch            = NewErrDigestNotValid(objectContent)
+	ErrUploadNotFound            = NewErrNotFound(upload)
+	ErrPartNotValid              = NewErrPartNotValid(part)
+	ErrPartLengthNotValid        = NewErrPartNotValid(partLength)
+	ErrPartTooSmall              = NewErrPartTooSmall(part)
+	ErrMultipartNotSupported     = NewErrNotSupported(multipart)
+	ErrMetadataNotSupported      = NewErrNotSupported(metadata)
+	ErrObjectModified            = NewErrModified(object)
 )
 
 func NewErrNotFound(value string) *ErrNotFound {
@@ -44,6 +87,18 @@ func (err ErrNotValid) Error() string {
 	return fmt.Sprintf("%s not valid", err.value)
 }
 
+func NewErrListingNotValid(value string) *ErrNotValid {
+	return &ErrNotValid{value}
+}
+
+func NewErrDigestNotValid(value string) *ErrNotValid {
+	return &ErrNotValid{value}
+}
+
+func NewErrPartNotValid(value string) *ErrNotValid {
+	return &ErrNotValid{value}
+}
+
 func NewErrObjectStorageNotAvailable(value string) *ErrNotAvailable {
 	return &ErrNotAvailable{value}
 }
@@ -51,3 +106,43 @@ func NewErrObjectStorageNotAvailable(value string) *ErrNotAvailable {
 func (err ErrNotAvailable) Error() string {
 	return fmt.Sprintf("%s not available", err.value)
 }
+
+func NewErrObjectTooLarge(value string) *ErrTooLarge {
+	return &ErrTooLarge{value}
+}
+
+func (err ErrTooLarge) Error() string {
+	return fmt.Sprintf("%s too large", err.value)
+}
+
+func NewErrRangeNotSatisfiable(value string) *ErrNotSatisfiable {
+	return &ErrNotSatisfiable{value}
+}
+
+func (err ErrNotSatisfiable) Error() string {
+	return fmt.Sprintf("%s not satisfiable", err.value)
+}
+
+func NewErrPartTooSmall(value string) *ErrTooSmall {
+	return &ErrTooSmall{value}
+}
+
+func (err ErrTooSmall) Error() string {
+	return fmt.Sprintf("%s too small", err.value)
+}
+
+func NewErrNotSupported(value string) *ErrNotSupported {
+	return &ErrNotSupported{value}
+}
+
+func (err ErrNotSupported) Error() string {
+	return fmt.Sprintf("%s not supported", err.value)
+}
+
+func NewErrModified(value string) *ErrModified {
+	return &ErrModified{value}
+}
+
+func (err ErrModified) Error() string {
+	return fmt.Sprintf("%s modified", err.value)
+}
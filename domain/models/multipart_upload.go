@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+const (
+	// MinPartSize is the minimum size of every part of a multipart upload but the last one
+	MinPartSize = 5 << 20
+	// MaxPartNumber is the highest part number of a multipart upload, part numbers starting at 1
+	MaxPartNumber = 10000
+)
+
+// MultipartUpload is an upload in progress whose object is assembled from parts uploaded separately
+type MultipartUpload struct {
+	ID        ObjectID
+	UploadID  string
+	Initiated time.Time
+}
+
+// Part is a part of a multipart upload. Size and LastModified are only set on the parts returned by storages
+type Part struct {
+	Number       int
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// IsValidPartNumber tells whether number can number a part of a multipart upload
+func IsValidPartNumber(number int) bool {
+	return number >= 1 && number <= MaxPartNumber
+}
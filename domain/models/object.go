@@ -2,11 +2,20 @@ package models
 
 import (
 	"io"
+	"time"
 )
 
 type Object struct {
-	ID          ObjectID
-	Content     io.Reader
-	ContentType string
-	Size        int64
+	ID           ObjectID
+	Content      io.Reader
+	ContentType  string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	// Range is set when Content only carries a part of the object, Size still being the full object size
+	Range *ByteRange
+	// Metadata is persisted along with the object, such as its digests under MetadataSHA256 and MetadataMD5
+	Metadata map[string]string
+	// ContentEncoding is the content coding Content is encoded with when it isn't returned decoded, Size then being the encoded size
+	ContentEncoding string
 }
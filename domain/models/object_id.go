@@ -1,11 +1,46 @@
 package models
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxKeyLength is the maximum length in bytes of an object key, like in S3
+	MaxKeyLength = 1024
+	// reservedKeyPrefix starts the keys of the objects storages keep for themselves, such as deduplicated blobs
+	reservedKeyPrefix = "~"
+)
+
+var validID = regexp.MustCompile(`^[a-zA-Z0-9]{1,32}$`)
 
 type ObjectID string
 
+// IsValidID tells whether the ID follows the object ID rules of the gateway API, up to 32 alphanumeric characters
 func (id ObjectID) IsValidID() bool {
-	return regexp.MustCompile(`^[a-zA-Z0-9]{1,32}$`).MatchString(id.Value())
+	return validID.MatchString(id.Value())
+}
+
+// IsValidKey tells whether the ID can be stored, which is the case of S3 keys of up to MaxKeyLength bytes of UTF-8
+// without control characters, except the "." and ".." path segments and keys starting with the reserved prefix "~".
+// Every valid ID is a valid key
+func (id ObjectID) IsValidKey() bool {
+	key := id.Value()
+	if key == "" || len(key) > MaxKeyLength || key == "." || key == ".." || strings.HasPrefix(key, reservedKeyPrefix) {
+		return false
+	}
+	if !utf8.ValidString(key) {
+		return false
+	}
+
+	for _, r := range key {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (id ObjectID) Value() string {
@@ -0,0 +1,8 @@
+package models
+
+// ObjectList is a page of listed objects.
+// NextCursor is empty once the listing is complete
+type ObjectList struct {
+	Objects    []*Object
+	NextCursor string
+}
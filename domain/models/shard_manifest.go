@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Metadata keys of the shard manifest carried by every shard of an erasure coded object
+const (
+	MetadataErasureLayout    = "Erasure-Layout"
+	MetadataErasureChunkSize = "Erasure-Chunk-Size"
+	MetadataErasureSize      = "Erasure-Size"
+	MetadataErasureIndex     = "Erasure-Index"
+	MetadataErasureVersion   = "Erasure-Version"
+	MetadataErasureNodes     = "Erasure-Nodes"
+)
+
+// ChecksumSize is the size of the CRC-32C following every chunk of a shard
+const ChecksumSize = 4
+
+// ShardManifest describes a shard of an object erasure coded with Reed-Solomon.
+// The object is split into stripes of DataShards chunks of ChunkSize bytes, the last one being zero padded,
+// and every stripe adds a chunk followed by its checksum to each of the DataShards+ParityShards shards
+type ShardManifest struct {
+	DataShards   int
+	ParityShards int
+	ChunkSize    int
+	// Size is the size of the whole object
+	Size int64
+	// Index is the position of the shard, data shards coming first
+	Index int
+	// Version tells the shards of a write apart from the ones of previous writes of the same object
+	Version string
+	// Nodes are the IDs of the nodes the shards were written to, by index
+	Nodes []string
+}
+
+// Stripes returns the number of stripes of the object
+func (sm *ShardManifest) Stripes() int64 {
+	stripeSize := int64(sm.DataShards * sm.ChunkSize)
+	return (sm.Size + stripeSize - 1) / stripeSize
+}
+
+// ShardSize returns the size of every shard of the object
+func (sm *ShardManifest) ShardSize() int64 {
+	return sm.Stripes() * int64(sm.ChunkSize+ChecksumSize)
+}
+
+// Metadata returns the manifest as object metadata
+func (sm *ShardManifest) Metadata() map[string]string {
+	return map[string]string{
+		MetadataErasureLayout:    fmt.Sprintf("%d+%d", sm.DataShards, sm.ParityShards),
+		MetadataErasureChunkSize: strconv.Itoa(sm.ChunkSize),
+		MetadataErasureSize:      strconv.FormatInt(sm.Size, 10),
+		MetadataErasureIndex:     strconv.Itoa(sm.Index),
+		MetadataErasureVersion:   sm.Version,
+		MetadataErasureNodes:     strings.Join(sm.Nodes, ","),
+	}
+}
+
+// ParseShardManifest reads the shard manifest of the object metadata, ok being false when the object isn't a shard
+func ParseShardManifest(metadata map[string]string) (manifest *ShardManifest, ok bool, err error) {
+	layout, ok := metadata[MetadataErasureLayout]
+	if !ok {
+		return nil, false, nil
+	}
+
+	manifest = &ShardManifest{Version: metadata[MetadataErasureVersion]}
+	if _, err = fmt.Sscanf(layout, "%d+%d", &manifest.DataShards, &manifest.ParityShards); err != nil {
+		return nil, true, fmt.Errorf("erasure layout %q not valid", layout)
+	}
+	if manifest.ChunkSize, err = strconv.Atoi(metadata[MetadataErasureChunkSize]); err != nil {
+		return nil, true, fmt.Errorf("erasure chunk size not valid")
+	}
+	if manifest.Size, err = strconv.ParseInt(metadata[MetadataErasureSize], 10, 64); err != nil {
+		return nil, true, fmt.Errorf("erasure object size not valid")
+	}
+	if manifest.Index, err = strconv.Atoi(metadata[MetadataErasureIndex]); err != nil {
+		return nil, true, fmt.Errorf("erasure shard index not valid")
+	}
+	if nodes := metadata[MetadataErasureNodes]; nodes != "" {
+		manifest.Nodes = strings.Split(nodes, ",")
+	}
+
+	shards := manifest.DataShards + manifest.ParityShards
+	if manifest.DataShards <= 0 || manifest.ParityShards < 0 || manifest.ChunkSize <= 0 || manifest.Size < 0 ||
+		manifest.Index < 0 || manifest.Index >= shards || manifest.Version == "" {
+		return nil, true, fmt.Errorf("shard manifest not valid")
+	}
+
+	return manifest, true, nil
+}
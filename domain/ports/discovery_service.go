@@ -7,3 +7,9 @@ import (
 type DiscoveryService interface {
 	DiscoverNodes(ctx context.Context) ([]ObjectStorage, error)
 }
+
+// DiscoveryWatcher is implemented by discovery services able to notice membership changes as they happen.
+// The returned channel receives a value on every change and is closed once ctx is done
+type DiscoveryWatcher interface {
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
@@ -0,0 +1,15 @@
+package ports
+
+import (
+	"context"
+)
+
+// KeyManagementService wraps the data keys of encrypted objects with master keys it never discloses
+type KeyManagementService interface {
+	// WrapKey encrypts a data key with the current master key and returns the ID of that master key
+	WrapKey(ctx context.Context, plaintext []byte) (wrapped []byte, keyID string, err error)
+	// UnwrapKey decrypts a data key wrapped with the master key of the given ID
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+	// CurrentKeyID returns the ID of the master key new data keys are wrapped with
+	CurrentKeyID() string
+}
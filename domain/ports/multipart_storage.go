@@ -0,0 +1,28 @@
+package ports
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"storage-gateway/domain/models"
+)
+
+// MultipartStorage is implemented by object storage nodes able to assemble an object from parts uploaded separately.
+// Uploads are only visible as an object once completed
+type MultipartStorage interface {
+	ObjectStorage
+	// NewMultipartUpload starts an upload of the object, whose ContentType and Metadata are set on the completed object,
+	// and returns the ID of the upload
+	NewMultipartUpload(ctx context.Context, o *models.Object) (string, error)
+	// PutObjectPart stores a part of an upload, replacing the part of the same number if any
+	PutObjectPart(ctx context.Context, id, uploadID string, number int, content io.Reader, size int64) (*models.Part, error)
+	// ListObjectParts returns the parts of an upload in ascending number order
+	ListObjectParts(ctx context.Context, id, uploadID string) ([]*models.Part, error)
+	// CompleteMultipartUpload assembles the object from the given parts, listed in ascending number order with the ETag they were stored with
+	CompleteMultipartUpload(ctx context.Context, id, uploadID string, parts []*models.Part) (*models.Object, error)
+	// AbortMultipartUpload drops an upload and its parts
+	AbortMultipartUpload(ctx context.Context, id, uploadID string) error
+	// ListMultipartUploads returns the uploads in progress initiated before the given time
+	ListMultipartUploads(ctx context.Context, initiatedBefore time.Time) ([]*models.MultipartUpload, error)
+}
@@ -7,8 +7,44 @@ import (
 )
 
 type ObjectStorage interface {
-	GetObject(ctx context.Context, id string) (*models.Object, error)
+	// GetObject opens the object content. A non nil rng is an absolute range within the object,
+	// in which case the returned Content only carries those bytes
+	GetObject(ctx context.Context, id string, rng *models.ByteRange) (*models.Object, error)
+	// StatObject returns the object metadata without opening its content, so the returned Content is always nil
+	StatObject(ctx context.Context, id string) (*models.Object, error)
 	PutObject(ctx context.Context, o *models.Object) error
+	DeleteObject(ctx context.Context, id string) error
+	// ListObjects returns up to limit objects whose ID starts with prefix and sorts after startAfter, in ascending ID order.
+	// Listed objects only carry metadata
+	ListObjects(ctx context.Context, prefix, startAfter string, limit int) ([]*models.Object, error)
 	ID() string
 	IsOnline() bool
 }
+
+// NodeMetadata is implemented by object storage nodes carrying placement hints from discovery
+type NodeMetadata interface {
+	// Weight scales the number of ring positions of the node, a weight of one being the default
+	Weight() int
+	Zone() string
+}
+
+// MetadataReplacer is implemented by object storage nodes able to replace the metadata of an object without rewriting its content
+type MetadataReplacer interface {
+	// ReplaceMetadata replaces the content type and metadata of the object o.ID with the ones of o, only while its ETag is still o.ETag.
+	// It fails with models.ErrObjectModified when the object was replaced in the meantime
+	ReplaceMetadata(ctx context.Context, o *models.Object) error
+}
+
+// NodeDecorator is implemented by object storage nodes decorating another node without changing how it stores objects,
+// so that the optional interfaces of the decorated node, such as MultipartStorage, can still be reached
+type NodeDecorator interface {
+	// Unwrap returns the decorated node
+	Unwrap() ObjectStorage
+}
+
+// ListingResolver is implemented by storages keeping objects on the nodes in another shape than the one returned to callers,
+// so that listings made from the nodes can be turned into the objects callers see
+type ListingResolver interface {
+	// ResolveListing returns the objects of a sorted listing page as callers see them, dropping the ones they can't see
+	ResolveListing(ctx context.Context, objects []*models.Object) ([]*models.Object, error)
+}
@@ -0,0 +1,65 @@
+package storagetest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+const (
+	minioAccessKey = "conformance"
+	minioSecretKey = "conformance-secret"
+	// minioStartTimeout bounds the wait for a local MinIO server to become live
+	minioStartTimeout = 30 * time.Second
+)
+
+// MinioServer starts the minio binary found in PATH on a free local port with a temporary data directory,
+// and returns its endpoint and credentials. The test is skipped when no binary is available, and the server stopped on cleanup
+func MinioServer(t *testing.T) (endpoint, accessKey, secretKey string) {
+	t.Helper()
+
+	binary, err := exec.LookPath("minio")
+	if err != nil {
+		t.Skip("minio binary not found in PATH")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint = listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, binary, "server", "--quiet", "--address", endpoint, t.TempDir())
+	cmd.Env = append(os.Environ(), "MINIO_ROOT_USER="+minioAccessKey, "MINIO_ROOT_PASSWORD="+minioSecretKey)
+	if err = cmd.Start(); err != nil {
+		cancel()
+		t.Fatalf("start minio: %s", err)
+	}
+
+	t.Cleanup(func() {
+		cancel()
+		cmd.Wait()
+	})
+
+	deadline := time.Now().Add(minioStartTimeout)
+	for {
+		resp, err := http.Get("http://" + endpoint + "/minio/health/live")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return endpoint, minioAccessKey, minioSecretKey
+			}
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("minio not live on %s after %s", endpoint, minioStartTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
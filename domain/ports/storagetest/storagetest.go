@@ -0,0 +1,508 @@
+// Package storagetest provides a conformance suite for ports.ObjectStorage implementations.
+//
+// A backend runs it from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.RunConformance(t, func(t *testing.T) ports.ObjectStorage {
+//			return object_storage.NewMemoryObjectStore("node", 0)
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+)
+
+// largeObjectSize is above the part size of the MinIO client, so unknown sized uploads span several parts
+const largeObjectSize = 24 << 20
+
+// Factory returns the storage under test. It may return the same storage to several subtests,
+// which only use keys starting with their own random prefix
+type Factory func(t *testing.T) ports.ObjectStorage
+
+// OnlineSwitch is implemented by storages that can be switched offline, enabling the offline checks
+type OnlineSwitch interface {
+	SetOnline(online bool)
+}
+
+// RunConformance checks that the storage returned by factory meets the guarantees of ports.ObjectStorage.
+// Large objects are skipped in short mode
+func RunConformance(t *testing.T, factory Factory) {
+	t.Run("PutGetRoundTrip", func(t *testing.T) { testPutGetRoundTrip(t, factory(t)) })
+	t.Run("UnknownSize", func(t *testing.T) { testUnknownSize(t, factory(t)) })
+	t.Run("SizeMismatch", func(t *testing.T) { testSizeMismatch(t, factory(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, factory(t)) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, factory(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, factory(t)) })
+	t.Run("Range", func(t *testing.T) { testRange(t, factory(t)) })
+	t.Run("List", func(t *testing.T) { testList(t, factory(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, factory(t)) })
+	t.Run("ReplaceMetadata", func(t *testing.T) { testReplaceMetadata(t, factory(t)) })
+	t.Run("LargeObject", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("large object skipped in short mode")
+		}
+		testLargeObject(t, factory(t))
+	})
+	t.Run("Offline", func(t *testing.T) { testOffline(t, factory(t)) })
+}
+
+func testPutGetRoundTrip(t *testing.T, storage ports.ObjectStorage) {
+	ctx := context.Background()
+	key := randomKey(t)
+	content := []byte("conformance content")
+
+	metadata := map[string]string{models.MetadataSHA256: hex.EncodeToString(make([]byte, 32))}
+
+	before := time.Now().Add(-time.Minute)
+	err := storage.PutObject(context.Background(), &models.Object{
+		ID:          models.ObjectID(key),
+		Content:     bytes.NewReader(content),
+		ContentType: "text/plain",
+		Size:        int64(len(content)),
+		Metadata:    metadata,
+	})
+	if err != nil {
+		t.Fatalf("put %s: %s", key, err)
+	}
+
+	obj, err := storage.GetObject(ctx, key, nil)
+	if err != nil {
+		t.Fatalf("get object: %s", err)
+	}
+
+	if got := read(t, obj); !bytes.Equal(got, content) {
+		t.Errorf("content = %q, want %q", got, content)
+	}
+	if obj.ID.Value() != key {
+		t.Errorf("id = %q, want %q", obj.ID, key)
+	}
+	if obj.ContentType != "text/plain" {
+		t.Errorf("content type = %q, want text/plain", obj.ContentType)
+	}
+	if obj.Size != int64(len(content)) {
+		t.Errorf("size = %d, want %d", obj.Size, len(content))
+	}
+	if obj.ETag == "" {
+		t.Error("etag is empty")
+	}
+	if obj.LastModified.Before(before) {
+		t.Errorf("last modified = %s, want a recent time", obj.LastModified)
+	}
+	if obj.Range != nil {
+		t.Errorf("range = %+v, want nil for a full read", obj.Range)
+	}
+	if fmt.Sprint(obj.Metadata) != fmt.Sprint(metadata) {
+		t.Errorf("metadata = %v, want %v", obj.Metadata, metadata)
+	}
+
+	stat, err := storage.StatObject(ctx, key)
+	if err != nil {
+		t.Fatalf("stat object: %s", err)
+	}
+	if stat.Content != nil {
+		t.Error("stat returned content")
+	}
+	if stat.Size != obj.Size || stat.ETag != obj.ETag || stat.ContentType != obj.ContentType || fmt.Sprint(stat.Metadata) != fmt.Sprint(metadata) {
+		t.Errorf("stat = %+v, want the metadata of get %+v", stat, obj)
+	}
+}
+
+func testUnknownSize(t *testing.T, storage ports.ObjectStorage) {
+	key := randomKey(t)
+	content := []byte("content of unknown size")
+
+	put(t, storage, key, "application/octet-stream", content, -1)
+
+	stat, err := storage.StatObject(context.Background(), key)
+	if err != nil {
+		t.Fatalf("stat object: %s", err)
+	}
+	if stat.Size != int64(len(content)) {
+		t.Errorf("size = %d, want the %d bytes read", stat.Size, len(content))
+	}
+}
+
+func testSizeMismatch(t *testing.T, storage ports.ObjectStorage) {
+	ctx := context.Background()
+	key := randomKey(t)
+
+	err := storage.PutObject(ctx, &models.Object{
+		ID:      models.ObjectID(key),
+		Content: bytes.NewReader([]byte("abc")),
+		Size:    5,
+	})
+	if err == nil {
+		t.Fatal("put of a content shorter than its size succeeded")
+	}
+
+	if _, err = storage.StatObject(ctx, key); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Errorf("stat after a failed put = %v, want %v", err, models.ErrObjectNotFound)
+	}
+}
+
+func testNotFound(t *testing.T, storage ports.ObjectStorage) {
+	ctx := context.Background()
+	key := randomKey(t)
+
+	if _, err := storage.GetObject(ctx, key, nil); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Errorf("get = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	if _, err := storage.StatObject(ctx, key); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Errorf("stat = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	if err := storage.DeleteObject(ctx, key); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Errorf("delete = %v, want %v", err, models.ErrObjectNotFound)
+	}
+}
+
+func testOverwrite(t *testing.T, storage ports.ObjectStorage) {
+	key := randomKey(t)
+
+	put(t, storage, key, "text/plain", []byte("first version"), -1)
+	put(t, storage, key, "application/json", []byte(`{"version":2}`), -1)
+
+	obj, err := storage.GetObject(context.Background(), key, nil)
+	if err != nil {
+		t.Fatalf("get object: %s", err)
+	}
+
+	if got := read(t, obj); string(got) != `{"version":2}` {
+		t.Errorf("content = %q, want the second version", got)
+	}
+	if obj.ContentType != "application/json" {
+		t.Errorf("content type = %q, want application/json", obj.ContentType)
+	}
+}
+
+func testDelete(t *testing.T, storage ports.ObjectStorage) {
+	ctx := context.Background()
+	key := randomKey(t)
+
+	put(t, storage, key, "text/plain", []byte("to delete"), -1)
+
+	if err := storage.DeleteObject(ctx, key); err != nil {
+		t.Fatalf("delete object: %s", err)
+	}
+	if _, err := storage.GetObject(ctx, key, nil); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Errorf("get after delete = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	if err := storage.DeleteObject(ctx, key); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Errorf("second delete = %v, want %v", err, models.ErrObjectNotFound)
+	}
+}
+
+func testReplaceMetadata(t *testing.T, storage ports.ObjectStorage) {
+	replacer, ok := storage.(ports.MetadataReplacer)
+	if !ok {
+		t.Skip("storage can't replace metadata")
+	}
+
+	ctx := context.Background()
+	key := randomKey(t)
+
+	put(t, storage, key, "text/plain", []byte("kept content"), -1)
+
+	stat, err := storage.StatObject(ctx, key)
+	if err != nil {
+		t.Fatalf("stat object: %s", err)
+	}
+
+	stat.Metadata = map[string]string{"Replaced": "yes"}
+	if err = replacer.ReplaceMetadata(ctx, stat); err != nil {
+		t.Fatalf("replace metadata: %s", err)
+	}
+
+	obj, err := storage.GetObject(ctx, key, nil)
+	if err != nil {
+		t.Fatalf("get object: %s", err)
+	}
+	if got := read(t, obj); string(got) != "kept content" {
+		t.Errorf("content = %q, want the content before the replacement", got)
+	}
+	if obj.ContentType != "text/plain" {
+		t.Errorf("content type = %q, want text/plain", obj.ContentType)
+	}
+	if obj.Metadata["Replaced"] != "yes" {
+		t.Errorf("metadata = %v, want the replaced metadata", obj.Metadata)
+	}
+
+	// the replacement is conditional on the object not having been written since it was stat'ed
+	put(t, storage, key, "text/plain", []byte("newer content"), -1)
+
+	stat.Metadata = map[string]string{"Replaced": "again"}
+	if err = replacer.ReplaceMetadata(ctx, stat); !errors.Is(err, models.ErrObjectModified) {
+		t.Errorf("replace metadata of a newer object = %v, want %v", err, models.ErrObjectModified)
+	}
+
+	obj, err = storage.GetObject(ctx, key, nil)
+	if err != nil {
+		t.Fatalf("get newer object: %s", err)
+	}
+	if got := read(t, obj); string(got) != "newer content" {
+		t.Errorf("content = %q, want the newer content", got)
+	}
+	if _, ok = obj.Metadata["Replaced"]; ok {
+		t.Errorf("metadata = %v, want the metadata of the newer object", obj.Metadata)
+	}
+}
+
+func testRange(t *testing.T, storage ports.ObjectStorage) {
+	ctx := context.Background()
+	key := randomKey(t)
+	content := []byte("0123456789")
+
+	put(t, storage, key, "text/plain", content, int64(len(content)))
+
+	for _, rng := range []models.ByteRange{{Start: 0, End: 0}, {Start: 2, End: 5}, {Start: 7, End: 9}} {
+		obj, err := storage.GetObject(ctx, key, &rng)
+		if err != nil {
+			t.Fatalf("get range %d-%d: %s", rng.Start, rng.End, err)
+		}
+
+		if got, want := read(t, obj), content[rng.Start:rng.End+1]; !bytes.Equal(got, want) {
+			t.Errorf("range %d-%d content = %q, want %q", rng.Start, rng.End, got, want)
+		}
+		if obj.Size != int64(len(content)) {
+			t.Errorf("range %d-%d size = %d, want the full size %d", rng.Start, rng.End, obj.Size, len(content))
+		}
+		if obj.Range == nil || *obj.Range != rng {
+			t.Errorf("range %d-%d returned range %+v", rng.Start, rng.End, obj.Range)
+		}
+	}
+
+	if _, err := storage.GetObject(ctx, key, &models.ByteRange{Start: 20, End: 30}); !errors.Is(err, models.ErrRangeNotSatisfiable) {
+		t.Errorf("get beyond the end = %v, want %v", err, models.ErrRangeNotSatisfiable)
+	}
+}
+
+func testList(t *testing.T, storage ports.ObjectStorage) {
+	ctx := context.Background()
+	prefix := randomKey(t)
+
+	keys := []string{prefix + "a", prefix + "b", prefix + "ba", prefix + "c"}
+	for i := len(keys) - 1; i >= 0; i-- {
+		put(t, storage, keys[i], "text/plain", []byte(keys[i]), -1)
+	}
+
+	objects, err := storage.ListObjects(ctx, prefix, "", 10)
+	if err != nil {
+		t.Fatalf("list objects: %s", err)
+	}
+	if got := objectIDs(objects); fmt.Sprint(got) != fmt.Sprint(keys) {
+		t.Errorf("listed %v, want %v in ascending order", got, keys)
+	}
+	for _, obj := range objects {
+		if obj.Content != nil {
+			t.Errorf("listed object %s has content", obj.ID)
+		}
+		if obj.Size != int64(len(obj.ID.Value())) || obj.ETag == "" {
+			t.Errorf("listed object %+v lacks its metadata", obj)
+		}
+	}
+
+	objects, err = storage.ListObjects(ctx, prefix+"b", "", 10)
+	if err != nil {
+		t.Fatalf("list objects by prefix: %s", err)
+	}
+	if got := objectIDs(objects); fmt.Sprint(got) != fmt.Sprint(keys[1:3]) {
+		t.Errorf("listed %v with prefix, want %v", got, keys[1:3])
+	}
+
+	objects, err = storage.ListObjects(ctx, prefix, keys[1], 2)
+	if err != nil {
+		t.Fatalf("list objects after a key: %s", err)
+	}
+	if got := objectIDs(objects); fmt.Sprint(got) != fmt.Sprint(keys[2:4]) {
+		t.Errorf("listed %v after %s, want %v", got, keys[1], keys[2:4])
+	}
+
+	objects, err = storage.ListObjects(ctx, prefix, keys[3], 10)
+	if err != nil {
+		t.Fatalf("list objects after the last key: %s", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("listed %v after the last key, want none", objectIDs(objects))
+	}
+}
+
+func testConcurrency(t *testing.T, storage ports.ObjectStorage) {
+	ctx := context.Background()
+	prefix := randomKey(t)
+	shared := prefix + "shared"
+
+	const workers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*3)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("%s%d", prefix, i)
+			content := bytes.Repeat([]byte{byte('a' + i)}, 64<<10)
+
+			for _, id := range []string{key, shared} {
+				if err := storage.PutObject(ctx, &models.Object{ID: models.ObjectID(id), Content: bytes.NewReader(content), Size: int64(len(content))}); err != nil {
+					errs <- fmt.Errorf("put %s: %w", id, err)
+					return
+				}
+			}
+
+			obj, err := storage.GetObject(ctx, key, nil)
+			if err != nil {
+				errs <- fmt.Errorf("get %s: %w", key, err)
+				return
+			}
+			if got, err := io.ReadAll(obj.Content); err != nil || !bytes.Equal(got, content) {
+				errs <- fmt.Errorf("get %s returned another content", key)
+			}
+			closeContent(obj)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	obj, err := storage.GetObject(ctx, shared, nil)
+	if err != nil {
+		t.Fatalf("get shared object: %s", err)
+	}
+
+	got := read(t, obj)
+	if len(got) != 64<<10 || !bytes.Equal(got, bytes.Repeat(got[:1], len(got))) {
+		t.Error("concurrent writes of the same key interleaved")
+	}
+}
+
+func testLargeObject(t *testing.T, storage ports.ObjectStorage) {
+	ctx := context.Background()
+	key := randomKey(t)
+
+	content := make([]byte, largeObjectSize)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+
+	put(t, storage, key, "application/octet-stream", content, -1)
+
+	obj, err := storage.GetObject(ctx, key, nil)
+	if err != nil {
+		t.Fatalf("get object: %s", err)
+	}
+	if got := read(t, obj); !bytes.Equal(got, content) {
+		t.Errorf("large object read back with %d bytes, differing from the %d bytes written", len(got), len(content))
+	}
+
+	rng := models.ByteRange{Start: largeObjectSize - 1024, End: largeObjectSize - 1}
+	obj, err = storage.GetObject(ctx, key, &rng)
+	if err != nil {
+		t.Fatalf("get range: %s", err)
+	}
+	if got := read(t, obj); !bytes.Equal(got, content[rng.Start:]) {
+		t.Error("range at the end of a large object differs")
+	}
+}
+
+func testOffline(t *testing.T, storage ports.ObjectStorage) {
+	if !storage.IsOnline() {
+		t.Fatal("storage is offline")
+	}
+
+	toggle, ok := storage.(OnlineSwitch)
+	if !ok {
+		t.Skip("storage can't be switched offline")
+	}
+
+	ctx := context.Background()
+	key := randomKey(t)
+	put(t, storage, key, "text/plain", []byte("offline"), -1)
+
+	toggle.SetOnline(false)
+	defer toggle.SetOnline(true)
+
+	if storage.IsOnline() {
+		t.Error("storage still online after being switched offline")
+	}
+	if _, err := storage.GetObject(ctx, key, nil); err == nil {
+		t.Error("get succeeded while offline")
+	}
+	if err := storage.PutObject(ctx, &models.Object{ID: models.ObjectID(key), Content: bytes.NewReader(nil), Size: 0}); err == nil {
+		t.Error("put succeeded while offline")
+	}
+
+	toggle.SetOnline(true)
+
+	if _, err := storage.StatObject(ctx, key); err != nil {
+		t.Errorf("stat after going back online: %s", err)
+	}
+}
+
+// randomKey returns a key unique to the test, also used as a prefix of the keys it writes
+func randomKey(t *testing.T) string {
+	t.Helper()
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return "conformance" + hex.EncodeToString(b)
+}
+
+func put(t *testing.T, storage ports.ObjectStorage, key, contentType string, content []byte, size int64) {
+	t.Helper()
+
+	err := storage.PutObject(context.Background(), &models.Object{
+		ID:          models.ObjectID(key),
+		Content:     bytes.NewReader(content),
+		ContentType: contentType,
+		Size:        size,
+	})
+	if err != nil {
+		t.Fatalf("put %s: %s", key, err)
+	}
+}
+
+func read(t *testing.T, obj *models.Object) []byte {
+	t.Helper()
+	defer closeContent(obj)
+
+	content, err := io.ReadAll(obj.Content)
+	if err != nil {
+		t.Fatalf("read %s: %s", obj.ID, err)
+	}
+
+	return content
+}
+
+func closeContent(obj *models.Object) {
+	if closer, ok := obj.Content.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func objectIDs(objects []*models.Object) []string {
+	ids := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		ids = append(ids, obj.ID.Value())
+	}
+
+	return ids
+}
@@ -0,0 +1,409 @@
+package services
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"strconv"
+	"strings"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/internal/context-wrapper"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codecs are named after the HTTP content codings, so that compressed content can be served as is
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+// Metadata keys recording how an object was compressed, they are never returned to callers
+const (
+	metadataCompressionCodec = "Compression-Codec"
+	metadataCompressionSize  = "Compression-Size"
+)
+
+// incompressibleTypes are media types already compressed, which are stored as is whatever the rules
+var incompressibleTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zstd":             true,
+	"application/zip":              true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/pdf":              true,
+}
+
+// CompressionRule selects the codec of the objects of a content type
+type CompressionRule struct {
+	// ContentType is a media type such as application/json, text/* matching every subtype and * matching anything
+	ContentType string
+	Codec       string
+}
+
+type CompressionOptions struct {
+	// Rules are checked in order, objects matching none of them being stored as is
+	Rules []CompressionRule
+	// MinSize is the size under which objects are stored as is
+	MinSize int64
+}
+
+// CompressedStorage compresses objects on their way to a storage and decompresses them on their way back.
+// Objects of unknown size are stored as is, since their size couldn't be reported without reading them
+type CompressedStorage struct {
+	storage ports.ObjectStorage
+	rules   []CompressionRule
+	minSize int64
+}
+
+// NewCompressedStorage creates a new instance of CompressedStorage on top of storage
+func NewCompressedStorage(storage ports.ObjectStorage, opts CompressionOptions) (*CompressedStorage, error) {
+	for _, rule := range opts.Rules {
+		switch rule.Codec {
+		case CodecNone, CodecGzip, CodecZstd:
+		default:
+			return nil, fmt.Errorf("unknown compression codec %q", rule.Codec)
+		}
+	}
+
+	return &CompressedStorage{
+		storage: storage,
+		rules:   opts.Rules,
+		minSize: opts.MinSize,
+	}, nil
+}
+
+// PutObject compresses the object content with the codec of its content type while streaming it to the storage
+func (cs *CompressedStorage) PutObject(ctx context.Context, o *models.Object) error {
+	codec := cs.codec(o)
+	if codec == CodecNone {
+		return cs.storage.PutObject(ctx, o)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(compress(pw, &sizeReader{r: o.Content, remaining: o.Size}, codec))
+	}()
+
+	compressed := *o
+	compressed.Content = pr
+	compressed.Size = -1
+	compressed.Metadata = maps.Clone(o.Metadata)
+	if compressed.Metadata == nil {
+		compressed.Metadata = make(map[string]string, 2)
+	}
+	compressed.Metadata[metadataCompressionCodec] = codec
+	compressed.Metadata[metadataCompressionSize] = strconv.FormatInt(o.Size, 10)
+
+	err := cs.storage.PutObject(ctx, &compressed)
+
+	// the content must not be read anymore once the put returns
+	pr.Close()
+	<-done
+
+	return err
+}
+
+// GetObject decompresses an object, or returns its compressed content along with its ContentEncoding
+// when the whole object is read and the Accept-Encoding of the context accepts its codec
+func (cs *CompressedStorage) GetObject(ctx context.Context, id string, rng *models.ByteRange) (*models.Object, error) {
+	if rng == nil {
+		obj, err := cs.storage.GetObject(ctx, id, nil)
+		if err != nil || !compressed(obj) {
+			return obj, err
+		}
+
+		if codec := obj.Metadata[metadataCompressionCodec]; acceptsEncoding(context_wrapper.GetAcceptEncoding(ctx), codec) {
+			obj.ContentEncoding = codec
+			obj.Metadata = uncompressedMetadata(obj.Metadata)
+			return obj, nil
+		}
+
+		if err = decompressObject(obj); err != nil {
+			closeContent(obj)
+			return nil, err
+		}
+
+		return obj, nil
+	}
+
+	stat, err := cs.storage.StatObject(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed(stat) {
+		return cs.storage.GetObject(ctx, id, rng)
+	}
+
+	// compressed content can't be seeked, so the content before the range is decompressed and skipped
+	obj, err := cs.storage.GetObject(ctx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if compressed(obj) {
+		if err = decompressObject(obj); err != nil {
+			closeContent(obj)
+			return nil, err
+		}
+	}
+
+	if rng.Start < 0 || rng.Start >= obj.Size || rng.End < rng.Start {
+		closeContent(obj)
+		return nil, models.ErrRangeNotSatisfiable
+	}
+	end := min(rng.End, obj.Size-1)
+
+	if _, err = io.CopyN(io.Discard, obj.Content, rng.Start); err != nil {
+		closeContent(obj)
+		return nil, err
+	}
+
+	obj.Content = withCloser(io.LimitReader(obj.Content, end-rng.Start+1), obj.Content)
+	obj.Range = &models.ByteRange{Start: rng.Start, End: end}
+
+	return obj, nil
+}
+
+// StatObject returns the metadata of an object with its uncompressed size
+func (cs *CompressedStorage) StatObject(ctx context.Context, id string) (*models.Object, error) {
+	obj, err := cs.storage.StatObject(ctx, id)
+	if err != nil || !compressed(obj) {
+		return obj, err
+	}
+
+	if obj.Size, err = uncompressedSize(obj); err != nil {
+		return nil, err
+	}
+	obj.Metadata = uncompressedMetadata(obj.Metadata)
+
+	return obj, nil
+}
+
+func (cs *CompressedStorage) DeleteObject(ctx context.Context, id string) error {
+	return cs.storage.DeleteObject(ctx, id)
+}
+
+// ListObjects lists objects with their stored size, listings carrying no metadata
+func (cs *CompressedStorage) ListObjects(ctx context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	return cs.storage.ListObjects(ctx, prefix, startAfter, limit)
+}
+
+// ResolveListing replaces the objects of a listing page with their stat, so that they carry their uncompressed size.
+// Stats go through the wrapped storage, which drops the objects it wouldn't list to callers
+func (cs *CompressedStorage) ResolveListing(ctx context.Context, objects []*models.Object) ([]*models.Object, error) {
+	return statListing(ctx, objects, cs.StatObject)
+}
+
+func (cs *CompressedStorage) ID() string {
+	return cs.storage.ID()
+}
+
+func (cs *CompressedStorage) IsOnline() bool {
+	return cs.storage.IsOnline()
+}
+
+// codec returns the codec of the first rule matching the content type of an object
+func (cs *CompressedStorage) codec(o *models.Object) string {
+	if o.Size <= 0 || o.Size < cs.minSize {
+		return CodecNone
+	}
+
+	mediaType, _, err := mime.ParseMediaType(o.ContentType)
+	if err != nil {
+		mediaType = ""
+	}
+	if incompressible(mediaType) {
+		return CodecNone
+	}
+
+	for _, rule := range cs.rules {
+		if matchesContentType(rule.ContentType, mediaType) {
+			return rule.Codec
+		}
+	}
+
+	return CodecNone
+}
+
+func incompressible(mediaType string) bool {
+	if incompressibleTypes[mediaType] {
+		return true
+	}
+
+	kind, _, _ := strings.Cut(mediaType, "/")
+	switch kind {
+	case "image":
+		return mediaType != "image/svg+xml"
+	case "audio", "video":
+		return true
+	}
+
+	return false
+}
+
+func matchesContentType(pattern, mediaType string) bool {
+	if pattern == "*" || pattern == "*/*" {
+		return true
+	}
+
+	if kind, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, kind+"/")
+	}
+
+	return strings.EqualFold(pattern, mediaType)
+}
+
+// acceptsEncoding tells whether an Accept-Encoding header value accepts the given content coding
+func acceptsEncoding(acceptEncoding, coding string) bool {
+	accepted := false
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(entry, ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, coding) && name != "*" {
+			continue
+		}
+
+		refused := false
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			refused = err != nil || weight == 0
+		}
+
+		// an explicit entry for the coding wins over the wildcard
+		if strings.EqualFold(name, coding) {
+			return !refused
+		}
+		accepted = !refused
+	}
+
+	return accepted
+}
+
+func compressed(obj *models.Object) bool {
+	_, ok := obj.Metadata[metadataCompressionCodec]
+	return ok
+}
+
+func uncompressedSize(obj *models.Object) (int64, error) {
+	size, err := strconv.ParseInt(obj.Metadata[metadataCompressionSize], 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("uncompressed size of %s not valid", obj.ID)
+	}
+
+	return size, nil
+}
+
+// uncompressedMetadata returns the metadata without the compression keys, nil when nothing else is left
+func uncompressedMetadata(metadata map[string]string) map[string]string {
+	plain := maps.Clone(metadata)
+	delete(plain, metadataCompressionCodec)
+	delete(plain, metadataCompressionSize)
+
+	if len(plain) == 0 {
+		return nil
+	}
+
+	return plain
+}
+
+// decompressObject replaces the content of a compressed object with its decompressed content
+func decompressObject(obj *models.Object) error {
+	size, err := uncompressedSize(obj)
+	if err != nil {
+		return err
+	}
+
+	var decoder io.ReadCloser
+	switch codec := obj.Metadata[metadataCompressionCodec]; codec {
+	case CodecGzip:
+		decoder, err = gzip.NewReader(obj.Content)
+	case CodecZstd:
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(obj.Content, zstd.WithDecoderConcurrency(1)); err == nil {
+			decoder = zr.IOReadCloser()
+		}
+	default:
+		err = fmt.Errorf("unknown compression codec %q of %s", codec, obj.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	obj.Content = decodedReader{ReadCloser: decoder, original: obj.Content}
+	obj.Size = size
+	obj.Metadata = uncompressedMetadata(obj.Metadata)
+
+	return nil
+}
+
+func compress(w io.Writer, r io.Reader, codec string) error {
+	var encoder io.WriteCloser
+	switch codec {
+	case CodecGzip:
+		encoder = gzip.NewWriter(w)
+	case CodecZstd:
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		encoder = zw
+	default:
+		return fmt.Errorf("unknown compression codec %q", codec)
+	}
+
+	if _, err := io.Copy(encoder, r); err != nil {
+		encoder.Close()
+		return err
+	}
+
+	return encoder.Close()
+}
+
+// decodedReader reads decompressed content, closing both the decoder and the original content
+type decodedReader struct {
+	io.ReadCloser
+	original io.Reader
+}
+
+func (dr decodedReader) Close() error {
+	err := dr.ReadCloser.Close()
+	if closer, ok := dr.original.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// sizeReader fails when the content read from r doesn't have exactly the remaining size
+type sizeReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (sr *sizeReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.remaining -= int64(n)
+
+	switch {
+	case sr.remaining < 0:
+		return n, fmt.Errorf("object content is larger than its size")
+	case err == io.EOF && sr.remaining > 0:
+		return n, fmt.Errorf("object content is %d bytes shorter than its size", sr.remaining)
+	}
+
+	return n, err
+}
@@ -0,0 +1,198 @@
+package services_test
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/object-storage"
+	"storage-gateway/internal/context-wrapper"
+)
+
+// compressibleContent is text large enough to be compressed by the test rules
+var compressibleContent = strings.Repeat("compressible text, ", 100)
+
+// newCompressedStorage returns a compressed storage on top of storage, text being compressed with zstd,
+// JSON with gzip, and objects under 100 bytes being stored as is
+func newCompressedStorage(t *testing.T, storage ports.ObjectStorage) *services.CompressedStorage {
+	t.Helper()
+
+	cs, err := services.NewCompressedStorage(storage, services.CompressionOptions{
+		Rules: []services.CompressionRule{
+			{ContentType: "text/*", Codec: services.CodecZstd},
+			{ContentType: "application/json", Codec: services.CodecGzip},
+		},
+		MinSize: 100,
+	})
+	if err != nil {
+		t.Fatalf("create compressed storage: %v", err)
+	}
+
+	return cs
+}
+
+func TestCompressedStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	cs := newCompressedStorage(t, node)
+
+	for _, contentType := range []string{"text/plain; charset=utf-8", "application/json", "image/png", "application/gzip"} {
+		putTypedObject(t, cs, "round-trip", contentType, compressibleContent)
+
+		stored, err := node.StatObject(ctx, "round-trip")
+		if err != nil {
+			t.Fatalf("stat stored object: %v", err)
+		}
+		wantCompressed := strings.HasPrefix(contentType, "text/") || contentType == "application/json"
+		if compressed := stored.Size < int64(len(compressibleContent)); compressed != wantCompressed {
+			t.Fatalf("%s stored with %d bytes, compressed = %t, want %t", contentType, stored.Size, compressed, wantCompressed)
+		}
+
+		if content := getObject(t, cs, "round-trip"); content != compressibleContent {
+			t.Fatalf("%s content = %q, want %q", contentType, content, compressibleContent)
+		}
+		stat, err := cs.StatObject(ctx, "round-trip")
+		if err != nil {
+			t.Fatalf("stat object: %v", err)
+		}
+		if stat.Size != int64(len(compressibleContent)) || len(stat.Metadata) != 0 || stat.ContentType != contentType {
+			t.Fatalf("%s stat = %d bytes of %s with %v, want %d bytes and no metadata", contentType, stat.Size, stat.ContentType, stat.Metadata, len(compressibleContent))
+		}
+	}
+}
+
+func TestCompressedStorageReadsRanges(t *testing.T) {
+	ctx := context.Background()
+	cs := newCompressedStorage(t, object_storage.NewMemoryObjectStore("node", 0))
+	putTypedObject(t, cs, "ranged", "text/plain", compressibleContent)
+
+	for _, rng := range []models.ByteRange{{Start: 0, End: 0}, {Start: 150, End: 1234}, {Start: 1890, End: 5000}} {
+		obj, err := cs.GetObject(ctx, "ranged", &rng)
+		if err != nil {
+			t.Fatalf("get range %d-%d: %v", rng.Start, rng.End, err)
+		}
+		got, err := io.ReadAll(obj.Content)
+		closeObject(obj)
+		if err != nil {
+			t.Fatalf("read range %d-%d: %v", rng.Start, rng.End, err)
+		}
+
+		end := min(rng.End, int64(len(compressibleContent))-1)
+		if want := compressibleContent[rng.Start : end+1]; string(got) != want || obj.Range.End != end {
+			t.Fatalf("range %d-%d = %q up to %d, want %q up to %d", rng.Start, rng.End, got, obj.Range.End, want, end)
+		}
+	}
+
+	if _, err := cs.GetObject(ctx, "ranged", &models.ByteRange{Start: int64(len(compressibleContent)), End: 5000}); !errors.Is(err, models.ErrRangeNotSatisfiable) {
+		t.Fatalf("get error past the end = %v, want %v", err, models.ErrRangeNotSatisfiable)
+	}
+}
+
+func TestCompressedStorageServesAcceptedEncodings(t *testing.T) {
+	cs := newCompressedStorage(t, object_storage.NewMemoryObjectStore("node", 0))
+	putTypedObject(t, cs, "encoded", "application/json", compressibleContent)
+
+	// the stored gzip content is served as is to clients accepting it
+	obj, err := cs.GetObject(context_wrapper.WithAcceptEncoding(context.Background(), "br, gzip;q=0.8"), "encoded", nil)
+	if err != nil {
+		t.Fatalf("get object: %v", err)
+	}
+	defer closeObject(obj)
+	if obj.ContentEncoding != services.CodecGzip || len(obj.Metadata) != 0 {
+		t.Fatalf("content encoding = %q with %v, want %q and no metadata", obj.ContentEncoding, obj.Metadata, services.CodecGzip)
+	}
+	zr, err := gzip.NewReader(obj.Content)
+	if err != nil {
+		t.Fatalf("read gzip content: %v", err)
+	}
+	if content, err := io.ReadAll(zr); err != nil || string(content) != compressibleContent {
+		t.Fatalf("decoded content = %q, %v, want %q", content, err, compressibleContent)
+	}
+
+	// and decompressed for the others
+	for _, acceptEncoding := range []string{"", "gzip;q=0", "zstd"} {
+		obj, err = cs.GetObject(context_wrapper.WithAcceptEncoding(context.Background(), acceptEncoding), "encoded", nil)
+		if err != nil {
+			t.Fatalf("get object accepting %q: %v", acceptEncoding, err)
+		}
+		content, err := io.ReadAll(obj.Content)
+		closeObject(obj)
+		if err != nil || obj.ContentEncoding != "" || string(content) != compressibleContent {
+			t.Fatalf("content accepting %q = %q encoded with %q, %v, want it decoded", acceptEncoding, content, obj.ContentEncoding, err)
+		}
+	}
+}
+
+func TestCompressedStorageListsUncompressedSizes(t *testing.T) {
+	ctx := context.Background()
+	nps, nodes := newMemoryPool(3)
+
+	rs, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{Replicas: 3})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+	cs, err := services.NewCompressedStorage(rs, services.CompressionOptions{
+		Rules:   []services.CompressionRule{{ContentType: "text/*", Codec: services.CodecZstd}},
+		MinSize: 100,
+	})
+	if err != nil {
+		t.Fatalf("create compressed storage: %v", err)
+	}
+
+	sizes := map[string]int64{
+		"compressed": 10000,
+		"small":      10,
+	}
+	for id, size := range sizes {
+		err = cs.PutObject(ctx, &models.Object{
+			ID:          models.ObjectID(id),
+			ContentType: "text/plain",
+			Content:     strings.NewReader(strings.Repeat("a", int(size))),
+			Size:        size,
+		})
+		if err != nil {
+			t.Fatalf("put %s: %v", id, err)
+		}
+	}
+
+	stored, err := nodes[0].StatObject(ctx, "compressed")
+	if err != nil {
+		t.Fatalf("stat stored object: %v", err)
+	}
+	if stored.Size >= sizes["compressed"] {
+		t.Fatalf("stored size = %d, want less than %d", stored.Size, sizes["compressed"])
+	}
+
+	list, err := services.NewListObjectsService(nps, cs).ListObjects(ctx, "", 0, "")
+	if err != nil {
+		t.Fatalf("list objects: %v", err)
+	}
+	if len(list.Objects) != len(sizes) {
+		t.Fatalf("listed %d objects, want %d", len(list.Objects), len(sizes))
+	}
+	for _, obj := range list.Objects {
+		if obj.Size != sizes[obj.ID.Value()] {
+			t.Fatalf("listed size of %s = %d, want %d", obj.ID, obj.Size, sizes[obj.ID.Value()])
+		}
+	}
+}
+
+func putTypedObject(t *testing.T, storage ports.ObjectStorage, id, contentType, content string) {
+	t.Helper()
+
+	err := storage.PutObject(context.Background(), &models.Object{
+		ID:          models.ObjectID(id),
+		ContentType: contentType,
+		Content:     strings.NewReader(content),
+		Size:        int64(len(content)),
+	})
+	if err != nil {
+		t.Fatalf("put object %s: %v", id, err)
+	}
+}
@@ -0,0 +1,445 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+)
+
+const (
+	// internalKeyPrefix is reserved by models.ObjectID.IsValidKey, so internal objects never mix with the objects of callers
+	internalKeyPrefix = "~"
+	blobKeyPrefix     = internalKeyPrefix + "blob-"
+	refsKeyPrefix     = internalKeyPrefix + "refs-"
+
+	defaultGCGracePeriod = time.Hour
+	dedupListPageSize    = 1000
+)
+
+// Metadata keys of manifests and reference records, they are never returned to callers
+const (
+	metadataDedupBlob = "Dedup-Blob"
+	metadataDedupSize = "Dedup-Size"
+	metadataDedupRefs = "Dedup-Refs"
+)
+
+type DedupOptions struct {
+	// SpoolDir holds the contents being hashed before they are stored, the system temporary directory when empty
+	SpoolDir string
+	// GracePeriod protects recently written blobs from the garbage collection
+	GracePeriod time.Duration
+}
+
+// DedupStorage stores every distinct content once, as a blob keyed by its SHA-256.
+// Objects become empty manifests whose metadata point at their blob, and every blob has a reference record counting the manifests
+// pointing at it, so that a blob is only removed by the garbage collection once nothing references it.
+// References are counted under in-process locks, so a single gateway must write to a deduplicated pool
+type DedupStorage struct {
+	storage     ports.ObjectStorage
+	spoolDir    string
+	gracePeriod time.Duration
+	locks       *keyLocks
+}
+
+// NewDedupStorage creates a new instance of DedupStorage on top of storage
+func NewDedupStorage(storage ports.ObjectStorage, opts DedupOptions) *DedupStorage {
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = defaultGCGracePeriod
+	}
+
+	return &DedupStorage{
+		storage:     storage,
+		spoolDir:    opts.SpoolDir,
+		gracePeriod: opts.GracePeriod,
+		locks:       newKeyLocks(),
+	}
+}
+
+// PutObject spools the object content to hash it, stores its blob unless it already exists and points the object manifest at it.
+// The manifest records the SHA-256 of the content as its digest unless the object has one
+func (ds *DedupStorage) PutObject(ctx context.Context, o *models.Object) error {
+	spool, hash, size, err := ds.spool(o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	id := o.ID.Value()
+	unlock := ds.locks.lock(id)
+	defer unlock()
+
+	previous, err := ds.storage.StatObject(ctx, id)
+	if err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+		return err
+	}
+
+	if err = ds.reference(ctx, hash, spool, size, o.ContentType); err != nil {
+		return err
+	}
+
+	manifest := &models.Object{
+		ID:          o.ID,
+		Content:     bytes.NewReader(nil),
+		ContentType: o.ContentType,
+		Size:        0,
+		Metadata:    maps.Clone(o.Metadata),
+	}
+	if manifest.Metadata == nil {
+		manifest.Metadata = make(map[string]string, 3)
+	}
+	manifest.Metadata[metadataDedupBlob] = hash
+	manifest.Metadata[metadataDedupSize] = strconv.FormatInt(size, 10)
+	// a digest sent by the client was already verified by then
+	if _, ok := manifest.Metadata[models.MetadataSHA256]; !ok {
+		manifest.Metadata[models.MetadataSHA256] = hash
+	}
+
+	if err = ds.storage.PutObject(ctx, manifest); err != nil {
+		// the reference is released so that the blob can be collected if nothing else points at it
+		ds.release(ctx, hash)
+		return err
+	}
+
+	if previous != nil && isManifest(previous) {
+		ds.releaseAfterUpdate(ctx, id, previous.Metadata[metadataDedupBlob])
+	}
+
+	return nil
+}
+
+// spool copies the object content to a temporary file while hashing it, and returns the file rewound with the content hash and size
+func (ds *DedupStorage) spool(o *models.Object) (*os.File, string, int64, error) {
+	spool, err := os.CreateTemp(ds.spoolDir, "dedup-")
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(spool, hash), o.Content)
+	if err == nil && o.Size >= 0 && size != o.Size {
+		err = fmt.Errorf("object size %d differs from the %d bytes read", o.Size, size)
+	}
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, "", 0, err
+	}
+
+	return spool, hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// reference stores a blob unless it exists and counts one more reference to it
+func (ds *DedupStorage) reference(ctx context.Context, hash string, content io.Reader, size int64, contentType string) error {
+	unlock := ds.locks.lock(hash)
+	defer unlock()
+
+	refs, err := ds.refs(ctx, hash)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.storage.StatObject(ctx, blobKeyPrefix+hash)
+	switch {
+	case errors.Is(err, models.ErrObjectNotFound):
+		blob := &models.Object{
+			ID:          models.ObjectID(blobKeyPrefix + hash),
+			Content:     content,
+			ContentType: contentType,
+			Size:        size,
+		}
+		if err = ds.storage.PutObject(ctx, blob); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	return ds.setRefs(ctx, hash, refs+1)
+}
+
+// release counts one reference less to a blob, which is left to the garbage collection once unreferenced
+func (ds *DedupStorage) release(ctx context.Context, hash string) error {
+	unlock := ds.locks.lock(hash)
+	defer unlock()
+
+	refs, err := ds.refs(ctx, hash)
+	if err != nil {
+		return err
+	}
+
+	return ds.setRefs(ctx, hash, max(0, refs-1))
+}
+
+// releaseAfterUpdate releases the blob an updated manifest pointed at. The update already happened,
+// so a failure is only logged, the blob keeping a reference too many and never being collected
+func (ds *DedupStorage) releaseAfterUpdate(ctx context.Context, id, hash string) {
+	if err := ds.release(ctx, hash); err != nil {
+		log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not release blob %s of object %s with error %s", hash, id, err))
+	}
+}
+
+func (ds *DedupStorage) refs(ctx context.Context, hash string) (int, error) {
+	record, err := ds.storage.StatObject(ctx, refsKeyPrefix+hash)
+	if err != nil {
+		if errors.Is(err, models.ErrObjectNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	refs, err := strconv.Atoi(record.Metadata[metadataDedupRefs])
+	if err != nil {
+		return 0, fmt.Errorf("references of blob %s not valid", hash)
+	}
+
+	return refs, nil
+}
+
+// setRefs writes the reference record of a blob, removing it when the blob isn't referenced anymore
+func (ds *DedupStorage) setRefs(ctx context.Context, hash string, refs int) error {
+	if refs == 0 {
+		if err := ds.storage.DeleteObject(ctx, refsKeyPrefix+hash); err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	return ds.storage.PutObject(ctx, &models.Object{
+		ID:       models.ObjectID(refsKeyPrefix + hash),
+		Content:  bytes.NewReader(nil),
+		Size:     0,
+		Metadata: map[string]string{metadataDedupRefs: strconv.Itoa(refs)},
+	})
+}
+
+// GetObject reads the blob an object points at, objects stored before deduplication was enabled being returned as they are
+func (ds *DedupStorage) GetObject(ctx context.Context, id string, rng *models.ByteRange) (*models.Object, error) {
+	manifest, err := ds.storage.StatObject(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !isManifest(manifest) {
+		return ds.storage.GetObject(ctx, id, rng)
+	}
+
+	obj, err := ds.storage.GetObject(ctx, blobKeyPrefix+manifest.Metadata[metadataDedupBlob], rng)
+	if err != nil {
+		// a referenced blob is never collected, so a missing one means the object was replaced or deleted meanwhile
+		if errors.Is(err, models.ErrObjectNotFound) {
+			return nil, models.ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	obj.ID = manifest.ID
+	obj.ETag = manifest.Metadata[metadataDedupBlob]
+	obj.ContentType = manifest.ContentType
+	obj.LastModified = manifest.LastModified
+	obj.Metadata = manifestMetadata(manifest.Metadata)
+
+	return obj, nil
+}
+
+// StatObject returns the metadata of an object as recorded by its manifest
+func (ds *DedupStorage) StatObject(ctx context.Context, id string) (*models.Object, error) {
+	manifest, err := ds.storage.StatObject(ctx, id)
+	if err != nil || !isManifest(manifest) {
+		return manifest, err
+	}
+
+	if manifest.Size, err = strconv.ParseInt(manifest.Metadata[metadataDedupSize], 10, 64); err != nil {
+		return nil, fmt.Errorf("size of %s not valid", id)
+	}
+	manifest.ETag = manifest.Metadata[metadataDedupBlob]
+	manifest.Metadata = manifestMetadata(manifest.Metadata)
+
+	return manifest, nil
+}
+
+// DeleteObject removes the manifest of an object and releases its blob
+func (ds *DedupStorage) DeleteObject(ctx context.Context, id string) error {
+	unlock := ds.locks.lock(id)
+	defer unlock()
+
+	manifest, err := ds.storage.StatObject(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err = ds.storage.DeleteObject(ctx, id); err != nil {
+		return err
+	}
+
+	if isManifest(manifest) {
+		ds.releaseAfterUpdate(ctx, id, manifest.Metadata[metadataDedupBlob])
+	}
+
+	return nil
+}
+
+// ListObjects lists objects as their manifests describe them, without blobs and reference records
+func (ds *DedupStorage) ListObjects(ctx context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	objects, err := ds.storage.ListObjects(ctx, prefix, startAfter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return ds.ResolveListing(ctx, objects)
+}
+
+// ResolveListing drops blobs and reference records from a listing page and reads the manifests of the other objects
+func (ds *DedupStorage) ResolveListing(ctx context.Context, objects []*models.Object) ([]*models.Object, error) {
+	visible := make([]*models.Object, 0, len(objects))
+	for _, obj := range objects {
+		if !strings.HasPrefix(obj.ID.Value(), internalKeyPrefix) {
+			visible = append(visible, obj)
+		}
+	}
+
+	return statListing(ctx, visible, ds.StatObject)
+}
+
+// CollectGarbage removes the blobs nothing references anymore once they are older than the grace period,
+// and returns how many blobs were removed
+func (ds *DedupStorage) CollectGarbage(ctx context.Context) (int, error) {
+	removed := 0
+	startAfter := ""
+	for {
+		blobs, err := ds.storage.ListObjects(ctx, blobKeyPrefix, startAfter, dedupListPageSize)
+		if err != nil {
+			return removed, err
+		}
+
+		for _, blob := range blobs {
+			done, err := ds.collectBlob(ctx, strings.TrimPrefix(blob.ID.Value(), blobKeyPrefix))
+			if err != nil {
+				return removed, err
+			}
+			if done {
+				removed++
+			}
+		}
+
+		if len(blobs) < dedupListPageSize {
+			return removed, nil
+		}
+		startAfter = blobs[len(blobs)-1].ID.Value()
+	}
+}
+
+// collectBlob removes a blob when nothing references it, checking it under its lock so that no put references it meanwhile
+func (ds *DedupStorage) collectBlob(ctx context.Context, hash string) (bool, error) {
+	unlock := ds.locks.lock(hash)
+	defer unlock()
+
+	refs, err := ds.refs(ctx, hash)
+	if err != nil || refs > 0 {
+		return false, err
+	}
+
+	blob, err := ds.storage.StatObject(ctx, blobKeyPrefix+hash)
+	if err != nil {
+		if errors.Is(err, models.ErrObjectNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if time.Since(blob.LastModified) < ds.gracePeriod {
+		return false, nil
+	}
+
+	if err = ds.storage.DeleteObject(ctx, blobKeyPrefix+hash); err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (ds *DedupStorage) ID() string {
+	return ds.storage.ID()
+}
+
+func (ds *DedupStorage) IsOnline() bool {
+	return ds.storage.IsOnline()
+}
+
+func isManifest(obj *models.Object) bool {
+	_, ok := obj.Metadata[metadataDedupBlob]
+	return ok
+}
+
+// manifestMetadata returns the metadata of a manifest without the deduplication keys, nil when nothing else is left
+func manifestMetadata(metadata map[string]string) map[string]string {
+	plain := maps.Clone(metadata)
+	delete(plain, metadataDedupBlob)
+	delete(plain, metadataDedupSize)
+
+	if len(plain) == 0 {
+		return nil
+	}
+
+	return plain
+}
+
+// keyLocks serializes the operations on the same key, locks being dropped once nobody holds or waits for them
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu      sync.Mutex
+	holders int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{
+		locks: make(map[string]*keyLock),
+	}
+}
+
+// lock locks a key and returns the function unlocking it
+func (kl *keyLocks) lock(key string) func() {
+	kl.mu.Lock()
+	l, ok := kl.locks[key]
+	if !ok {
+		l = &keyLock{}
+		kl.locks[key] = l
+	}
+	l.holders++
+	kl.mu.Unlock()
+
+	l.mu.Lock()
+
+	return func() {
+		l.mu.Unlock()
+
+		kl.mu.Lock()
+		l.holders--
+		if l.holders == 0 {
+			delete(kl.locks, key)
+		}
+		kl.mu.Unlock()
+	}
+}
@@ -0,0 +1,114 @@
+package services_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestDedupStorageCountsReferences(t *testing.T) {
+	ctx := context.Background()
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	ds := services.NewDedupStorage(node, services.DedupOptions{SpoolDir: t.TempDir()})
+
+	putObject(t, ds, "first", "shared content")
+	putObject(t, ds, "second", "shared content")
+	putObject(t, ds, "third", "other content")
+	if refs := blobRefs(t, node, "shared content"); refs != 2 {
+		t.Fatalf("references of the shared blob = %d, want 2", refs)
+	}
+
+	// an overwrite moves the reference of the object to its new blob
+	putObject(t, ds, "second", "other content")
+	if refs := blobRefs(t, node, "shared content"); refs != 1 {
+		t.Fatalf("references of the shared blob after overwrite = %d, want 1", refs)
+	}
+	if refs := blobRefs(t, node, "other content"); refs != 2 {
+		t.Fatalf("references of the other blob after overwrite = %d, want 2", refs)
+	}
+
+	// overwriting an object with its own content keeps a single reference for it
+	putObject(t, ds, "third", "other content")
+	if refs := blobRefs(t, node, "other content"); refs != 2 {
+		t.Fatalf("references of the other blob after rewrite = %d, want 2", refs)
+	}
+
+	if err := ds.DeleteObject(ctx, "first"); err != nil {
+		t.Fatalf("delete object: %v", err)
+	}
+	if refs := blobRefs(t, node, "shared content"); refs != 0 {
+		t.Fatalf("references of the shared blob after delete = %d, want 0", refs)
+	}
+	if _, err := ds.StatObject(ctx, "first"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("stat error after delete = %v, want %v", err, models.ErrObjectNotFound)
+	}
+
+	if content := getObject(t, ds, "second"); content != "other content" {
+		t.Fatalf("content = %q, want %q", content, "other content")
+	}
+
+	// blobs and reference records are left out of listings
+	objects, err := ds.ListObjects(ctx, "", "", 10)
+	if err != nil {
+		t.Fatalf("list objects: %v", err)
+	}
+	if len(objects) != 2 || objects[0].ID != "second" || objects[1].ID != "third" || objects[0].Size != int64(len("other content")) {
+		t.Fatalf("listed %v, want second and third with their content size", objects)
+	}
+}
+
+func TestDedupStorageKeepsRecentBlobs(t *testing.T) {
+	ctx := context.Background()
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	ds := services.NewDedupStorage(node, services.DedupOptions{SpoolDir: t.TempDir(), GracePeriod: time.Hour})
+
+	putObject(t, ds, "deleted", "recent content")
+	if err := ds.DeleteObject(ctx, "deleted"); err != nil {
+		t.Fatalf("delete object: %v", err)
+	}
+
+	// a blob written within the grace period may be about to be referenced by a put in progress
+	if removed, err := ds.CollectGarbage(ctx); err != nil || removed != 0 {
+		t.Fatalf("collection = %d removed, %v, want the recent blob kept", removed, err)
+	}
+	if _, err := node.StatObject(ctx, blobKey("recent content")); err != nil {
+		t.Fatalf("stat recent blob: %v", err)
+	}
+}
+
+// blobRefs returns the number of references recorded for the blob of content, 0 when it has no reference record
+func blobRefs(t *testing.T, node *object_storage.MemoryObjectStore, content string) int {
+	t.Helper()
+
+	record, err := node.StatObject(context.Background(), "~refs-"+contentHash(content))
+	if errors.Is(err, models.ErrObjectNotFound) {
+		return 0
+	}
+	if err != nil {
+		t.Fatalf("stat reference record: %v", err)
+	}
+
+	refs, err := strconv.Atoi(record.Metadata["Dedup-Refs"])
+	if err != nil {
+		t.Fatalf("reference record not valid: %v", err)
+	}
+
+	return refs
+}
+
+func blobKey(content string) string {
+	return "~blob-" + contentHash(content)
+}
+
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
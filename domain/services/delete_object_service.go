@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+)
+
+type DeleteObjectService struct {
+	storage ports.ObjectStorage
+}
+
+func NewDeleteObjectService(storage ports.ObjectStorage) *DeleteObjectService {
+	return &DeleteObjectService{
+		storage: storage,
+	}
+}
+
+func (dos *DeleteObjectService) DeleteObject(ctx context.Context, objectID models.ObjectID) error {
+	if !objectID.IsValidKey() {
+		return models.ErrObjectIDNotValid
+	}
+
+	return dos.storage.DeleteObject(ctx, objectID.Value())
+}
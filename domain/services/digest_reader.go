@@ -0,0 +1,89 @@
+package services
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"hash"
+	"io"
+
+	"storage-gateway/domain/models"
+)
+
+// digestReader hashes the content read from r and compares it with the expected digests as soon as size bytes have been read,
+// or at the end of the content when its size is unknown. The chunk completing the content is withheld on a mismatch,
+// so that the writer never receives the whole of a corrupted content
+type digestReader struct {
+	r        io.Reader
+	size     int64
+	read     int64
+	expected map[string][]byte
+	hashes   map[string]hash.Hash
+	verified bool
+	mismatch bool
+}
+
+func newDigestReader(r io.Reader, size int64, expected map[string][]byte) *digestReader {
+	hashes := make(map[string]hash.Hash, len(expected))
+	for key := range expected {
+		switch key {
+		case models.MetadataSHA256:
+			hashes[key] = sha256.New()
+		case models.MetadataMD5:
+			hashes[key] = md5.New()
+		}
+	}
+
+	return &digestReader{
+		r:        r,
+		size:     size,
+		expected: expected,
+		hashes:   hashes,
+	}
+}
+
+func (dr *digestReader) Read(p []byte) (int, error) {
+	if dr.mismatch {
+		return 0, models.ErrDigestMismatch
+	}
+
+	n, err := dr.r.Read(p)
+	for _, h := range dr.hashes {
+		h.Write(p[:n])
+	}
+	dr.read += int64(n)
+
+	if err == io.EOF || (dr.size >= 0 && dr.read >= dr.size) {
+		if verifyErr := dr.verify(); verifyErr != nil {
+			return 0, verifyErr
+		}
+	}
+
+	return n, err
+}
+
+// verify compares the digests of the content read so far with the expected ones, only once
+func (dr *digestReader) verify() error {
+	if dr.verified {
+		if dr.mismatch {
+			return models.ErrDigestMismatch
+		}
+		return nil
+	}
+	dr.verified = true
+
+	for key, h := range dr.hashes {
+		if !bytes.Equal(h.Sum(nil), dr.expected[key]) {
+			dr.mismatch = true
+			return models.ErrDigestMismatch
+		}
+	}
+
+	return nil
+}
+
+// digestReadCloser verifies the content of an object while closing its original content
+type digestReadCloser struct {
+	*digestReader
+	io.Closer
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+
+	"storage-gateway/domain/ports"
+)
+
+// EncryptedDiscoveryService wraps every node found by a discovery service in an EncryptedStorage
+type EncryptedDiscoveryService struct {
+	ds        ports.DiscoveryService
+	kms       ports.KeyManagementService
+	chunkSize int
+}
+
+// NewEncryptedDiscoveryService creates a new instance of EncryptedDiscoveryService encrypting the nodes of ds
+func NewEncryptedDiscoveryService(ds ports.DiscoveryService, kms ports.KeyManagementService, chunkSize int) *EncryptedDiscoveryService {
+	return &EncryptedDiscoveryService{
+		ds:        ds,
+		kms:       kms,
+		chunkSize: chunkSize,
+	}
+}
+
+func (eds *EncryptedDiscoveryService) DiscoverNodes(ctx context.Context) ([]ports.ObjectStorage, error) {
+	nodes, err := eds.ds.DiscoverNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]ports.ObjectStorage, 0, len(nodes))
+	for _, node := range nodes {
+		encrypted = append(encrypted, NewEncryptedStorage(node, eds.kms, eds.chunkSize))
+	}
+
+	return encrypted, nil
+}
+
+// Watch forwards the membership changes of the wrapped discovery service, the channel never receiving anything when it can't watch
+func (eds *EncryptedDiscoveryService) Watch(ctx context.Context) (<-chan struct{}, error) {
+	if watcher, ok := eds.ds.(ports.DiscoveryWatcher); ok {
+		return watcher.Watch(ctx)
+	}
+
+	changes := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(changes)
+	}()
+
+	return changes, nil
+}
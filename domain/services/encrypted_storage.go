@@ -0,0 +1,582 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"sync"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+)
+
+const (
+	defaultEncryptionChunkSize = 64 << 10
+	dataKeySize                = 32
+	// gcmOverhead is the size of the authentication tag sealed with every chunk
+	gcmOverhead        = 16
+	rewrapListPageSize = 1000
+)
+
+// Metadata keys recording how an object was encrypted, they are never returned to callers
+const (
+	metadataEncryptionKeyID     = "Encryption-Key-Id"
+	metadataEncryptionKey       = "Encryption-Key"
+	metadataEncryptionChunkSize = "Encryption-Chunk-Size"
+)
+
+// EncryptedStorage encrypts the objects of a storage at rest with AES-256-GCM.
+// Every object has its own data key, wrapped by a master key of the KMS and stored in the object metadata along with the master key ID.
+// Content is sealed in chunks, each authenticated with its index and whether it is the last one, so that range reads only decrypt the chunks they need
+// and reordered or truncated chunks are detected
+type EncryptedStorage struct {
+	storage   ports.ObjectStorage
+	kms       ports.KeyManagementService
+	chunkSize int
+}
+
+// NewEncryptedStorage creates a new instance of EncryptedStorage on top of storage, sealing chunks of chunkSize plaintext bytes,
+// 64KiB when chunkSize is not positive
+func NewEncryptedStorage(storage ports.ObjectStorage, kms ports.KeyManagementService, chunkSize int) *EncryptedStorage {
+	if chunkSize <= 0 {
+		chunkSize = defaultEncryptionChunkSize
+	}
+
+	return &EncryptedStorage{
+		storage:   storage,
+		kms:       kms,
+		chunkSize: chunkSize,
+	}
+}
+
+// PutObject encrypts the object content with a new data key while streaming it to the storage
+func (es *EncryptedStorage) PutObject(ctx context.Context, o *models.Object) error {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+
+	wrapped, keyID, err := es.kms.WrapKey(ctx, dataKey)
+	if err != nil {
+		return fmt.Errorf("wrap data key: %w", err)
+	}
+
+	aead, err := newChunkAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	encrypted := *o
+	encrypted.Content = &encryptReader{r: bufio.NewReader(o.Content), aead: aead, plain: make([]byte, es.chunkSize)}
+	encrypted.Size = encryptedSize(o.Size, es.chunkSize)
+	encrypted.Metadata = maps.Clone(o.Metadata)
+	if encrypted.Metadata == nil {
+		encrypted.Metadata = make(map[string]string, 3)
+	}
+	encrypted.Metadata[metadataEncryptionKeyID] = keyID
+	encrypted.Metadata[metadataEncryptionKey] = base64.StdEncoding.EncodeToString(wrapped)
+	encrypted.Metadata[metadataEncryptionChunkSize] = strconv.Itoa(es.chunkSize)
+
+	return es.storage.PutObject(ctx, &encrypted)
+}
+
+// GetObject decrypts an object, only fetching and decrypting the chunks covering rng when it is not nil.
+// Objects stored before encryption was enabled are returned as they are
+func (es *EncryptedStorage) GetObject(ctx context.Context, id string, rng *models.ByteRange) (*models.Object, error) {
+	if rng == nil {
+		obj, err := es.storage.GetObject(ctx, id, nil)
+		if err != nil || !encrypted(obj) {
+			return obj, err
+		}
+
+		aead, chunkSize, err := es.objectCipher(ctx, obj)
+		if err != nil {
+			closeContent(obj)
+			return nil, err
+		}
+
+		size := decryptedSize(obj.Size, chunkSize)
+		obj.Content = withCloser(&decryptReader{
+			r:     obj.Content,
+			aead:  aead,
+			buf:   make([]byte, chunkSize+gcmOverhead),
+			last:  lastChunk(size, chunkSize),
+			final: lastChunk(size, chunkSize),
+		}, obj.Content)
+		obj.Size = size
+		obj.Metadata = plainMetadata(obj.Metadata)
+
+		return obj, nil
+	}
+
+	stat, err := es.storage.StatObject(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted(stat) {
+		return es.storage.GetObject(ctx, id, rng)
+	}
+
+	_, chunkSize, err := es.objectCipher(ctx, stat)
+	if err != nil {
+		return nil, err
+	}
+
+	size := decryptedSize(stat.Size, chunkSize)
+	if rng.Start < 0 || rng.Start >= size || rng.End < rng.Start {
+		return nil, models.ErrRangeNotSatisfiable
+	}
+	end := min(rng.End, size-1)
+
+	first, last := rng.Start/int64(chunkSize), end/int64(chunkSize)
+	sealedChunk := int64(chunkSize + gcmOverhead)
+	sealedRange := models.ByteRange{Start: first * sealedChunk, End: min((last+1)*sealedChunk, stat.Size) - 1}
+
+	obj, err := es.storage.GetObject(ctx, id, &sealedRange)
+	if err != nil {
+		return nil, err
+	}
+
+	// the data key is read again since the object may have been replaced since it was stat'ed
+	aead, _, err := es.objectCipher(ctx, obj)
+	if err != nil {
+		closeContent(obj)
+		return nil, err
+	}
+
+	dr := &decryptReader{
+		r:     obj.Content,
+		aead:  aead,
+		buf:   make([]byte, chunkSize+gcmOverhead),
+		index: uint64(first),
+		last:  uint64(last),
+		final: lastChunk(size, chunkSize),
+	}
+	if _, err = io.CopyN(io.Discard, dr, rng.Start-first*int64(chunkSize)); err != nil {
+		closeContent(obj)
+		return nil, err
+	}
+
+	obj.Content = withCloser(io.LimitReader(dr, end-rng.Start+1), obj.Content)
+	obj.Size = size
+	obj.Range = &models.ByteRange{Start: rng.Start, End: end}
+	obj.Metadata = plainMetadata(obj.Metadata)
+
+	return obj, nil
+}
+
+// StatObject returns the metadata of an object with its decrypted size
+func (es *EncryptedStorage) StatObject(ctx context.Context, id string) (*models.Object, error) {
+	obj, err := es.storage.StatObject(ctx, id)
+	if err != nil || !encrypted(obj) {
+		return obj, err
+	}
+
+	chunkSize, err := objectChunkSize(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	obj.Size = decryptedSize(obj.Size, chunkSize)
+	obj.Metadata = plainMetadata(obj.Metadata)
+
+	return obj, nil
+}
+
+func (es *EncryptedStorage) DeleteObject(ctx context.Context, id string) error {
+	return es.storage.DeleteObject(ctx, id)
+}
+
+// ListObjects lists objects with their decrypted size. Listings carry no metadata, so every listed object is stat'ed
+// to tell whether it is encrypted and with which chunk size. Objects deleted since they were listed keep their stored size,
+// so that pages keep their length for the callers paging through them
+func (es *EncryptedStorage) ListObjects(ctx context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	objects, err := es.storage.ListObjects(ctx, prefix, startAfter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(objects))
+	sem := make(chan struct{}, statListingConcurrency)
+	var wg sync.WaitGroup
+	for i, obj := range objects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, obj *models.Object) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			stat, err := es.StatObject(ctx, obj.ID.Value())
+			switch {
+			case err == nil:
+				obj.Size = stat.Size
+			case !errors.Is(err, models.ErrObjectNotFound):
+				errs[i] = err
+			}
+		}(i, obj)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return objects, nil
+}
+
+// Rewrap wraps the data key of an object with the current master key when it was wrapped with another one, and tells whether it did.
+// Only the metadata of the object is replaced, on the condition that the object wasn't written since it was stat'ed,
+// objects written in the meantime being skipped since they already have a data key wrapped with the current master key
+func (es *EncryptedStorage) Rewrap(ctx context.Context, id string) (bool, error) {
+	replacer, ok := nodeAs[ports.MetadataReplacer](es.storage)
+	if !ok {
+		return false, models.ErrMetadataNotSupported
+	}
+
+	obj, err := es.storage.StatObject(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	if !encrypted(obj) || obj.Metadata[metadataEncryptionKeyID] == es.kms.CurrentKeyID() {
+		return false, nil
+	}
+
+	dataKey, err := es.dataKey(ctx, obj)
+	if err != nil {
+		return false, err
+	}
+
+	wrapped, keyID, err := es.kms.WrapKey(ctx, dataKey)
+	if err != nil {
+		return false, fmt.Errorf("wrap data key: %w", err)
+	}
+
+	obj.Metadata[metadataEncryptionKeyID] = keyID
+	obj.Metadata[metadataEncryptionKey] = base64.StdEncoding.EncodeToString(wrapped)
+
+	if err = replacer.ReplaceMetadata(ctx, obj); err != nil {
+		if errors.Is(err, models.ErrObjectModified) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RewrapAll re-wraps the data keys of every object of the storage that isn't wrapped with the current master key,
+// and returns how many objects were re-wrapped and how many failed
+func (es *EncryptedStorage) RewrapAll(ctx context.Context) (rewrapped, failed int, err error) {
+	startAfter := ""
+	for {
+		objects, err := es.storage.ListObjects(ctx, "", startAfter, rewrapListPageSize)
+		if err != nil {
+			return rewrapped, failed, err
+		}
+
+		for _, obj := range objects {
+			done, err := es.Rewrap(ctx, obj.ID.Value())
+			switch {
+			case errors.Is(err, models.ErrObjectNotFound):
+			case err != nil:
+				failed++
+			case done:
+				rewrapped++
+			}
+		}
+
+		if len(objects) < rewrapListPageSize {
+			return rewrapped, failed, nil
+		}
+		startAfter = objects[len(objects)-1].ID.Value()
+	}
+}
+
+func (es *EncryptedStorage) ID() string {
+	return es.storage.ID()
+}
+
+func (es *EncryptedStorage) IsOnline() bool {
+	return es.storage.IsOnline()
+}
+
+// Weight returns the weight of the underlying node, one when it has none
+func (es *EncryptedStorage) Weight() int {
+	if metadata, ok := es.storage.(ports.NodeMetadata); ok {
+		return metadata.Weight()
+	}
+
+	return 1
+}
+
+// Zone returns the zone of the underlying node
+func (es *EncryptedStorage) Zone() string {
+	if metadata, ok := es.storage.(ports.NodeMetadata); ok {
+		return metadata.Zone()
+	}
+
+	return ""
+}
+
+// objectCipher returns the cipher of the data key of an encrypted object and its chunk size
+func (es *EncryptedStorage) objectCipher(ctx context.Context, obj *models.Object) (cipher.AEAD, int, error) {
+	chunkSize, err := objectChunkSize(obj)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dataKey, err := es.dataKey(ctx, obj)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	aead, err := newChunkAEAD(dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return aead, chunkSize, nil
+}
+
+// dataKey unwraps the data key of an encrypted object
+func (es *EncryptedStorage) dataKey(ctx context.Context, obj *models.Object) ([]byte, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(obj.Metadata[metadataEncryptionKey])
+	if err != nil {
+		return nil, fmt.Errorf("data key of %s: %w", obj.ID, err)
+	}
+
+	dataKey, err := es.kms.UnwrapKey(ctx, obj.Metadata[metadataEncryptionKeyID], wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key of %s: %w", obj.ID, err)
+	}
+
+	return dataKey, nil
+}
+
+func encrypted(obj *models.Object) bool {
+	_, ok := obj.Metadata[metadataEncryptionKey]
+	return ok
+}
+
+func objectChunkSize(obj *models.Object) (int, error) {
+	chunkSize, err := strconv.Atoi(obj.Metadata[metadataEncryptionChunkSize])
+	if err != nil || chunkSize <= 0 {
+		return 0, fmt.Errorf("chunk size of %s not valid", obj.ID)
+	}
+
+	return chunkSize, nil
+}
+
+// plainMetadata returns the metadata without the encryption keys, nil when nothing else is left
+func plainMetadata(metadata map[string]string) map[string]string {
+	plain := maps.Clone(metadata)
+	delete(plain, metadataEncryptionKeyID)
+	delete(plain, metadataEncryptionKey)
+	delete(plain, metadataEncryptionChunkSize)
+
+	if len(plain) == 0 {
+		return nil
+	}
+
+	return plain
+}
+
+func newChunkAEAD(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptedSize returns the stored size of a plaintext of the given size, unknown when the plaintext size is.
+// An empty plaintext is still sealed in one chunk
+func encryptedSize(size int64, chunkSize int) int64 {
+	if size < 0 {
+		return -1
+	}
+
+	chunks := max(1, (size+int64(chunkSize)-1)/int64(chunkSize))
+
+	return size + chunks*gcmOverhead
+}
+
+// decryptedSize returns the plaintext size of a stored content of the given size
+func decryptedSize(size int64, chunkSize int) int64 {
+	sealedChunk := int64(chunkSize + gcmOverhead)
+	chunks := (size + sealedChunk - 1) / sealedChunk
+
+	return max(0, size-chunks*gcmOverhead)
+}
+
+// lastChunk returns the index of the last chunk of a plaintext of the given size
+func lastChunk(size int64, chunkSize int) uint64 {
+	if size == 0 {
+		return 0
+	}
+
+	return uint64((size - 1) / int64(chunkSize))
+}
+
+// chunkNonce derives the nonce of a chunk from its index, data keys being used for a single object
+func chunkNonce(aead cipher.AEAD, index uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+
+	return nonce
+}
+
+// chunkAAD authenticates the position of a chunk
+func chunkAAD(index uint64, last bool) []byte {
+	aad := binary.BigEndian.AppendUint64(nil, index)
+	if last {
+		return append(aad, 1)
+	}
+
+	return append(aad, 0)
+}
+
+// encryptReader seals the plaintext read from r chunk by chunk
+type encryptReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	plain []byte
+	// sealed is the part of the current sealed chunk not read yet
+	sealed []byte
+	index  uint64
+	done   bool
+}
+
+func (er *encryptReader) Read(p []byte) (int, error) {
+	for len(er.sealed) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+
+		if err := er.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, er.sealed)
+	er.sealed = er.sealed[n:]
+
+	return n, nil
+}
+
+// sealChunk reads and seals the next chunk, peeking past it to tell whether it is the last one
+func (er *encryptReader) sealChunk() error {
+	n, err := io.ReadFull(er.r, er.plain)
+
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err = er.r.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	er.sealed = er.aead.Seal(er.sealed[:0], chunkNonce(er.aead, er.index), er.plain[:n], chunkAAD(er.index, last))
+	er.index++
+	er.done = last
+
+	return nil
+}
+
+// decryptReader opens the sealed chunks read from r, from chunk index up to chunk last.
+// final is the index of the last chunk of the whole object, which was sealed as such
+type decryptReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	buf   []byte
+	plain []byte
+	index uint64
+	last  uint64
+	final uint64
+	done  bool
+	err   error
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		if dr.done {
+			return 0, io.EOF
+		}
+
+		if dr.err = dr.openChunk(); dr.err != nil {
+			return 0, dr.err
+		}
+	}
+
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+
+	return n, nil
+}
+
+// openChunk reads and opens the next chunk, failing with models.ErrDigestMismatch when it was altered, moved or truncated
+func (dr *decryptReader) openChunk() error {
+	n, err := io.ReadFull(dr.r, dr.buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return models.ErrDigestMismatch
+		}
+		return err
+	}
+
+	plain, err := dr.aead.Open(dr.buf[:0], chunkNonce(dr.aead, dr.index), dr.buf[:n], chunkAAD(dr.index, dr.index == dr.final))
+	if err != nil {
+		return models.ErrDigestMismatch
+	}
+
+	dr.plain = plain
+	dr.done = dr.index == dr.last
+	dr.index++
+
+	return nil
+}
+
+// closeContent closes the content of an object when it can be closed
+func closeContent(obj *models.Object) {
+	if closer, ok := obj.Content.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// withCloser returns r closing the original content of an object when it can be closed
+func withCloser(r io.Reader, original io.Reader) io.Reader {
+	if closer, ok := original.(io.Closer); ok {
+		return readCloser{Reader: r, Closer: closer}
+	}
+
+	return r
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
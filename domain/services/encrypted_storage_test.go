@@ -0,0 +1,159 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+// rotatingKMS wraps data keys by prefixing them with the ID of the current master key
+type rotatingKMS struct {
+	current string
+}
+
+func (k *rotatingKMS) WrapKey(_ context.Context, plaintext []byte) ([]byte, string, error) {
+	return append([]byte(k.current), plaintext...), k.current, nil
+}
+
+func (k *rotatingKMS) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if !bytes.HasPrefix(wrapped, []byte(keyID)) {
+		return nil, fmt.Errorf("data key not wrapped with master key %s", keyID)
+	}
+
+	return wrapped[len(keyID):], nil
+}
+
+func (k *rotatingKMS) CurrentKeyID() string {
+	return k.current
+}
+
+func TestEncryptedStorageRewrapsDataKeys(t *testing.T) {
+	ctx := context.Background()
+	kms := &rotatingKMS{current: "old"}
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	es := services.NewEncryptedStorage(object_storage.WithNodeMetadata(node, 1, ""), kms, 4)
+
+	putObject(t, es, "rewrapped", "encrypted content")
+	before, err := node.StatObject(ctx, "rewrapped")
+	if err != nil {
+		t.Fatalf("stat object: %v", err)
+	}
+
+	kms.current = "new"
+	rewrapped, failed, err := es.RewrapAll(ctx)
+	if err != nil || rewrapped != 1 || failed != 0 {
+		t.Fatalf("rewrap all = %d rewrapped, %d failed, %v, want 1 rewrapped", rewrapped, failed, err)
+	}
+
+	// only the metadata is replaced, the content sealed with the data key being kept
+	after, err := node.StatObject(ctx, "rewrapped")
+	if err != nil {
+		t.Fatalf("stat rewrapped object: %v", err)
+	}
+	if after.ETag != before.ETag {
+		t.Fatalf("ETag after rewrap = %s, want the unchanged %s", after.ETag, before.ETag)
+	}
+	if after.Metadata["Encryption-Key-Id"] != "new" {
+		t.Fatalf("master key ID after rewrap = %q, want %q", after.Metadata["Encryption-Key-Id"], "new")
+	}
+	if content := getObject(t, es, "rewrapped"); content != "encrypted content" {
+		t.Fatalf("content = %q, want %q", content, "encrypted content")
+	}
+
+	if done, err := es.Rewrap(ctx, "rewrapped"); err != nil || done {
+		t.Fatalf("second rewrap = %t, %v, want nothing to do", done, err)
+	}
+}
+
+func TestEncryptedStorageRewrapSkipsNewerWrites(t *testing.T) {
+	ctx := context.Background()
+	kms := &rotatingKMS{current: "old"}
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	racing := &writeAfterStat{ObjectStorage: node}
+	es := services.NewEncryptedStorage(racing, kms, 4)
+
+	putObject(t, es, "raced", "old content")
+
+	// a client write lands between the stat of the rewrap and its metadata replacement
+	kms.current = "new"
+	racing.write = func() { putObject(t, es, "raced", "new content") }
+
+	done, err := es.Rewrap(ctx, "raced")
+	if err != nil || done {
+		t.Fatalf("rewrap = %t, %v, want the object skipped", done, err)
+	}
+	if content := getObject(t, es, "raced"); content != "new content" {
+		t.Fatalf("content = %q, want the newer write %q", content, "new content")
+	}
+}
+
+func TestEncryptedStorageRewrapRequiresMetadataReplacement(t *testing.T) {
+	kms := &rotatingKMS{current: "old"}
+	es := services.NewEncryptedStorage(storageOnly{object_storage.NewMemoryObjectStore("node", 0)}, kms, 4)
+
+	putObject(t, es, "stored", "content")
+	kms.current = "new"
+
+	if _, err := es.Rewrap(context.Background(), "stored"); !errors.Is(err, models.ErrMetadataNotSupported) {
+		t.Fatalf("rewrap error = %v, want %v", err, models.ErrMetadataNotSupported)
+	}
+	if content := getObject(t, es, "stored"); content != "content" {
+		t.Fatalf("content = %q, want %q", content, "content")
+	}
+}
+
+func TestEncryptedStorageListsDecryptedSizes(t *testing.T) {
+	ctx := context.Background()
+	kms := &rotatingKMS{current: "key"}
+	node := object_storage.NewMemoryObjectStore("node", 0)
+
+	// objects written before encryption was enabled, and with another chunk size, are listed with their size as well
+	putObject(t, node, "plaintext", "written before encryption")
+	putObject(t, services.NewEncryptedStorage(node, kms, 4), "small-chunks", "sealed in chunks of four bytes")
+	es := services.NewEncryptedStorage(node, kms, 64)
+	putObject(t, es, "large-chunks", "sealed in a single chunk")
+
+	objects, err := es.ListObjects(ctx, "", "", 10)
+	if err != nil {
+		t.Fatalf("list objects: %v", err)
+	}
+	if len(objects) != 3 {
+		t.Fatalf("listed %d objects, want 3", len(objects))
+	}
+	for _, obj := range objects {
+		stat, err := es.StatObject(ctx, obj.ID.Value())
+		if err != nil {
+			t.Fatalf("stat %s: %v", obj.ID, err)
+		}
+		if content := getObject(t, es, obj.ID.Value()); obj.Size != stat.Size || obj.Size != int64(len(content)) {
+			t.Fatalf("listed size of %s = %d, want %d like its stat and content", obj.ID, obj.Size, len(content))
+		}
+	}
+}
+
+// writeAfterStat runs write once, right after the next stat of the node
+type writeAfterStat struct {
+	ports.ObjectStorage
+	write func()
+}
+
+func (w *writeAfterStat) StatObject(ctx context.Context, id string) (*models.Object, error) {
+	obj, err := w.ObjectStorage.StatObject(ctx, id)
+	if write := w.write; write != nil {
+		w.write = nil
+		write()
+	}
+
+	return obj, err
+}
+
+func (w *writeAfterStat) Unwrap() ports.ObjectStorage {
+	return w.ObjectStorage
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"github.com/go-co-op/gocron"
+	"github.com/google/uuid"
+)
+
+const defaultRepairInterval = time.Hour
+
+// ErasureRepairService periodically rebuilds the missing shards of the objects of an ErasureStorage
+type ErasureRepairService struct {
+	storage   *ErasureStorage
+	scheduler *gocron.Scheduler
+	interval  time.Duration
+}
+
+// NewErasureRepairService creates a new instance of ErasureRepairService repairing objects at the given interval
+func NewErasureRepairService(storage *ErasureStorage, interval time.Duration) *ErasureRepairService {
+	if interval <= 0 {
+		interval = defaultRepairInterval
+	}
+
+	return &ErasureRepairService{
+		storage:   storage,
+		scheduler: gocron.NewScheduler(time.UTC),
+		interval:  interval,
+	}
+}
+
+// StartRepairing starts a periodic task repairing every object, a pass not starting while the previous one runs
+func (ers *ErasureRepairService) StartRepairing() error {
+	_, err := ers.scheduler.Every(ers.interval).SingletonMode().Do(func() {
+		ctx := context_wrapper.WithCorrelationID(context.Background(), uuid.New().String())
+
+		ers.RepairShards(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	ers.scheduler.StartAsync()
+
+	return nil
+}
+
+// RepairShards runs a repair pass, objects failing to be repaired being retried on the next one
+func (ers *ErasureRepairService) RepairShards(ctx context.Context) {
+	correlationID := context_wrapper.GetCorrelationID(ctx)
+
+	rebuilt, failed, err := ers.storage.RepairAll(ctx)
+	if err != nil {
+		log.Warnt(correlationID, fmt.Sprintf("could not list the objects to repair with error %s", err))
+	}
+	if rebuilt > 0 || failed > 0 {
+		log.Infot(correlationID, fmt.Sprintf("rebuilt %d shards, %d objects could not be repaired", rebuilt, failed))
+	}
+}
+
+// StopRepairing stops the periodic repair task
+func (ers *ErasureRepairService) StopRepairing() {
+	ers.scheduler.Stop()
+}
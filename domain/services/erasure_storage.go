@@ -0,0 +1,1003 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/reedsolomon"
+)
+
+const (
+	defaultErasureChunkSize = 64 << 10
+	erasureListPageSize     = 1000
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type ErasureOptions struct {
+	DataShards   int
+	ParityShards int
+	// WriteQuorum is the number of shards a write must store, one more than DataShards by default
+	WriteQuorum int
+	// ChunkSize is the number of bytes every stripe adds to each shard, 64KiB by default
+	ChunkSize int
+	// SpoolDir holds the uploads of unknown size until their size is known, the system temporary directory when empty
+	SpoolDir string
+}
+
+// ErasureStorage splits every object into data shards and Reed-Solomon parity shards stored under the object ID
+// on distinct nodes of the ring. Any DataShards shards of a write rebuild the object, so objects stay readable
+// while up to ParityShards of their nodes are offline, and chunks failing their checksum are rebuilt from the other shards.
+// Every shard carries the manifest of the write in its metadata
+type ErasureStorage struct {
+	nps          *NodePoolService
+	encoder      reedsolomon.Encoder
+	dataShards   int
+	parityShards int
+	writeQuorum  int
+	chunkSize    int
+	spoolDir     string
+}
+
+// NewErasureStorage creates a new instance of ErasureStorage placing shards on the nodes of nps
+func NewErasureStorage(nps *NodePoolService, opts ErasureOptions) (*ErasureStorage, error) {
+	if opts.WriteQuorum == 0 {
+		opts.WriteQuorum = min(opts.DataShards+1, opts.DataShards+opts.ParityShards)
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultErasureChunkSize
+	}
+
+	if opts.DataShards < 1 || opts.ParityShards < 1 || opts.WriteQuorum < opts.DataShards || opts.WriteQuorum > opts.DataShards+opts.ParityShards {
+		return nil, fmt.Errorf("invalid erasure coding k=%d m=%d W=%d", opts.DataShards, opts.ParityShards, opts.WriteQuorum)
+	}
+
+	encoder, err := reedsolomon.New(opts.DataShards, opts.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ErasureStorage{
+		nps:          nps,
+		encoder:      encoder,
+		dataShards:   opts.DataShards,
+		parityShards: opts.ParityShards,
+		writeQuorum:  opts.WriteQuorum,
+		chunkSize:    opts.ChunkSize,
+		spoolDir:     opts.SpoolDir,
+	}, nil
+}
+
+// PutObject encodes the object into shards streamed to the first DataShards+ParityShards nodes of the ring for its ID,
+// and succeeds once the write quorum of shards is stored. Objects of unknown size are spooled first
+func (es *ErasureStorage) PutObject(ctx context.Context, o *models.Object) error {
+	if o.Size < 0 {
+		spooled, cleanup, err := es.spool(o)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		o = spooled
+	}
+
+	shards := es.dataShards + es.parityShards
+	nodes, err := es.nps.GetNodes(o.ID.Value(), shards)
+	if err != nil {
+		return err
+	}
+	if len(nodes) < shards {
+		return fmt.Errorf("erasure coding needs %d nodes, the pool has %d", shards, len(nodes))
+	}
+	if len(onlineNodes(nodes)) < es.writeQuorum {
+		return models.ErrObjectStorageNotAvailable
+	}
+
+	manifest := models.ShardManifest{
+		DataShards:   es.dataShards,
+		ParityShards: es.parityShards,
+		ChunkSize:    es.chunkSize,
+		Size:         o.Size,
+		Version:      uuid.New().String(),
+		Nodes:        nodeIDs(nodes),
+	}
+
+	writers := make([]*io.PipeWriter, shards)
+	errs := make([]error, shards)
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		if !node.IsOnline() {
+			errs[i] = models.ErrObjectStorageNotAvailable
+			continue
+		}
+
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		shard := shardObject(o.ID, o.ContentType, o.Metadata, manifest, i)
+		shard.Content = pr
+
+		wg.Add(1)
+		go func(i int, node ports.ObjectStorage, shard *models.Object, pr *io.PipeReader) {
+			defer wg.Done()
+
+			errs[i] = node.PutObject(ctx, shard)
+			// unblocks the encoder when the node gave up before reading the whole shard
+			pr.CloseWithError(fmt.Errorf("shard %d on %s: %w", i, node.ID(), errorOrClosed(errs[i])))
+		}(i, node, shard, pr)
+	}
+
+	encodeErr := es.encode(o.Content, &manifest, writers)
+	for _, pw := range writers {
+		if pw != nil {
+			pw.CloseWithError(encodeErr)
+		}
+	}
+	wg.Wait()
+
+	if encodeErr != nil && !errors.Is(encodeErr, errQuorumLost) {
+		return encodeErr
+	}
+
+	acks, firstErr := 0, error(nil)
+	for i, err := range errs {
+		if err == nil {
+			acks++
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not write shard %d of object %s to node %s with error %s", i, o.ID.Value(), nodes[i].ID(), err))
+	}
+
+	if acks < es.writeQuorum {
+		if firstErr == nil {
+			firstErr = models.ErrObjectStorageNotAvailable
+		}
+		return fmt.Errorf("write quorum not reached (%d/%d): %w", acks, es.writeQuorum, firstErr)
+	}
+
+	return nil
+}
+
+// spool copies content of unknown size to a temporary file, and returns the object reading it with its size
+func (es *ErasureStorage) spool(o *models.Object) (*models.Object, func(), error) {
+	f, err := os.CreateTemp(es.spoolDir, "erasure-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	size, err := io.Copy(f, o.Content)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	spooled := *o
+	spooled.Content = f
+	spooled.Size = size
+
+	return &spooled, cleanup, nil
+}
+
+// encode splits the content into stripes and writes to every shard its chunk of each stripe followed by the chunk checksum.
+// A failing shard is dropped, and encoding only fails once fewer shards than the write quorum remain
+func (es *ErasureStorage) encode(content io.Reader, manifest *models.ShardManifest, writers []*io.PipeWriter) error {
+	writers = slices.Clone(writers)
+	alive := 0
+	for _, w := range writers {
+		if w != nil {
+			alive++
+		}
+	}
+
+	stripe := make([]byte, es.dataShards*es.chunkSize)
+	chunks := make([][]byte, len(writers))
+	for i := range chunks {
+		if i < es.dataShards {
+			chunks[i] = stripe[i*es.chunkSize : (i+1)*es.chunkSize]
+		} else {
+			chunks[i] = make([]byte, es.chunkSize)
+		}
+	}
+	checksum := make([]byte, models.ChecksumSize)
+
+	remaining := manifest.Size
+	for s := int64(0); s < manifest.Stripes(); s++ {
+		n := min(remaining, int64(len(stripe)))
+		if _, err := io.ReadFull(content, stripe[:n]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return fmt.Errorf("object content is shorter than its size %d", manifest.Size)
+			}
+			return err
+		}
+		// the last stripe is zero padded
+		clear(stripe[n:])
+		remaining -= n
+
+		if err := es.encoder.Encode(chunks); err != nil {
+			return err
+		}
+
+		for i, w := range writers {
+			if w == nil {
+				continue
+			}
+
+			binary.BigEndian.PutUint32(checksum, crc32.Checksum(chunks[i], castagnoli))
+			_, err := w.Write(chunks[i])
+			if err == nil {
+				_, err = w.Write(checksum)
+			}
+			if err != nil {
+				writers[i] = nil
+				alive--
+			}
+		}
+
+		if alive < es.writeQuorum {
+			return errQuorumLost
+		}
+	}
+
+	if n, _ := io.ReadFull(content, checksum[:1]); n > 0 {
+		return fmt.Errorf("object content is larger than its size %d", manifest.Size)
+	}
+
+	return nil
+}
+
+// GetObject rebuilds an object from the shards of its newest readable write, only reading the stripes covering rng when it is not nil
+func (es *ErasureStorage) GetObject(ctx context.Context, id string, rng *models.ByteRange) (*models.Object, error) {
+	set, err := es.locate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := set.object(id)
+	start, end := int64(0), set.manifest.Size-1
+	if rng != nil {
+		if rng.Start < 0 || rng.Start >= set.manifest.Size || rng.End < rng.Start {
+			return nil, models.ErrRangeNotSatisfiable
+		}
+		start, end = rng.Start, min(rng.End, set.manifest.Size-1)
+		obj.Range = &models.ByteRange{Start: start, End: end}
+	}
+
+	if set.manifest.Size == 0 {
+		obj.Content = bytes.NewReader(nil)
+		return obj, nil
+	}
+
+	encoder, err := es.encoderFor(set.manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	stripeSize := int64(set.manifest.DataShards * set.manifest.ChunkSize)
+	er := newErasureReader(ctx, encoder, id, set, start/stripeSize, end/stripeSize)
+	if _, err = io.CopyN(io.Discard, er, start-er.stripe*stripeSize); err != nil {
+		er.Close()
+		return nil, err
+	}
+
+	obj.Content = readCloser{Reader: io.LimitReader(er, end-start+1), Closer: er}
+
+	return obj, nil
+}
+
+// StatObject returns the metadata of the newest readable write of an object
+func (es *ErasureStorage) StatObject(ctx context.Context, id string) (*models.Object, error) {
+	set, err := es.locate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return set.object(id), nil
+}
+
+// DeleteObject removes the shards of an object from the nodes of the ring for its ID and from the nodes holding its shards,
+// and succeeds when at least W of them no longer hold it
+func (es *ErasureStorage) DeleteObject(ctx context.Context, id string) error {
+	candidates, err := es.nps.GetNodes(id, es.dataShards+es.parityShards)
+	if err != nil {
+		return err
+	}
+
+	found, _ := es.findShards(ctx, id, candidates)
+	nodes := candidates
+	for _, shard := range found {
+		if !slices.ContainsFunc(nodes, func(node ports.ObjectStorage) bool { return node.ID() == shard.node.ID() }) {
+			nodes = append(nodes, shard.node)
+		}
+	}
+
+	nodes = onlineNodes(nodes)
+	if len(nodes) < es.writeQuorum {
+		return models.ErrObjectStorageNotAvailable
+	}
+
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node ports.ObjectStorage) {
+			defer wg.Done()
+			errs[i] = node.DeleteObject(ctx, id)
+		}(i, node)
+	}
+	wg.Wait()
+
+	acks, deleted, firstErr := 0, 0, error(nil)
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			acks++
+			deleted++
+		case errors.Is(err, models.ErrObjectNotFound):
+			acks++
+		case firstErr == nil:
+			firstErr = err
+		}
+	}
+
+	if acks < es.writeQuorum {
+		if firstErr == nil {
+			firstErr = models.ErrObjectStorageNotAvailable
+		}
+		return fmt.Errorf("write quorum not reached (%d/%d): %w", acks, es.writeQuorum, firstErr)
+	}
+
+	if deleted == 0 {
+		return models.ErrObjectNotFound
+	}
+
+	return nil
+}
+
+// ListObjects merges the listings of every node of the pool, reporting every object once with its own size
+func (es *ErasureStorage) ListObjects(ctx context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	shards, err := es.listShards(ctx, prefix, startAfter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return es.ResolveListing(ctx, shards)
+}
+
+// ResolveListing replaces the shards of a listing page with the objects they belong to
+func (es *ErasureStorage) ResolveListing(ctx context.Context, objects []*models.Object) ([]*models.Object, error) {
+	return statListing(ctx, objects, es.StatObject)
+}
+
+// listShards merges the shard listings of every node of the pool, reporting the shards of an object once
+func (es *ErasureStorage) listShards(ctx context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	nodes := es.nps.Nodes()
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no nodes in the pool")
+	}
+
+	positions := make(listCursor, len(nodes))
+	for _, node := range nodes {
+		positions[node.ID()] = startAfter
+	}
+
+	pages, err := listNodePages(ctx, nodes, prefix, positions, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeObjectPages(nodes, pages, limit, positions), nil
+}
+
+// RepairObject rebuilds the missing shards of the newest write of an object on online nodes holding none of its shards,
+// preferring the nodes of the ring for its ID, and returns how many shards were rebuilt.
+// Shards of offline nodes of the pool are left alone since they come back with their node.
+// Shards of older writes are removed once the object is complete
+func (es *ErasureStorage) RepairObject(ctx context.Context, id string) (int, error) {
+	set, err := es.locate(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	manifest := *set.manifest
+	shards := manifest.DataShards + manifest.ParityShards
+	manifest.Nodes = slices.Grow(slices.Clone(manifest.Nodes), shards)[:shards]
+
+	missing := make([]int, 0)
+	for index := 0; index < shards; index++ {
+		if _, ok := set.shards[index]; ok {
+			continue
+		}
+		if node, ok := es.nps.NodeByID(manifest.Nodes[index]); ok && !node.IsOnline() {
+			continue
+		}
+		missing = append(missing, index)
+	}
+
+	if len(missing) == 0 {
+		es.removeStaleShards(ctx, id, set)
+		return 0, nil
+	}
+
+	targets, err := es.repairTargets(id, set, len(missing))
+	if err != nil {
+		return 0, err
+	}
+	missing = missing[:len(targets)]
+	for i, index := range missing {
+		manifest.Nodes[index] = targets[i].ID()
+	}
+
+	writers := make([]*io.PipeWriter, len(missing))
+	errs := make([]error, len(missing))
+
+	var wg sync.WaitGroup
+	for i, index := range missing {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		shard := shardObject(models.ObjectID(id), set.contentType, set.metadata, manifest, index)
+		shard.Content = pr
+
+		wg.Add(1)
+		go func(i int, node ports.ObjectStorage, shard *models.Object, pr *io.PipeReader) {
+			defer wg.Done()
+
+			errs[i] = node.PutObject(ctx, shard)
+			pr.CloseWithError(fmt.Errorf("shard on %s: %w", node.ID(), errorOrClosed(errs[i])))
+		}(i, targets[i], shard, pr)
+	}
+
+	rebuildErr := es.rebuild(ctx, id, set, missing, writers)
+	for _, pw := range writers {
+		pw.CloseWithError(rebuildErr)
+	}
+	wg.Wait()
+
+	if rebuildErr != nil {
+		return 0, rebuildErr
+	}
+
+	rebuilt := 0
+	for i, err := range errs {
+		if err != nil {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not rebuild shard %d of object %s on node %s with error %s", missing[i], id, targets[i].ID(), err))
+			continue
+		}
+		rebuilt++
+	}
+
+	if rebuilt == len(missing) {
+		es.removeStaleShards(ctx, id, set)
+	}
+
+	return rebuilt, nil
+}
+
+// rebuild reads the object stripe by stripe and writes the rebuilt chunks of the missing shards followed by their checksum
+func (es *ErasureStorage) rebuild(ctx context.Context, id string, set *shardSet, missing []int, writers []*io.PipeWriter) error {
+	if set.manifest.Size == 0 {
+		return nil
+	}
+
+	encoder, err := es.encoderFor(set.manifest)
+	if err != nil {
+		return err
+	}
+
+	er := newErasureReader(ctx, encoder, id, set, 0, set.manifest.Stripes()-1)
+	defer er.Close()
+
+	checksum := make([]byte, models.ChecksumSize)
+	for er.stripe <= er.last {
+		chunks, err := er.readStripe()
+		if err != nil {
+			return err
+		}
+
+		if err = encoder.Reconstruct(chunks); err != nil {
+			return err
+		}
+
+		for i, index := range missing {
+			binary.BigEndian.PutUint32(checksum, crc32.Checksum(chunks[index], castagnoli))
+			// a failing target is only reported once its put returns
+			if _, err = writers[i].Write(chunks[index]); err == nil {
+				writers[i].Write(checksum)
+			}
+		}
+	}
+
+	return nil
+}
+
+// repairTargets returns up to n online nodes holding no shard of the newest write of an object, the nodes of the ring for its ID first
+func (es *ErasureStorage) repairTargets(id string, set *shardSet, n int) ([]ports.ObjectStorage, error) {
+	nodes, err := es.nps.GetNodes(id, len(es.nps.Nodes()))
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]ports.ObjectStorage, 0, n)
+	for _, node := range onlineNodes(nodes) {
+		if len(targets) == n {
+			break
+		}
+		if !set.holds(node.ID()) {
+			targets = append(targets, node)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no node left to rebuild the shards of object %s", id)
+	}
+
+	return targets, nil
+}
+
+// removeStaleShards removes the shards of writes older than the newest readable one.
+// Newer shards are kept, as they may belong to a write in progress
+func (es *ErasureStorage) removeStaleShards(ctx context.Context, id string, set *shardSet) {
+	for _, shard := range set.stale {
+		if !shard.obj.LastModified.Before(set.lastModified) || set.holds(shard.node.ID()) {
+			continue
+		}
+
+		if err := shard.node.DeleteObject(ctx, id); err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not remove stale shard of object %s from node %s with error %s", id, shard.node.ID(), err))
+		}
+	}
+}
+
+// RepairAll repairs every object of the pool, and returns how many shards were rebuilt and how many objects failed
+func (es *ErasureStorage) RepairAll(ctx context.Context) (rebuilt, failed int, err error) {
+	startAfter := ""
+	for {
+		shards, err := es.listShards(ctx, "", startAfter, erasureListPageSize)
+		if err != nil {
+			return rebuilt, failed, err
+		}
+
+		for _, shard := range shards {
+			n, err := es.RepairObject(ctx, shard.ID.Value())
+			switch {
+			case errors.Is(err, models.ErrObjectNotFound):
+			case err != nil:
+				log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not repair object %s with error %s", shard.ID.Value(), err))
+				failed++
+			default:
+				rebuilt += n
+			}
+		}
+
+		if len(shards) < erasureListPageSize {
+			return rebuilt, failed, nil
+		}
+		startAfter = shards[len(shards)-1].ID.Value()
+	}
+}
+
+// encoderFor returns the encoder of the layout an object was written with, which differs from the configured one
+// for objects written before the layout changed
+func (es *ErasureStorage) encoderFor(manifest *models.ShardManifest) (reedsolomon.Encoder, error) {
+	if manifest.DataShards == es.dataShards && manifest.ParityShards == es.parityShards {
+		return es.encoder, nil
+	}
+
+	return reedsolomon.New(manifest.DataShards, manifest.ParityShards)
+}
+
+// ID returns the identifier of the erasure coded storage
+func (es *ErasureStorage) ID() string {
+	return "erasure"
+}
+
+// IsOnline reports whether enough nodes are online to reach the write quorum
+func (es *ErasureStorage) IsOnline() bool {
+	return len(onlineNodes(es.nps.Nodes())) >= es.writeQuorum
+}
+
+// foundShard is a shard found on a node
+type foundShard struct {
+	node     ports.ObjectStorage
+	obj      *models.Object
+	manifest *models.ShardManifest
+}
+
+// shardSet holds the shards of the newest write of an object having enough shards to be read
+type shardSet struct {
+	manifest     *models.ShardManifest
+	shards       map[int]ports.ObjectStorage
+	contentType  string
+	metadata     map[string]string
+	lastModified time.Time
+	// stale are the shards of other writes
+	stale []foundShard
+}
+
+// locate finds the shards of the newest write of an object that can be read.
+// The object is reported missing when enough nodes lack it for no write to have reached the quorum without them
+func (es *ErasureStorage) locate(ctx context.Context, id string) (*shardSet, error) {
+	candidates, err := es.nps.GetNodes(id, es.dataShards+es.parityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	found, notFound := es.findShards(ctx, id, candidates)
+
+	versions := make(map[string]*shardSet)
+	for _, shard := range found {
+		set, ok := versions[shard.manifest.Version]
+		if !ok {
+			set = &shardSet{
+				manifest:    shard.manifest,
+				shards:      make(map[int]ports.ObjectStorage),
+				contentType: shard.obj.ContentType,
+				metadata:    shard.obj.Metadata,
+			}
+			versions[shard.manifest.Version] = set
+		}
+
+		if _, ok = set.shards[shard.manifest.Index]; !ok {
+			set.shards[shard.manifest.Index] = shard.node
+		}
+		if shard.obj.LastModified.After(set.lastModified) {
+			set.lastModified = shard.obj.LastModified
+		}
+	}
+
+	var newest *shardSet
+	for _, set := range versions {
+		if len(set.shards) < set.manifest.DataShards {
+			continue
+		}
+		if newest == nil || set.lastModified.After(newest.lastModified) {
+			newest = set
+		}
+	}
+
+	if newest == nil {
+		// the shards found then are left by a delete that missed an offline node, or by a write still in progress
+		if notFound > es.dataShards+es.parityShards-es.writeQuorum {
+			return nil, models.ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("not enough shards of object %s: %w", id, models.ErrObjectStorageNotAvailable)
+	}
+
+	for _, shard := range found {
+		if shard.manifest.Version != newest.manifest.Version {
+			newest.stale = append(newest.stale, shard)
+		}
+	}
+
+	return newest, nil
+}
+
+// findShards stats the shards of an object on the given nodes and on the nodes their manifests recorded,
+// so that shards written before a ring change are found, and returns them with the number of nodes lacking the object
+func (es *ErasureStorage) findShards(ctx context.Context, id string, nodes []ports.ObjectStorage) ([]foundShard, int) {
+	seen := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		seen[node.ID()] = true
+	}
+
+	found, notFound := es.statShards(ctx, id, nodes)
+
+	var recorded []ports.ObjectStorage
+	for _, shard := range found {
+		for _, nodeID := range shard.manifest.Nodes {
+			if seen[nodeID] {
+				continue
+			}
+			seen[nodeID] = true
+
+			if node, ok := es.nps.NodeByID(nodeID); ok {
+				recorded = append(recorded, node)
+			}
+		}
+	}
+
+	more, _ := es.statShards(ctx, id, recorded)
+
+	return append(found, more...), notFound
+}
+
+func (es *ErasureStorage) statShards(ctx context.Context, id string, nodes []ports.ObjectStorage) ([]foundShard, int) {
+	shards := make([]*foundShard, len(nodes))
+	errs := make([]error, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		if !node.IsOnline() {
+			errs[i] = models.ErrObjectStorageNotAvailable
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, node ports.ObjectStorage) {
+			defer wg.Done()
+
+			obj, err := node.StatObject(ctx, id)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			manifest, ok, err := models.ParseShardManifest(obj.Metadata)
+			switch {
+			case err != nil:
+				errs[i] = err
+			case !ok:
+				errs[i] = fmt.Errorf("object %s on node %s is not a shard", id, node.ID())
+			case obj.Size != manifest.ShardSize():
+				errs[i] = fmt.Errorf("shard of object %s on node %s is truncated", id, node.ID())
+			default:
+				shards[i] = &foundShard{node: node, obj: obj, manifest: manifest}
+			}
+		}(i, node)
+	}
+	wg.Wait()
+
+	found, notFound := make([]foundShard, 0, len(nodes)), 0
+	for i, shard := range shards {
+		switch {
+		case shard != nil:
+			found = append(found, *shard)
+		case errors.Is(errs[i], models.ErrObjectNotFound):
+			notFound++
+		case !errors.Is(errs[i], models.ErrObjectStorageNotAvailable):
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not read shard of object %s on node %s with error %s", id, nodes[i].ID(), errs[i]))
+		}
+	}
+
+	return found, notFound
+}
+
+// object returns the object the shards belong to, without content
+func (set *shardSet) object(id string) *models.Object {
+	metadata := maps.Clone(set.metadata)
+	for key := range set.manifest.Metadata() {
+		delete(metadata, key)
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+
+	return &models.Object{
+		ID:           models.ObjectID(id),
+		ContentType:  set.contentType,
+		Size:         set.manifest.Size,
+		ETag:         set.manifest.Version,
+		LastModified: set.lastModified,
+		Metadata:     metadata,
+	}
+}
+
+// holds tells whether a node holds a shard of the write
+func (set *shardSet) holds(nodeID string) bool {
+	for _, node := range set.shards {
+		if node.ID() == nodeID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shardObject returns the shard of the given index of an object, without content
+func shardObject(id models.ObjectID, contentType string, metadata map[string]string, manifest models.ShardManifest, index int) *models.Object {
+	manifest.Index = index
+
+	shardMetadata := maps.Clone(metadata)
+	if shardMetadata == nil {
+		shardMetadata = make(map[string]string)
+	}
+	maps.Copy(shardMetadata, manifest.Metadata())
+
+	return &models.Object{
+		ID:          id,
+		ContentType: contentType,
+		Size:        manifest.ShardSize(),
+		Metadata:    shardMetadata,
+	}
+}
+
+func nodeIDs(nodes []ports.ObjectStorage) []string {
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.ID())
+	}
+
+	return ids
+}
+
+// erasureReader reads the stripes of an object from stripe up to last, keeping DataShards shards open.
+// A shard failing to open, to read or to match its checksums is replaced by the next one, data shards being preferred
+// as they spare the decoding
+type erasureReader struct {
+	ctx     context.Context
+	encoder reedsolomon.Encoder
+	id      string
+	set     *shardSet
+	stripe  int64
+	last    int64
+	readers map[int]io.Reader
+	failed  map[int]bool
+	// buffers hold a chunk and its checksum for every shard
+	buffers [][]byte
+	plain   []byte
+	err     error
+}
+
+func newErasureReader(ctx context.Context, encoder reedsolomon.Encoder, id string, set *shardSet, first, last int64) *erasureReader {
+	shards := set.manifest.DataShards + set.manifest.ParityShards
+	buffers := make([][]byte, shards)
+	for i := range buffers {
+		buffers[i] = make([]byte, set.manifest.ChunkSize+models.ChecksumSize)
+	}
+
+	return &erasureReader{
+		ctx:     ctx,
+		encoder: encoder,
+		id:      id,
+		set:     set,
+		stripe:  first,
+		last:    last,
+		readers: make(map[int]io.Reader),
+		failed:  make(map[int]bool),
+		buffers: buffers,
+	}
+}
+
+func (er *erasureReader) Read(p []byte) (int, error) {
+	for len(er.plain) == 0 {
+		if er.err != nil {
+			return 0, er.err
+		}
+		if er.stripe > er.last {
+			return 0, io.EOF
+		}
+
+		chunks, err := er.readStripe()
+		if err == nil {
+			err = er.encoder.ReconstructData(chunks)
+		}
+		if err != nil {
+			er.err = err
+			return 0, err
+		}
+
+		er.plain = er.plain[:0]
+		for _, chunk := range chunks[:er.set.manifest.DataShards] {
+			er.plain = append(er.plain, chunk...)
+		}
+
+		// the padding of the last stripe isn't part of the object
+		stripeSize := int64(len(er.plain))
+		if end := er.set.manifest.Size - (er.stripe-1)*stripeSize; end < stripeSize {
+			er.plain = er.plain[:end]
+		}
+	}
+
+	n := copy(p, er.plain)
+	er.plain = er.plain[n:]
+
+	return n, nil
+}
+
+// readStripe reads the chunks of the current stripe from DataShards shards and moves to the next stripe.
+// Chunks that weren't read are empty
+func (er *erasureReader) readStripe() ([][]byte, error) {
+	manifest := er.set.manifest
+	read := make(map[int]bool, manifest.DataShards)
+
+	for len(read) < manifest.DataShards {
+		if err := er.open(); err != nil {
+			return nil, err
+		}
+
+		for index, r := range er.readers {
+			if read[index] {
+				continue
+			}
+
+			buf := er.buffers[index]
+			chunk, checksum := buf[:manifest.ChunkSize], buf[manifest.ChunkSize:]
+			if _, err := io.ReadFull(r, buf); err != nil || binary.BigEndian.Uint32(checksum) != crc32.Checksum(chunk, castagnoli) {
+				log.Warnt(context_wrapper.GetCorrelationID(er.ctx), fmt.Sprintf("shard %d of object %s failed at stripe %d", index, er.id, er.stripe))
+				er.drop(index)
+				continue
+			}
+			read[index] = true
+		}
+	}
+
+	chunks := make([][]byte, len(er.buffers))
+	for index, buf := range er.buffers {
+		if read[index] {
+			chunks[index] = buf[:manifest.ChunkSize]
+		} else {
+			chunks[index] = buf[:0]
+		}
+	}
+	er.stripe++
+
+	return chunks, nil
+}
+
+// open opens shards from the current stripe until DataShards of them are open
+func (er *erasureReader) open() error {
+	manifest := er.set.manifest
+	shards := manifest.DataShards + manifest.ParityShards
+	chunkSize := int64(manifest.ChunkSize + models.ChecksumSize)
+
+	for index := 0; len(er.readers) < manifest.DataShards && index < shards; index++ {
+		node, ok := er.set.shards[index]
+		if _, open := er.readers[index]; open || er.failed[index] || !ok {
+			continue
+		}
+
+		obj, err := node.GetObject(er.ctx, er.id, &models.ByteRange{Start: er.stripe * chunkSize, End: (er.last+1)*chunkSize - 1})
+		if err != nil {
+			er.failed[index] = true
+			continue
+		}
+
+		// the shard may have been overwritten by another write since it was located
+		if obj.Metadata[models.MetadataErasureVersion] != manifest.Version {
+			closeContent(obj)
+			er.failed[index] = true
+			continue
+		}
+
+		er.readers[index] = obj.Content
+	}
+
+	if len(er.readers) < manifest.DataShards {
+		return fmt.Errorf("only %d shards of object %s readable, %d required: %w", len(er.readers), er.id, manifest.DataShards, models.ErrObjectStorageNotAvailable)
+	}
+
+	return nil
+}
+
+func (er *erasureReader) drop(index int) {
+	if closer, ok := er.readers[index].(io.Closer); ok {
+		closer.Close()
+	}
+	delete(er.readers, index)
+	er.failed[index] = true
+}
+
+// Close closes the open shards
+func (er *erasureReader) Close() error {
+	for index := range er.readers {
+		er.drop(index)
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+// erasureContent spans several stripes of the test layout, the last one padded
+const erasureContent = "erasure coded across stripes of eight bytes"
+
+// newErasureStorage returns an erasure coded storage of two data and two parity shards over a pool of n in-memory nodes,
+// with stripes of eight bytes
+func newErasureStorage(t *testing.T, n int) (*services.ErasureStorage, []*object_storage.MemoryObjectStore) {
+	t.Helper()
+
+	nps, nodes := newMemoryPool(n)
+	es, err := services.NewErasureStorage(nps, services.ErasureOptions{DataShards: 2, ParityShards: 2, ChunkSize: 4})
+	if err != nil {
+		t.Fatalf("create erasure storage: %v", err)
+	}
+
+	return es, nodes
+}
+
+func TestErasureStorageRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	es, _ := newErasureStorage(t, 4)
+
+	for _, content := range []string{"", "a", "one stripe", erasureContent} {
+		putObject(t, es, "round-trip", content)
+
+		if got := getObject(t, es, "round-trip"); got != content {
+			t.Fatalf("content = %q, want %q", got, content)
+		}
+		stat, err := es.StatObject(ctx, "round-trip")
+		if err != nil {
+			t.Fatalf("stat object: %v", err)
+		}
+		if stat.Size != int64(len(content)) {
+			t.Fatalf("size = %d, want %d", stat.Size, len(content))
+		}
+	}
+
+	// content of unknown size is spooled before being encoded
+	err := es.PutObject(ctx, &models.Object{ID: "unknown-size", Content: strings.NewReader(erasureContent), Size: -1})
+	if err != nil {
+		t.Fatalf("put object of unknown size: %v", err)
+	}
+	if got := getObject(t, es, "unknown-size"); got != erasureContent {
+		t.Fatalf("content = %q, want %q", got, erasureContent)
+	}
+
+	objects, err := es.ListObjects(ctx, "", "", 10)
+	if err != nil {
+		t.Fatalf("list objects: %v", err)
+	}
+	if len(objects) != 2 || objects[0].Size != int64(len(erasureContent)) || objects[1].Size != int64(len(erasureContent)) {
+		t.Fatalf("listed %v, want both objects once with their size %d", objects, len(erasureContent))
+	}
+}
+
+func TestErasureStorageReadsWithParityShardsOffline(t *testing.T) {
+	es, nodes := newErasureStorage(t, 4)
+	putObject(t, es, "degraded", erasureContent)
+
+	// losing both data shards leaves the object to be decoded from its parity shards
+	holders := shardHolders(t, nodes, "degraded")
+	holders[0].SetOnline(false)
+	holders[1].SetOnline(false)
+
+	if got := getObject(t, es, "degraded"); got != erasureContent {
+		t.Fatalf("content = %q, want %q", got, erasureContent)
+	}
+
+	holders[2].SetOnline(false)
+	if _, err := es.GetObject(context.Background(), "degraded", nil); !errors.Is(err, models.ErrObjectStorageNotAvailable) {
+		t.Fatalf("get error with three shards offline = %v, want %v", err, models.ErrObjectStorageNotAvailable)
+	}
+}
+
+func TestErasureStorageRebuildsCorruptedChunks(t *testing.T) {
+	ctx := context.Background()
+	es, nodes := newErasureStorage(t, 4)
+	putObject(t, es, "corrupted", erasureContent)
+
+	// flip a byte of the first chunk of a data shard, keeping its manifest
+	node := shardHolders(t, nodes, "corrupted")[0]
+	shard, err := node.GetObject(ctx, "corrupted", nil)
+	if err != nil {
+		t.Fatalf("get shard: %v", err)
+	}
+	content, err := io.ReadAll(shard.Content)
+	if err != nil {
+		t.Fatalf("read shard: %v", err)
+	}
+	content[0] ^= 0xff
+	shard.Content = bytes.NewReader(content)
+	if err = node.PutObject(ctx, shard); err != nil {
+		t.Fatalf("put corrupted shard: %v", err)
+	}
+
+	if got := getObject(t, es, "corrupted"); got != erasureContent {
+		t.Fatalf("content = %q, want %q", got, erasureContent)
+	}
+}
+
+func TestErasureStorageReadsRangesAcrossStripes(t *testing.T) {
+	ctx := context.Background()
+	es, nodes := newErasureStorage(t, 4)
+	putObject(t, es, "ranged", erasureContent)
+	shardHolders(t, nodes, "ranged")[0].SetOnline(false)
+
+	for _, rng := range []models.ByteRange{{Start: 0, End: 7}, {Start: 5, End: 20}, {Start: 7, End: 8}, {Start: 30, End: 1000}} {
+		obj, err := es.GetObject(ctx, "ranged", &rng)
+		if err != nil {
+			t.Fatalf("get range %d-%d: %v", rng.Start, rng.End, err)
+		}
+		got, err := io.ReadAll(obj.Content)
+		closeObject(obj)
+		if err != nil {
+			t.Fatalf("read range %d-%d: %v", rng.Start, rng.End, err)
+		}
+
+		end := min(rng.End, int64(len(erasureContent))-1)
+		if want := erasureContent[rng.Start : end+1]; string(got) != want {
+			t.Fatalf("range %d-%d = %q, want %q", rng.Start, rng.End, got, want)
+		}
+		if obj.Range == nil || obj.Range.Start != rng.Start || obj.Range.End != end {
+			t.Fatalf("range of %d-%d = %v, want %d-%d", rng.Start, rng.End, obj.Range, rng.Start, end)
+		}
+	}
+
+	if _, err := es.GetObject(ctx, "ranged", &models.ByteRange{Start: int64(len(erasureContent)), End: 100}); !errors.Is(err, models.ErrRangeNotSatisfiable) {
+		t.Fatalf("get error past the end = %v, want %v", err, models.ErrRangeNotSatisfiable)
+	}
+}
+
+func TestErasureStorageRepairsMissingShards(t *testing.T) {
+	ctx := context.Background()
+	es, nodes := newErasureStorage(t, 5)
+	putObject(t, es, "repaired", erasureContent)
+
+	if err := shardHolders(t, nodes, "repaired")[1].DeleteObject(ctx, "repaired"); err != nil {
+		t.Fatalf("delete shard: %v", err)
+	}
+
+	if rebuilt, err := es.RepairObject(ctx, "repaired"); err != nil || rebuilt != 1 {
+		t.Fatalf("repair = %d rebuilt, %v, want 1 rebuilt", rebuilt, err)
+	}
+	if rebuilt, err := es.RepairObject(ctx, "repaired"); err != nil || rebuilt != 0 {
+		t.Fatalf("second repair = %d rebuilt, %v, want nothing to do", rebuilt, err)
+	}
+
+	// the rebuilt shard is enough to read the object along with another one
+	holders := shardHolders(t, nodes, "repaired")
+	if len(holders) != 4 {
+		t.Fatalf("%d shards after repair, want 4", len(holders))
+	}
+	holders[0].SetOnline(false)
+	holders[2].SetOnline(false)
+
+	if got := getObject(t, es, "repaired"); got != erasureContent {
+		t.Fatalf("content = %q, want %q", got, erasureContent)
+	}
+}
+
+func TestErasureStorageDeleteReachesWriteQuorum(t *testing.T) {
+	ctx := context.Background()
+	es, nodes := newErasureStorage(t, 4)
+	putObject(t, es, "deleted", erasureContent)
+	putObject(t, es, "kept", erasureContent)
+
+	// three of the four nodes are the default write quorum
+	holders := shardHolders(t, nodes, "deleted")
+	holders[3].SetOnline(false)
+	if err := es.DeleteObject(ctx, "deleted"); err != nil {
+		t.Fatalf("delete object: %v", err)
+	}
+
+	// the shard left on the offline node isn't enough for the object to come back with it
+	holders[3].SetOnline(true)
+	if _, err := es.StatObject(ctx, "deleted"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("stat error after delete = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	if objects, err := es.ListObjects(ctx, "deleted", "", 10); err != nil || len(objects) != 0 {
+		t.Fatalf("list after delete = %v, %v, want no object", objects, err)
+	}
+
+	holders = shardHolders(t, nodes, "kept")
+	holders[0].SetOnline(false)
+	holders[1].SetOnline(false)
+	if err := es.DeleteObject(ctx, "kept"); !errors.Is(err, models.ErrObjectStorageNotAvailable) {
+		t.Fatalf("delete error below the write quorum = %v, want %v", err, models.ErrObjectStorageNotAvailable)
+	}
+}
+
+// shardHolders returns the nodes holding a shard of an object by shard index
+func shardHolders(t *testing.T, nodes []*object_storage.MemoryObjectStore, id string) map[int]*object_storage.MemoryObjectStore {
+	t.Helper()
+
+	holders := make(map[int]*object_storage.MemoryObjectStore)
+	for _, node := range nodes {
+		obj, err := node.StatObject(context.Background(), id)
+		if errors.Is(err, models.ErrObjectNotFound) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("stat shard on %s: %v", node.ID(), err)
+		}
+
+		manifest, ok, err := models.ParseShardManifest(obj.Metadata)
+		if err != nil || !ok {
+			t.Fatalf("shard on %s has no manifest: %v", node.ID(), err)
+		}
+		holders[manifest.Index] = node
+	}
+
+	return holders
+}
+
+func closeObject(obj *models.Object) {
+	if closer, ok := obj.Content.(io.Closer); ok {
+		closer.Close()
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"github.com/go-co-op/gocron"
+	"github.com/google/uuid"
+)
+
+const defaultGCInterval = 10 * time.Minute
+
+// GarbageCollectionService periodically removes the blobs of a DedupStorage that nothing references anymore
+type GarbageCollectionService struct {
+	storage   *DedupStorage
+	scheduler *gocron.Scheduler
+	interval  time.Duration
+}
+
+// NewGarbageCollectionService creates a new instance of GarbageCollectionService collecting blobs at the given interval
+func NewGarbageCollectionService(storage *DedupStorage, interval time.Duration) *GarbageCollectionService {
+	if interval <= 0 {
+		interval = defaultGCInterval
+	}
+
+	return &GarbageCollectionService{
+		storage:   storage,
+		scheduler: gocron.NewScheduler(time.UTC),
+		interval:  interval,
+	}
+}
+
+// StartCollecting starts a periodic task collecting unreferenced blobs, a pass not starting while the previous one runs
+func (gcs *GarbageCollectionService) StartCollecting() error {
+	_, err := gcs.scheduler.Every(gcs.interval).SingletonMode().Do(func() {
+		ctx := context_wrapper.WithCorrelationID(context.Background(), uuid.New().String())
+
+		gcs.CollectGarbage(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	gcs.scheduler.StartAsync()
+
+	return nil
+}
+
+// CollectGarbage runs a garbage collection pass, a failing pass being retried on the next one
+func (gcs *GarbageCollectionService) CollectGarbage(ctx context.Context) {
+	correlationID := context_wrapper.GetCorrelationID(ctx)
+
+	removed, err := gcs.storage.CollectGarbage(ctx)
+	if err != nil {
+		log.Warnt(correlationID, fmt.Sprintf("could not collect unreferenced blobs with error %s", err))
+	}
+	if removed > 0 {
+		log.Infot(correlationID, fmt.Sprintf("removed %d unreferenced blobs", removed))
+	}
+}
+
+// StopCollecting stops the periodic garbage collection task
+func (gcs *GarbageCollectionService) StopCollecting() {
+	gcs.scheduler.Stop()
+}
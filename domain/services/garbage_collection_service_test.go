@@ -0,0 +1,39 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestGarbageCollectionServiceRemovesUnreferencedBlobs(t *testing.T) {
+	ctx := context.Background()
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	ds := services.NewDedupStorage(node, services.DedupOptions{SpoolDir: t.TempDir(), GracePeriod: time.Nanosecond})
+
+	putObject(t, ds, "kept", "referenced content")
+	putObject(t, ds, "replaced", "replaced content")
+	putObject(t, ds, "replaced", "referenced content")
+	putObject(t, ds, "deleted", "deleted content")
+	if err := ds.DeleteObject(ctx, "deleted"); err != nil {
+		t.Fatalf("delete object: %v", err)
+	}
+
+	services.NewGarbageCollectionService(ds, 0).CollectGarbage(ctx)
+
+	for content, want := range map[string]bool{"referenced content": true, "replaced content": false, "deleted content": false} {
+		if _, err := node.StatObject(ctx, blobKey(content)); (err == nil) != want {
+			t.Fatalf("blob of %q stat error after collection = %v, want it kept = %t", content, err, want)
+		}
+	}
+	if content := getObject(t, ds, "replaced"); content != "referenced content" {
+		t.Fatalf("content = %q, want %q", content, "referenced content")
+	}
+
+	if removed, err := ds.CollectGarbage(ctx); err != nil || removed != 0 {
+		t.Fatalf("second collection = %d removed, %v, want nothing to remove", removed, err)
+	}
+}
@@ -2,28 +2,61 @@ package services
 
 import (
 	"context"
+	"io"
+
 	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
 )
 
 type GetObjectService struct {
-	nps *NodePoolService
+	storage      ports.ObjectStorage
+	verifyOnRead bool
 }
 
-func NewGetObjectService(nps *NodePoolService) *GetObjectService {
+// NewGetObjectService creates a new instance of GetObjectService.
+// With verifyOnRead, full reads of objects having digests fail with models.ErrDigestMismatch before the end of a corrupted content
+func NewGetObjectService(storage ports.ObjectStorage, verifyOnRead bool) *GetObjectService {
 	return &GetObjectService{
-		nps: nps,
+		storage:      storage,
+		verifyOnRead: verifyOnRead,
 	}
 }
 
-func (gos *GetObjectService) GetObject(ctx context.Context, objectID models.ObjectID) (*models.Object, error) {
-	if !objectID.IsValidID() {
+// GetObject returns the object content, or only the part selected by rng when it is not nil
+func (gos *GetObjectService) GetObject(ctx context.Context, objectID models.ObjectID, rng *models.ByteRange) (*models.Object, error) {
+	if !objectID.IsValidKey() {
 		return nil, models.ErrObjectIDNotValid
 	}
 
-	objectStorageNode, err := gos.nps.GetNode(objectID.Value())
+	if rng == nil {
+		obj, err := gos.storage.GetObject(ctx, objectID.Value(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// encoded content is served as stored, its digests only applying once decoded
+		if digests := obj.Digests(); gos.verifyOnRead && len(digests) > 0 && obj.ContentEncoding == "" {
+			dr := newDigestReader(obj.Content, obj.Size, digests)
+			if closer, ok := obj.Content.(io.Closer); ok {
+				obj.Content = digestReadCloser{digestReader: dr, Closer: closer}
+			} else {
+				obj.Content = dr
+			}
+		}
+
+		return obj, nil
+	}
+
+	// suffix and open ended ranges depend on the object size, so they are resolved before reaching the storage
+	stat, err := gos.storage.StatObject(ctx, objectID.Value())
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := rng.Resolve(stat.Size)
 	if err != nil {
 		return nil, err
 	}
 
-	return objectStorageNode.GetObject(ctx, objectID.Value())
+	return gos.storage.GetObject(ctx, objectID.Value(), &resolved)
 }
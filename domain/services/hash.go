@@ -0,0 +1,34 @@
+package services
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	HashFunctionCRC32   = "crc32"
+	HashFunctionXXHash  = "xxhash"
+	HashFunctionMurmur3 = "murmur3"
+)
+
+// HashFunc maps a key to its position on the consistent hash ring
+type HashFunc func(key []byte) uint64
+
+// NewHashFunc returns the hash function registered under the given name, defaulting to crc32 when name is empty
+func NewHashFunc(name string) (HashFunc, error) {
+	switch name {
+	case "", HashFunctionCRC32:
+		return func(key []byte) uint64 {
+			return uint64(crc32.ChecksumIEEE(key))
+		}, nil
+	case HashFunctionXXHash:
+		return xxhash.Sum64, nil
+	case HashFunctionMurmur3:
+		return murmur3.Sum64, nil
+	default:
+		return nil, fmt.Errorf("unknown hash function %q", name)
+	}
+}
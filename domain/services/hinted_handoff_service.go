@@ -0,0 +1,323 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"github.com/go-co-op/gocron"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultHintReplayInterval = 30 * time.Second
+	// hintsSaveInterval is how often recorded and replayed hints are written to the hints file
+	hintsSaveInterval = time.Second
+)
+
+// HintedHandoffOptions configures how hints are replayed and persisted
+type HintedHandoffOptions struct {
+	// ReplayInterval is how often hints are replayed, defaultHintReplayInterval when lower or equal to zero
+	ReplayInterval time.Duration
+	// HintsFile persists the hints so they are replayed after a restart, disabled when empty
+	HintsFile string
+}
+
+// Hint records that a write or a delete meant for an offline owner was handled by another node,
+// or that a delete missed by an owner is still to be replayed on it
+type Hint struct {
+	Key     string
+	OwnerID string
+	// Holder is the node that stored the object in place of the owner, nil for deletes and for hints loaded from the hints file
+	Holder ports.ObjectStorage `json:"-"`
+	// HolderID is the ID of Holder, the node being looked up in the pool when Holder is nil
+	HolderID string
+	// Replicas is the replication factor the key was written with, used to tell whether the holder still owns it
+	Replicas  int
+	Deleted   bool
+	CreatedAt time.Time
+}
+
+// HintedHandoffService keeps the hints of writes and deletes handled on behalf of offline nodes
+// and replays them to their rightful owners once they are back online
+type HintedHandoffService struct {
+	nps       *NodePoolService
+	scheduler *gocron.Scheduler
+	interval  time.Duration
+	hintsFile string
+	// hints are indexed by owner ID and key, so only the latest operation on a key is replayed
+	hints map[string]map[string]*Hint
+	// dirty tells that the hints changed since they were last saved
+	dirty bool
+	mu    sync.Mutex
+	// saveMu keeps saves in order, so that an older snapshot never overwrites a newer one
+	saveMu sync.Mutex
+}
+
+// NewHintedHandoffService creates a new instance of HintedHandoffService, loading the hints saved by a previous run when there are some
+func NewHintedHandoffService(nps *NodePoolService, opts HintedHandoffOptions) (*HintedHandoffService, error) {
+	if opts.ReplayInterval <= 0 {
+		opts.ReplayInterval = defaultHintReplayInterval
+	}
+
+	hhs := &HintedHandoffService{
+		nps:       nps,
+		scheduler: gocron.NewScheduler(time.UTC),
+		interval:  opts.ReplayInterval,
+		hintsFile: opts.HintsFile,
+		hints:     make(map[string]map[string]*Hint),
+	}
+
+	if opts.HintsFile != "" {
+		raw, err := os.ReadFile(opts.HintsFile)
+		switch {
+		case err == nil:
+			var hints []*Hint
+			if err = json.Unmarshal(raw, &hints); err != nil {
+				return nil, fmt.Errorf("read hints: %w", err)
+			}
+			for _, hint := range hints {
+				hhs.addHint(hint)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("read hints: %w", err)
+		}
+	}
+
+	return hhs, nil
+}
+
+// RecordHint stores a hint, replacing any previous hint for the same owner and key
+func (hhs *HintedHandoffService) RecordHint(hint *Hint) {
+	if hint.Holder != nil {
+		hint.HolderID = hint.Holder.ID()
+	}
+
+	hhs.mu.Lock()
+	defer hhs.mu.Unlock()
+
+	hhs.addHint(hint)
+	hhs.dirty = true
+}
+
+// addHint indexes a hint, the lock must be held
+func (hhs *HintedHandoffService) addHint(hint *Hint) {
+	if hhs.hints[hint.OwnerID] == nil {
+		hhs.hints[hint.OwnerID] = make(map[string]*Hint)
+	}
+
+	hhs.hints[hint.OwnerID][hint.Key] = hint
+}
+
+// PendingHints returns the number of hints waiting to be replayed
+func (hhs *HintedHandoffService) PendingHints() int {
+	hhs.mu.Lock()
+	defer hhs.mu.Unlock()
+
+	pending := 0
+	for _, keys := range hhs.hints {
+		pending += len(keys)
+	}
+
+	return pending
+}
+
+// PendingDelete returns when the key was last deleted while one of its owners missed the delete,
+// when such a delete is still waiting to be replayed
+func (hhs *HintedHandoffService) PendingDelete(key string) (time.Time, bool) {
+	hhs.mu.Lock()
+	defer hhs.mu.Unlock()
+
+	var deletedAt time.Time
+	for _, keys := range hhs.hints {
+		if hint, ok := keys[key]; ok && hint.Deleted && hint.CreatedAt.After(deletedAt) {
+			deletedAt = hint.CreatedAt
+		}
+	}
+
+	return deletedAt, !deletedAt.IsZero()
+}
+
+// StartReplayingHints starts a periodic task replaying the hints of owners that came back online,
+// and another one saving the hints when a hints file is configured
+func (hhs *HintedHandoffService) StartReplayingHints() error {
+	_, err := hhs.scheduler.Every(hhs.interval).Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), hhs.interval)
+		defer cancel()
+
+		ctx = context_wrapper.WithCorrelationID(ctx, uuid.New().String())
+
+		hhs.ReplayHints(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	if hhs.hintsFile != "" {
+		if _, err = hhs.scheduler.Every(hintsSaveInterval).SingletonMode().Do(hhs.saveHints); err != nil {
+			return err
+		}
+	}
+
+	hhs.scheduler.StartAsync()
+
+	return nil
+}
+
+// ReplayHints hands every hinted operation over to its owner when the owner is online.
+// Hints that fail are kept and retried on the next replay
+func (hhs *HintedHandoffService) ReplayHints(ctx context.Context) {
+	for _, hint := range hhs.replayableHints() {
+		owner, ok := hhs.nps.NodeByID(hint.OwnerID)
+		if !ok || !owner.IsOnline() {
+			continue
+		}
+
+		if err := hhs.replayHint(ctx, owner, hint); err != nil {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not hand object %s over to node %s with error %s", hint.Key, hint.OwnerID, err))
+			continue
+		}
+
+		hhs.removeHint(hint)
+	}
+}
+
+func (hhs *HintedHandoffService) replayHint(ctx context.Context, owner ports.ObjectStorage, hint *Hint) error {
+	// the owner may have received newer writes since it came back, which must not be overwritten
+	current, err := owner.StatObject(ctx, hint.Key)
+	if err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+		return err
+	}
+	if current != nil && current.LastModified.After(hint.CreatedAt) {
+		return nil
+	}
+
+	if hint.Deleted {
+		if err = owner.DeleteObject(ctx, hint.Key); err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+			return err
+		}
+		return nil
+	}
+
+	holder := hint.Holder
+	if holder == nil {
+		var ok bool
+		if holder, ok = hhs.nps.NodeByID(hint.HolderID); !ok {
+			return fmt.Errorf("holder node %s not found", hint.HolderID)
+		}
+	}
+
+	obj, err := holder.GetObject(ctx, hint.Key, nil)
+	if err != nil {
+		// the hinted copy is gone, a later delete handles the owner
+		if errors.Is(err, models.ErrObjectNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	err = owner.PutObject(ctx, obj)
+	if closer, ok := obj.Content.(io.Closer); ok {
+		closer.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	// the holder keeps its copy when ring changes made it one of the key owners in the meantime
+	nodes, err := hhs.nps.GetNodes(hint.Key, hint.Replicas)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if node.ID() == holder.ID() {
+			return nil
+		}
+	}
+
+	if err = holder.DeleteObject(ctx, hint.Key); err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+func (hhs *HintedHandoffService) replayableHints() []*Hint {
+	hhs.mu.Lock()
+	defer hhs.mu.Unlock()
+
+	hints := make([]*Hint, 0)
+	for _, keys := range hhs.hints {
+		for _, hint := range keys {
+			hints = append(hints, hint)
+		}
+	}
+
+	return hints
+}
+
+// removeHint drops a replayed hint unless a newer one replaced it in the meantime
+func (hhs *HintedHandoffService) removeHint(hint *Hint) {
+	hhs.mu.Lock()
+	defer hhs.mu.Unlock()
+
+	if hhs.hints[hint.OwnerID][hint.Key] != hint {
+		return
+	}
+
+	delete(hhs.hints[hint.OwnerID], hint.Key)
+	if len(hhs.hints[hint.OwnerID]) == 0 {
+		delete(hhs.hints, hint.OwnerID)
+	}
+	hhs.dirty = true
+}
+
+// saveHints writes the hints to the hints file when they changed since they were last saved
+func (hhs *HintedHandoffService) saveHints() {
+	if hhs.hintsFile == "" {
+		return
+	}
+
+	hhs.saveMu.Lock()
+	defer hhs.saveMu.Unlock()
+
+	hhs.mu.Lock()
+	if !hhs.dirty {
+		hhs.mu.Unlock()
+		return
+	}
+	hhs.dirty = false
+	hhs.mu.Unlock()
+
+	// recorded hints are never modified, so the snapshot can be encoded without holding the lock
+	raw, err := json.Marshal(hhs.replayableHints())
+	if err == nil {
+		tmp := hhs.hintsFile + ".tmp"
+		if err = os.WriteFile(tmp, raw, 0o644); err == nil {
+			err = os.Rename(tmp, hhs.hintsFile)
+		}
+	}
+	if err != nil {
+		log.Errorf("could not save hints with error %s", err)
+
+		hhs.mu.Lock()
+		hhs.dirty = true
+		hhs.mu.Unlock()
+	}
+}
+
+// StopReplayingHints stops the periodic tasks and saves the hints left to replay
+func (hhs *HintedHandoffService) StopReplayingHints() {
+	hhs.scheduler.Stop()
+	hhs.saveHints()
+}
@@ -0,0 +1,69 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/discovery-service"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestHintedHandoffServiceReplaysHintsAfterRestart(t *testing.T) {
+	ctx := context.Background()
+
+	nodeA := object_storage.NewMemoryObjectStore("node-a", 0)
+	nodeB := object_storage.NewMemoryObjectStore("node-b", 0)
+	nps := services.NewNodePoolService(discovery_service.NewMemoryDiscoveryService(nodeA, nodeB), services.RingOptions{})
+	nps.RefreshNodes()
+
+	owners, err := nps.GetNodes("written", 1)
+	if err != nil {
+		t.Fatalf("get nodes: %v", err)
+	}
+	owner, holder := nodeA, nodeB
+	if owners[0].ID() == nodeB.ID() {
+		owner, holder = nodeB, nodeA
+	}
+
+	putObject(t, holder, "written", "hinted content")
+	putObject(t, owner, "deleted", "stale content")
+
+	hintsFile := filepath.Join(t.TempDir(), "hints.json")
+	hhs, err := services.NewHintedHandoffService(nps, services.HintedHandoffOptions{HintsFile: hintsFile})
+	if err != nil {
+		t.Fatalf("create hinted handoff service: %v", err)
+	}
+
+	createdAt := time.Now()
+	hhs.RecordHint(&services.Hint{Key: "written", OwnerID: owner.ID(), Holder: holder, Replicas: 1, CreatedAt: createdAt})
+	hhs.RecordHint(&services.Hint{Key: "deleted", OwnerID: owner.ID(), Replicas: 1, Deleted: true, CreatedAt: createdAt})
+	hhs.StopReplayingHints()
+
+	restarted, err := services.NewHintedHandoffService(nps, services.HintedHandoffOptions{HintsFile: hintsFile})
+	if err != nil {
+		t.Fatalf("reload hinted handoff service: %v", err)
+	}
+	if pending := restarted.PendingHints(); pending != 2 {
+		t.Fatalf("pending hints after restart = %d, want 2", pending)
+	}
+
+	restarted.ReplayHints(ctx)
+
+	if pending := restarted.PendingHints(); pending != 0 {
+		t.Fatalf("pending hints after replay = %d, want 0", pending)
+	}
+	if content := getObject(t, owner, "written"); content != "hinted content" {
+		t.Fatalf("owner content = %q, want %q", content, "hinted content")
+	}
+	if _, err = holder.StatObject(ctx, "written"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("holder stat error = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	if _, err = owner.StatObject(ctx, "deleted"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("owner stat error = %v, want %v", err, models.ErrObjectNotFound)
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"github.com/go-co-op/gocron"
+	"github.com/google/uuid"
+)
+
+const defaultRewrapInterval = time.Hour
+
+// KeyRotationService periodically re-wraps the data keys of the encrypted nodes that aren't wrapped with the current master key,
+// so that former master keys can be retired once a pass completes without failures
+type KeyRotationService struct {
+	nps       *NodePoolService
+	scheduler *gocron.Scheduler
+	interval  time.Duration
+}
+
+// NewKeyRotationService creates a new instance of KeyRotationService re-wrapping data keys at the given interval
+func NewKeyRotationService(nps *NodePoolService, interval time.Duration) *KeyRotationService {
+	if interval <= 0 {
+		interval = defaultRewrapInterval
+	}
+
+	return &KeyRotationService{
+		nps:       nps,
+		scheduler: gocron.NewScheduler(time.UTC),
+		interval:  interval,
+	}
+}
+
+// StartRewrapping starts a periodic task re-wrapping data keys, a pass not starting while the previous one runs
+func (krs *KeyRotationService) StartRewrapping() error {
+	_, err := krs.scheduler.Every(krs.interval).SingletonMode().Do(func() {
+		ctx := context_wrapper.WithCorrelationID(context.Background(), uuid.New().String())
+
+		krs.RewrapKeys(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	krs.scheduler.StartAsync()
+
+	return nil
+}
+
+// RewrapKeys re-wraps the data keys of every online encrypted node of the pool
+func (krs *KeyRotationService) RewrapKeys(ctx context.Context) {
+	correlationID := context_wrapper.GetCorrelationID(ctx)
+
+	for _, node := range krs.nps.Nodes() {
+		es, ok := node.(*EncryptedStorage)
+		if !ok || !es.IsOnline() {
+			continue
+		}
+
+		rewrapped, failed, err := es.RewrapAll(ctx)
+		if err != nil {
+			log.Warnt(correlationID, fmt.Sprintf("could not re-wrap data keys of node %s with error %s", es.ID(), err))
+			continue
+		}
+		if failed > 0 {
+			log.Warnt(correlationID, fmt.Sprintf("could not re-wrap %d data keys of node %s", failed, es.ID()))
+		}
+		if rewrapped > 0 {
+			log.Infot(correlationID, fmt.Sprintf("re-wrapped %d data keys of node %s", rewrapped, es.ID()))
+		}
+	}
+}
+
+// StopRewrapping stops the periodic re-wrapping task
+func (krs *KeyRotationService) StopRewrapping() {
+	krs.scheduler.Stop()
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+)
+
+const (
+	// DefaultListLimit is the page size used when the caller doesn't provide one
+	DefaultListLimit = 100
+	// MaxListLimit is the largest page size that can be requested
+	MaxListLimit = 1000
+	// statListingConcurrency is the number of objects stat'ed at once to resolve a listing page
+	statListingConcurrency = 16
+)
+
+// ListObjectsService lists the objects of every node in the ring as a single paginated stream sorted by object ID
+type ListObjectsService struct {
+	nps      *NodePoolService
+	resolver ports.ListingResolver
+}
+
+// NewListObjectsService creates a new instance of ListObjectsService, resolver being nil when nodes keep objects as callers see them
+func NewListObjectsService(nps *NodePoolService, resolver ports.ListingResolver) *ListObjectsService {
+	return &ListObjectsService{
+		nps:      nps,
+		resolver: resolver,
+	}
+}
+
+// listCursor records, for each node, the last object ID already returned from it
+type listCursor map[string]string
+
+// ListObjects merges up to limit objects matching prefix from every node, resuming from the given opaque cursor
+func (los *ListObjectsService) ListObjects(ctx context.Context, prefix string, limit int, cursor string) (*models.ObjectList, error) {
+	if limit == 0 {
+		limit = DefaultListLimit
+	}
+	if limit < 0 || limit > MaxListLimit {
+		return nil, models.ErrLimitNotValid
+	}
+
+	positions, err := decodeListCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := los.nps.Nodes()
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no nodes in the pool")
+	}
+
+	// nodes that joined after the cursor was issued start from the furthest position,
+	// otherwise they would return IDs sorting before objects already listed
+	var furthest string
+	for _, position := range positions {
+		if position > furthest {
+			furthest = position
+		}
+	}
+
+	startPositions := make(listCursor, len(nodes))
+	for _, node := range nodes {
+		if position, ok := positions[node.ID()]; ok {
+			startPositions[node.ID()] = position
+		} else {
+			startPositions[node.ID()] = furthest
+		}
+	}
+
+	pages, err := listNodePages(ctx, nodes, prefix, startPositions, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	next := startPositions
+	objects := mergeObjectPages(nodes, pages, limit, next)
+
+	// the cursor only depends on the node pages, so resolved pages may be shorter than the limit without ending the listing
+	if los.resolver != nil {
+		if objects, err = los.resolver.ResolveListing(ctx, objects); err != nil {
+			return nil, err
+		}
+	}
+
+	list := &models.ObjectList{Objects: objects}
+
+	// the listing goes on while a node has unread objects in its page or may hold more than one page
+	for i, page := range pages {
+		consumed := next[nodes[i].ID()]
+		if len(page) == limit || (len(page) > 0 && page[len(page)-1].ID.Value() > consumed) {
+			if list.NextCursor, err = encodeListCursor(next); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	return list, nil
+}
+
+// StartAfterCursor returns a cursor resuming a listing right after the given object ID on every node
+func (los *ListObjectsService) StartAfterCursor(id string) (string, error) {
+	positions := make(listCursor)
+	for _, node := range los.nps.Nodes() {
+		positions[node.ID()] = id
+	}
+
+	return encodeListCursor(positions)
+}
+
+// listNodePages lists a page of up to limit objects from every node, each one starting after its own position
+func listNodePages(ctx context.Context, nodes []ports.ObjectStorage, prefix string, positions listCursor, limit int) ([][]*models.Object, error) {
+	pages := make([][]*models.Object, len(nodes))
+	errs := make([]error, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node ports.ObjectStorage) {
+			defer wg.Done()
+
+			if !node.IsOnline() {
+				errs[i] = models.ErrObjectStorageNotAvailable
+				return
+			}
+
+			pages[i], errs[i] = node.ListObjects(ctx, prefix, positions[node.ID()], limit)
+		}(i, node)
+	}
+	wg.Wait()
+
+	// a partial listing would silently hide objects, so any failing node fails the whole page
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pages, nil
+}
+
+// mergeObjectPages k-way merges sorted node pages into at most limit objects,
+// advancing the per node position in next for every object consumed.
+// Replicas of the same object are merged into its most recently modified copy
+func mergeObjectPages(nodes []ports.ObjectStorage, pages [][]*models.Object, limit int, next listCursor) []*models.Object {
+	heads := make([]int, len(pages))
+	objects := make([]*models.Object, 0, limit)
+
+	for len(objects) < limit {
+		smallest := -1
+		for i, page := range pages {
+			if heads[i] >= len(page) {
+				continue
+			}
+			if smallest == -1 || page[heads[i]].ID < pages[smallest][heads[smallest]].ID {
+				smallest = i
+			}
+		}
+
+		if smallest == -1 {
+			break
+		}
+
+		obj := pages[smallest][heads[smallest]]
+		for i, page := range pages {
+			if heads[i] >= len(page) || page[heads[i]].ID != obj.ID {
+				continue
+			}
+			if page[heads[i]].LastModified.After(obj.LastModified) {
+				obj = page[heads[i]]
+			}
+			heads[i]++
+			next[nodes[i].ID()] = obj.ID.Value()
+		}
+
+		objects = append(objects, obj)
+	}
+
+	return objects
+}
+
+// statListing replaces the objects of a listing page with their stat, dropping the ones deleted meanwhile
+func statListing(ctx context.Context, objects []*models.Object, stat func(ctx context.Context, id string) (*models.Object, error)) ([]*models.Object, error) {
+	stats := make([]*models.Object, len(objects))
+	errs := make([]error, len(objects))
+
+	sem := make(chan struct{}, statListingConcurrency)
+	var wg sync.WaitGroup
+	for i, obj := range objects {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			stats[i], errs[i] = stat(ctx, id)
+		}(i, obj.ID.Value())
+	}
+	wg.Wait()
+
+	resolved := make([]*models.Object, 0, len(stats))
+	for i, obj := range stats {
+		switch {
+		case errors.Is(errs[i], models.ErrObjectNotFound):
+		case errs[i] != nil:
+			return nil, errs[i]
+		default:
+			resolved = append(resolved, obj)
+		}
+	}
+
+	return resolved, nil
+}
+
+func decodeListCursor(cursor string) (listCursor, error) {
+	positions := make(listCursor)
+	if cursor == "" {
+		return positions, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, models.ErrCursorNotValid
+	}
+
+	if err = json.Unmarshal(raw, &positions); err != nil {
+		return nil, models.ErrCursorNotValid
+	}
+
+	return positions, nil
+}
+
+func encodeListCursor(positions listCursor) (string, error) {
+	raw, err := json.Marshal(positions)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
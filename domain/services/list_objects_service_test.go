@@ -0,0 +1,86 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"storage-gateway/domain/services"
+)
+
+func TestListObjectsServicePagesThroughEveryNode(t *testing.T) {
+	ctx := context.Background()
+	nps, _ := newMemoryPool(3)
+
+	rs, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+
+	want := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("object%02d", i)
+		putObject(t, rs, id, id)
+		want = append(want, id)
+	}
+	putObject(t, rs, "other", "other")
+
+	los := services.NewListObjectsService(nps, nil)
+
+	// pages smaller than the listing resume from the cursor, without skipping or repeating objects
+	var listed []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("listing not complete after %d pages", pages)
+		}
+
+		list, err := los.ListObjects(ctx, "object", 3, cursor)
+		if err != nil {
+			t.Fatalf("list objects: %v", err)
+		}
+		if len(list.Objects) > 3 {
+			t.Fatalf("listed %d objects, want at most 3", len(list.Objects))
+		}
+		for _, obj := range list.Objects {
+			listed = append(listed, obj.ID.Value())
+		}
+
+		if list.NextCursor == "" {
+			break
+		}
+		cursor = list.NextCursor
+	}
+	assertIDs(t, listed, want)
+
+	cursor, err = los.StartAfterCursor("object16")
+	if err != nil {
+		t.Fatalf("start after cursor: %v", err)
+	}
+	list, err := los.ListObjects(ctx, "object", 0, cursor)
+	if err != nil {
+		t.Fatalf("list objects after object16: %v", err)
+	}
+
+	listed = listed[:0]
+	for _, obj := range list.Objects {
+		listed = append(listed, obj.ID.Value())
+	}
+	assertIDs(t, listed, want[17:])
+	if list.NextCursor != "" {
+		t.Fatalf("next cursor = %q, want the listing complete", list.NextCursor)
+	}
+}
+
+func assertIDs(t *testing.T, ids, want []string) {
+	t.Helper()
+
+	if len(ids) != len(want) {
+		t.Fatalf("listed %v, want %v", ids, want)
+	}
+	for i := range ids {
+		if ids[i] != want[i] {
+			t.Fatalf("listed %v, want %v", ids, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/discovery-service"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+// newMemoryPool returns a node pool of n in-memory nodes named node-0 to node-<n-1>
+func newMemoryPool(n int) (*services.NodePoolService, []*object_storage.MemoryObjectStore) {
+	nodes := make([]*object_storage.MemoryObjectStore, 0, n)
+	discovered := make([]ports.ObjectStorage, 0, n)
+	for i := 0; i < n; i++ {
+		node := object_storage.NewMemoryObjectStore(fmt.Sprintf("node-%d", i), 0)
+		nodes = append(nodes, node)
+		discovered = append(discovered, node)
+	}
+
+	nps := services.NewNodePoolService(discovery_service.NewMemoryDiscoveryService(discovered...), services.RingOptions{})
+	nps.RefreshNodes()
+
+	return nps, nodes
+}
+
+func putObject(t *testing.T, node ports.ObjectStorage, id, content string) {
+	t.Helper()
+
+	err := node.PutObject(context.Background(), &models.Object{
+		ID:      models.ObjectID(id),
+		Content: bytes.NewReader([]byte(content)),
+		Size:    int64(len(content)),
+	})
+	if err != nil {
+		t.Fatalf("put object %s: %v", id, err)
+	}
+}
+
+func getObject(t *testing.T, node ports.ObjectStorage, id string) string {
+	t.Helper()
+
+	obj, err := node.GetObject(context.Background(), id, nil)
+	if err != nil {
+		t.Fatalf("get object %s: %v", id, err)
+	}
+	if closer, ok := obj.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	content, err := io.ReadAll(obj.Content)
+	if err != nil {
+		t.Fatalf("read object %s: %v", id, err)
+	}
+
+	return string(content)
+}
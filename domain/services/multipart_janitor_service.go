@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"github.com/go-co-op/gocron"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultJanitorInterval = time.Hour
+	defaultUploadTTL       = 24 * time.Hour
+)
+
+// MultipartJanitorService periodically aborts the multipart uploads left unfinished for longer than a TTL, freeing their parts
+type MultipartJanitorService struct {
+	uploads   *MultipartUploadService
+	scheduler *gocron.Scheduler
+	interval  time.Duration
+	ttl       time.Duration
+}
+
+// NewMultipartJanitorService creates a new instance of MultipartJanitorService aborting, at the given interval, the uploads older than ttl
+func NewMultipartJanitorService(uploads *MultipartUploadService, interval, ttl time.Duration) *MultipartJanitorService {
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+	if ttl <= 0 {
+		ttl = defaultUploadTTL
+	}
+
+	return &MultipartJanitorService{
+		uploads:   uploads,
+		scheduler: gocron.NewScheduler(time.UTC),
+		interval:  interval,
+		ttl:       ttl,
+	}
+}
+
+// StartCleaning starts a periodic task aborting stale uploads, a pass not starting while the previous one runs
+func (mjs *MultipartJanitorService) StartCleaning() error {
+	_, err := mjs.scheduler.Every(mjs.interval).SingletonMode().Do(func() {
+		ctx := context_wrapper.WithCorrelationID(context.Background(), uuid.New().String())
+
+		mjs.AbortStaleUploads(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	mjs.scheduler.StartAsync()
+
+	return nil
+}
+
+// AbortStaleUploads runs a cleaning pass, nodes that fail being cleaned on the next one
+func (mjs *MultipartJanitorService) AbortStaleUploads(ctx context.Context) {
+	correlationID := context_wrapper.GetCorrelationID(ctx)
+
+	aborted, err := mjs.uploads.AbortStaleUploads(ctx, time.Now().Add(-mjs.ttl))
+	if err != nil {
+		log.Warnt(correlationID, fmt.Sprintf("could not list the stale multipart uploads with error %s", err))
+	}
+	if aborted > 0 {
+		log.Infot(correlationID, fmt.Sprintf("aborted %d stale multipart uploads", aborted))
+	}
+}
+
+// StopCleaning stops the periodic cleaning task
+func (mjs *MultipartJanitorService) StopCleaning() {
+	mjs.scheduler.Stop()
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+)
+
+// MultipartUploadService assembles objects from parts uploaded separately on the ring node owning the object ID,
+// through the multipart support of the node
+type MultipartUploadService struct {
+	nps           *NodePoolService
+	replicas      *ReplicatedStorage
+	maxObjectSize int64
+}
+
+// uploadToken is the content of the upload IDs handed out to clients,
+// which record the node holding the parts so that a ring change during an upload doesn't lose them
+type uploadToken struct {
+	Node   string `json:"node"`
+	Upload string `json:"upload"`
+}
+
+// NewMultipartUploadService creates a new instance of MultipartUploadService.
+// Completed objects are copied to their other replicas when replicas is not nil.
+// A maxObjectSize lower or equal to zero disables the object size limit
+func NewMultipartUploadService(nps *NodePoolService, replicas *ReplicatedStorage, maxObjectSize int64) *MultipartUploadService {
+	return &MultipartUploadService{
+		nps:           nps,
+		replicas:      replicas,
+		maxObjectSize: maxObjectSize,
+	}
+}
+
+// CreateUpload starts a multipart upload of an object on the node owning its ID, and returns the upload ID
+func (mus *MultipartUploadService) CreateUpload(ctx context.Context, obj *models.Object) (string, error) {
+	if !obj.ID.IsValidKey() {
+		return "", models.ErrObjectIDNotValid
+	}
+
+	node, err := mus.nps.GetNode(obj.ID.Value())
+	if err != nil {
+		return "", err
+	}
+	if !node.IsOnline() {
+		return "", models.ErrObjectStorageNotAvailable
+	}
+
+	storage, ok := nodeAs[ports.MultipartStorage](node)
+	if !ok {
+		return "", models.ErrMultipartNotSupported
+	}
+
+	uploadID, err := storage.NewMultipartUpload(ctx, obj)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeUploadID(uploadToken{Node: node.ID(), Upload: uploadID})
+}
+
+// UploadPart stores a part of an upload, whose content is checked against the digests of its metadata like objects are
+func (mus *MultipartUploadService) UploadPart(ctx context.Context, uploadID string, number int, part *models.Object) (*models.Part, error) {
+	if !part.ID.IsValidKey() {
+		return nil, models.ErrObjectIDNotValid
+	}
+	if !models.IsValidPartNumber(number) {
+		return nil, models.ErrPartNotValid
+	}
+	if mus.maxObjectSize > 0 && part.Size > mus.maxObjectSize {
+		return nil, models.ErrObjectTooLarge
+	}
+
+	storage, token, err := mus.uploadNode(uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	digests, _, err := parseDigests(part.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	content := part.Content
+	var dr *digestReader
+	if len(digests) > 0 {
+		dr = newDigestReader(content, part.Size, digests)
+		content = dr
+
+		if part.Size == 0 {
+			if err = dr.verify(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	stored, err := storage.PutObjectPart(ctx, part.ID.Value(), token.Upload, number, content, part.Size)
+	if err != nil {
+		if dr != nil && dr.mismatch {
+			return nil, models.ErrDigestMismatch
+		}
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// ListParts returns the parts of an upload in ascending number order
+func (mus *MultipartUploadService) ListParts(ctx context.Context, id, uploadID string) ([]*models.Part, error) {
+	storage, token, err := mus.uploadNode(uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.ListObjectParts(ctx, id, token.Upload)
+}
+
+// CompleteUpload assembles the object from the given parts, listed in ascending number order with their ETag,
+// and copies it to the other replicas of its ID. The object is only lost if the node holding the parts fails before the copy
+func (mus *MultipartUploadService) CompleteUpload(ctx context.Context, id, uploadID string, parts []*models.Part) (*models.Object, error) {
+	if !models.ObjectID(id).IsValidKey() {
+		return nil, models.ErrObjectIDNotValid
+	}
+	if len(parts) == 0 {
+		return nil, models.ErrPartNotValid
+	}
+
+	storage, token, err := mus.uploadNode(uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	if mus.maxObjectSize > 0 {
+		if err = mus.checkSize(ctx, storage, id, token.Upload, parts); err != nil {
+			return nil, err
+		}
+	}
+
+	obj, err := storage.CompleteMultipartUpload(ctx, id, token.Upload, parts)
+	if err != nil {
+		return nil, err
+	}
+
+	if mus.replicas != nil {
+		if err = mus.replicas.ReplicateObject(ctx, id, storage); err != nil {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not copy object %s to its replicas with error %s", id, err))
+		}
+	}
+
+	return obj, nil
+}
+
+// checkSize fails with models.ErrObjectTooLarge when the given parts add up to more than the maximum object size
+func (mus *MultipartUploadService) checkSize(ctx context.Context, storage ports.MultipartStorage, id, uploadID string, parts []*models.Part) error {
+	stored, err := storage.ListObjectParts(ctx, id, uploadID)
+	if err != nil {
+		return err
+	}
+
+	sizes := make(map[int]int64, len(stored))
+	for _, part := range stored {
+		sizes[part.Number] = part.Size
+	}
+
+	var size int64
+	for _, part := range parts {
+		size += sizes[part.Number]
+	}
+
+	if size > mus.maxObjectSize {
+		return models.ErrObjectTooLarge
+	}
+
+	return nil
+}
+
+// AbortUpload drops an upload and its parts
+func (mus *MultipartUploadService) AbortUpload(ctx context.Context, id, uploadID string) error {
+	storage, token, err := mus.uploadNode(uploadID)
+	if err != nil {
+		return err
+	}
+
+	return storage.AbortMultipartUpload(ctx, id, token.Upload)
+}
+
+// AbortStaleUploads aborts the uploads of every node initiated before the given time, and returns how many were aborted.
+// Nodes that fail are skipped until the next call
+func (mus *MultipartUploadService) AbortStaleUploads(ctx context.Context, initiatedBefore time.Time) (int, error) {
+	correlationID := context_wrapper.GetCorrelationID(ctx)
+
+	aborted := 0
+	var firstErr error
+	for _, node := range onlineNodes(mus.nps.Nodes()) {
+		storage, ok := nodeAs[ports.MultipartStorage](node)
+		if !ok {
+			continue
+		}
+
+		uploads, err := storage.ListMultipartUploads(ctx, initiatedBefore)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("node %s: %w", node.ID(), err)
+			}
+			continue
+		}
+
+		for _, upload := range uploads {
+			err = storage.AbortMultipartUpload(ctx, upload.ID.Value(), upload.UploadID)
+			switch {
+			case err == nil:
+				aborted++
+			case !errors.Is(err, models.ErrUploadNotFound):
+				log.Warnt(correlationID, fmt.Sprintf("could not abort upload of object %s on node %s with error %s", upload.ID.Value(), node.ID(), err))
+			}
+		}
+	}
+
+	return aborted, firstErr
+}
+
+// uploadNode returns the node holding the parts of an upload along with the decoded upload ID
+func (mus *MultipartUploadService) uploadNode(uploadID string) (ports.MultipartStorage, uploadToken, error) {
+	token, err := decodeUploadID(uploadID)
+	if err != nil {
+		return nil, token, err
+	}
+
+	node, ok := mus.nps.NodeByID(token.Node)
+	if !ok || !node.IsOnline() {
+		return nil, token, models.ErrObjectStorageNotAvailable
+	}
+
+	storage, ok := nodeAs[ports.MultipartStorage](node)
+	if !ok {
+		return nil, token, models.ErrMultipartNotSupported
+	}
+
+	return storage, token, nil
+}
+
+func decodeUploadID(uploadID string) (uploadToken, error) {
+	var token uploadToken
+
+	raw, err := base64.RawURLEncoding.DecodeString(uploadID)
+	if err != nil {
+		return token, models.ErrUploadNotFound
+	}
+
+	if err = json.Unmarshal(raw, &token); err != nil || token.Node == "" || token.Upload == "" {
+		return token, models.ErrUploadNotFound
+	}
+
+	return token, nil
+}
+
+func encodeUploadID(token uploadToken) (string, error) {
+	raw, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
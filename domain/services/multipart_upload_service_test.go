@@ -0,0 +1,90 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/discovery-service"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestMultipartUploadServiceReachesDecoratedNodes(t *testing.T) {
+	ctx := context.Background()
+
+	// discovery decorates nodes with their placement metadata, which must not hide their multipart support
+	nodes := make([]ports.ObjectStorage, 0, 2)
+	for i := 0; i < 2; i++ {
+		nodes = append(nodes, object_storage.WithNodeMetadata(object_storage.NewMemoryObjectStore(fmt.Sprintf("node-%d", i), 0), 1, ""))
+	}
+	nps := services.NewNodePoolService(discovery_service.NewMemoryDiscoveryService(nodes...), services.RingOptions{})
+	nps.RefreshNodes()
+
+	rs, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{Replicas: 2})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+	mus := services.NewMultipartUploadService(nps, rs, 0)
+
+	uploadID, err := mus.CreateUpload(ctx, &models.Object{ID: "assembled"})
+	if err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	first := bytes.Repeat([]byte("a"), models.MinPartSize)
+	parts := make([]*models.Part, 0, 2)
+	for number, content := range [][]byte{first, []byte("last")} {
+		part, err := mus.UploadPart(ctx, uploadID, number+1, &models.Object{ID: "assembled", Content: bytes.NewReader(content), Size: int64(len(content))})
+		if err != nil {
+			t.Fatalf("upload part %d: %v", number+1, err)
+		}
+		parts = append(parts, &models.Part{Number: number + 1, ETag: part.ETag})
+	}
+
+	if _, err = mus.CompleteUpload(ctx, "assembled", uploadID, parts); err != nil {
+		t.Fatalf("complete upload: %v", err)
+	}
+
+	// the completed object is copied to the other replica
+	want := string(first) + "last"
+	for _, node := range nodes {
+		if content := getObject(t, node, "assembled"); content != want {
+			t.Fatalf("node %s content of %d bytes, want %d bytes", node.ID(), len(content), len(want))
+		}
+	}
+
+	if _, err = mus.CreateUpload(ctx, &models.Object{ID: "stale"}); err != nil {
+		t.Fatalf("create stale upload: %v", err)
+	}
+
+	aborted, err := mus.AbortStaleUploads(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("abort stale uploads: %v", err)
+	}
+	if aborted != 1 {
+		t.Fatalf("aborted %d uploads, want 1", aborted)
+	}
+}
+
+func TestMultipartUploadServiceRejectsNodesWithoutMultipart(t *testing.T) {
+	node := object_storage.WithNodeMetadata(storageOnly{object_storage.NewMemoryObjectStore("node", 0)}, 1, "")
+	nps := services.NewNodePoolService(discovery_service.NewMemoryDiscoveryService(node), services.RingOptions{})
+	nps.RefreshNodes()
+
+	_, err := services.NewMultipartUploadService(nps, nil, 0).CreateUpload(context.Background(), &models.Object{ID: "object", Content: strings.NewReader("")})
+	if !errors.Is(err, models.ErrMultipartNotSupported) {
+		t.Fatalf("create upload error = %v, want %v", err, models.ErrMultipartNotSupported)
+	}
+}
+
+// storageOnly hides every method of a node but the ones of ports.ObjectStorage
+type storageOnly struct {
+	ports.ObjectStorage
+}
@@ -3,8 +3,8 @@ package services
 import (
 	"context"
 	"fmt"
-	"hash/crc32"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,50 +17,108 @@ import (
 	"github.com/google/uuid"
 )
 
-// RingNode represents a node in the object storage ring with its associated hash ID
+const defaultResyncInterval = 2 * time.Minute
+
+// RingNode represents a node in the object storage ring with its associated hash ID.
+// A physical node is placed several times on the ring when virtual nodes are enabled
 type RingNode struct {
 	Node   ports.ObjectStorage
-	HashID uint32
+	HashID uint64
+}
+
+// RingOptions configures how nodes are placed on the consistent hash ring
+type RingOptions struct {
+	// VirtualNodes is the number of ring positions of every physical node, one when lower than one
+	VirtualNodes int
+	// Hash places nodes and keys on the ring, crc32 when nil
+	Hash HashFunc
+}
+
+// Placement is a node chosen to hold a replica of a key.
+// HandoffFor is the ID of the offline owner the node stands in for, empty when the node is an owner itself
+type Placement struct {
+	Node       ports.ObjectStorage
+	HandoffFor string
+}
+
+// NodeDistribution reports how many of the sampled keys a physical node owns
+type NodeDistribution struct {
+	NodeID       string
+	Zone         string
+	VirtualNodes int
+	Keys         int
+	Share        float64
+}
+
+// RingChangeListener is notified every time the ring is rebuilt, with the ring nodes before and after the change
+type RingChangeListener interface {
+	RingChanged(previous, current []*RingNode)
 }
 
 // NodePoolService manages a pool of object storage nodes and provides methods for refreshing and balancing the nodes using consistent hashing
 type NodePoolService struct {
-	ds        ports.DiscoveryService
-	scheduler *gocron.Scheduler
-	nodes     []*RingNode
-	mu        sync.Mutex
+	ds           ports.DiscoveryService
+	scheduler    *gocron.Scheduler
+	nodes        []*RingNode
+	virtualNodes int
+	hash         HashFunc
+	listener     RingChangeListener
+	stopWatching context.CancelFunc
+	mu           sync.Mutex
+	// refreshMu serializes the periodic refreshes with those triggered by discovery watchers
+	refreshMu sync.Mutex
 }
 
 // NewNodePoolService creates a new instance of NodePoolService with the provided discovery service for node discovery
-func NewNodePoolService(ds ports.DiscoveryService) *NodePoolService {
+func NewNodePoolService(ds ports.DiscoveryService, opts RingOptions) *NodePoolService {
+	if opts.VirtualNodes < 1 {
+		opts.VirtualNodes = 1
+	}
+
+	if opts.Hash == nil {
+		opts.Hash, _ = NewHashFunc(HashFunctionCRC32)
+	}
+
 	return &NodePoolService{
-		ds:        ds,
-		scheduler: gocron.NewScheduler(time.UTC),
-		nodes:     make([]*RingNode, 0),
+		ds:           ds,
+		scheduler:    gocron.NewScheduler(time.UTC),
+		nodes:        make([]*RingNode, 0),
+		virtualNodes: opts.VirtualNodes,
+		hash:         opts.Hash,
 	}
 }
 
-// StartRefreshingNodes starts a periodic task for refreshing the pool of nodes discovered by the discovery service and balances them
-func (nps *NodePoolService) StartRefreshingNodes() error {
-	_, err := nps.scheduler.Every(2).Minutes().Do(func() {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(30)*time.Second)
-		defer cancel()
+// StartRefreshingNodes starts a periodic task for refreshing the pool of nodes discovered by the discovery service and balances them,
+// every two minutes when resyncInterval is not positive.
+// Discovery services implementing ports.DiscoveryWatcher also trigger a refresh as soon as they notice a membership change,
+// the periodic refresh then being a safety net for missed changes
+func (nps *NodePoolService) StartRefreshingNodes(resyncInterval time.Duration) error {
+	if resyncInterval <= 0 {
+		resyncInterval = defaultResyncInterval
+	}
 
-		correlationID := uuid.New().String()
-		ctx = context_wrapper.WithCorrelationID(ctx, correlationID)
+	_, err := nps.scheduler.Every(resyncInterval).Do(func() {
+		nps.RefreshNodes()
+	})
+	if err != nil {
+		return err
+	}
 
-		log.Infot(context_wrapper.GetCorrelationID(ctx), "refreshing pool nodes")
+	if watcher, ok := nps.ds.(ports.DiscoveryWatcher); ok {
+		ctx, cancel := context.WithCancel(context.Background())
 
-		nodes, err := nps.ds.DiscoverNodes(ctx)
+		changes, err := watcher.Watch(ctx)
 		if err != nil {
-			log.Errort(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not discover nodes with error %s", err))
-			return
+			cancel()
+			return err
 		}
+		nps.stopWatching = cancel
 
-		nps.BalanceNodes(nodes)
-	})
-	if err != nil {
-		return err
+		go func() {
+			for range changes {
+				nps.RefreshNodes()
+			}
+		}()
 	}
 
 	nps.scheduler.StartAsync()
@@ -68,23 +126,92 @@ func (nps *NodePoolService) StartRefreshingNodes() error {
 	return nil
 }
 
+// RefreshNodes discovers the current nodes and balances them on the ring
+func (nps *NodePoolService) RefreshNodes() {
+	nps.refreshMu.Lock()
+	defer nps.refreshMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(30)*time.Second)
+	defer cancel()
+
+	correlationID := uuid.New().String()
+	ctx = context_wrapper.WithCorrelationID(ctx, correlationID)
+
+	log.Infot(context_wrapper.GetCorrelationID(ctx), "refreshing pool nodes")
+
+	nodes, err := nps.ds.DiscoverNodes(ctx)
+	if err != nil {
+		log.Errort(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not discover nodes with error %s", err))
+		return
+	}
+
+	nps.BalanceNodes(nodes)
+}
+
+// SetRingChangeListener registers the listener notified after every ring rebuild
+func (nps *NodePoolService) SetRingChangeListener(listener RingChangeListener) {
+	nps.mu.Lock()
+	defer nps.mu.Unlock()
+
+	nps.listener = listener
+}
+
 // BalanceNodes updates the pool of nodes with the provided list of new nodes and recalculates their hash IDs for load balancing using consistent hashing
 func (nps *NodePoolService) BalanceNodes(newNodes []ports.ObjectStorage) {
 	nps.mu.Lock()
-	defer nps.mu.Unlock()
+	previous := nps.nodes
+	nps.nodes = nps.ringNodes(newNodes)
+	current, listener := nps.nodes, nps.listener
+	nps.mu.Unlock()
+
+	if listener != nil {
+		listener.RingChanged(previous, current)
+	}
+}
 
-	nps.nodes = make([]*RingNode, 0)
+// ringNodes places the given physical nodes on a new ring sorted by hash ID
+func (nps *NodePoolService) ringNodes(nodes []ports.ObjectStorage) []*RingNode {
+	ringNodes := make([]*RingNode, 0, len(nodes)*nps.virtualNodes)
 
-	for _, newNode := range newNodes {
-		nps.nodes = append(nps.nodes, &RingNode{
-			Node:   newNode,
-			HashID: crc32.ChecksumIEEE([]byte(newNode.ID())),
-		})
+	for _, node := range nodes {
+		for _, hashID := range nps.virtualNodeHashIDs(node) {
+			ringNodes = append(ringNodes, &RingNode{
+				Node:   node,
+				HashID: hashID,
+			})
+		}
 	}
 
-	sort.Slice(nps.nodes, func(i, j int) bool {
-		return nps.nodes[i].HashID < nps.nodes[j].HashID
+	sort.Slice(ringNodes, func(i, j int) bool {
+		if ringNodes[i].HashID == ringNodes[j].HashID {
+			return ringNodes[i].Node.ID() < ringNodes[j].Node.ID()
+		}
+		return ringNodes[i].HashID < ringNodes[j].HashID
 	})
+
+	return ringNodes
+}
+
+// virtualNodeHashIDs returns the ring positions of a physical node, scaled by its weight when it has one.
+// A node with a single position keeps its historical position at the hash of its ID
+func (nps *NodePoolService) virtualNodeHashIDs(node ports.ObjectStorage) []uint64 {
+	id := node.ID()
+
+	count := nps.virtualNodes
+	if metadata, ok := node.(ports.NodeMetadata); ok && metadata.Weight() > 1 {
+		count *= metadata.Weight()
+	}
+
+	if count == 1 {
+		return []uint64{nps.hash([]byte(id))}
+	}
+
+	hashIDs := make([]uint64, 0, count)
+	for i := 0; i < count; i++ {
+		hashIDs = append(hashIDs, nps.hash([]byte(id+"#"+strconv.Itoa(i))))
+	}
+
+	return hashIDs
 }
 
 // GetNode returns the object storage node responsible for the given key based on the consistent hash ring
@@ -96,22 +223,187 @@ func (nps *NodePoolService) GetNode(key string) (ports.ObjectStorage, error) {
 		return nil, fmt.Errorf("no nodes in the pool")
 	}
 
-	i := sort.Search(len(nps.nodes), func(i int) bool {
-		return nps.nodes[i].HashID >= crc32.ChecksumIEEE([]byte(key))
+	i := ringIndex(nps.nodes, nps.hash([]byte(key)))
+
+	if !nps.nodes[i].Node.IsOnline() {
+		return nil, models.ErrObjectStorageNotAvailable
+	}
+
+	return nps.nodes[i].Node, nil
+}
+
+// GetNodes walks the ring clockwise from the key position and returns up to n distinct physical nodes, online or not.
+// The first node is the one GetNode would return
+func (nps *NodePoolService) GetNodes(key string, n int) ([]ports.ObjectStorage, error) {
+	nps.mu.Lock()
+	defer nps.mu.Unlock()
+
+	if len(nps.nodes) == 0 {
+		return nil, fmt.Errorf("no nodes in the pool")
+	}
+
+	return ringOwners(nps.nodes, nps.hash([]byte(key)), n), nil
+}
+
+// GetHealthyNodes returns the placements of the n replicas of a key.
+// Offline owners among the first n nodes clockwise are replaced by the next online successors on the ring,
+// and an owner is only reported as is when no successor is left to replace it
+func (nps *NodePoolService) GetHealthyNodes(key string, n int) ([]Placement, error) {
+	nodes, err := nps.GetNodes(key, len(nps.Nodes()))
+	if err != nil {
+		return nil, err
+	}
+
+	owners := nodes[:min(n, len(nodes))]
+	successors := onlineNodes(nodes[len(owners):])
+
+	placements := make([]Placement, 0, len(owners))
+	for _, owner := range owners {
+		if owner.IsOnline() || len(successors) == 0 {
+			placements = append(placements, Placement{Node: owner})
+			continue
+		}
+
+		placements = append(placements, Placement{Node: successors[0], HandoffFor: owner.ID()})
+		successors = successors[1:]
+	}
+
+	return placements, nil
+}
+
+// NodeByID returns the physical node of the pool with the given ID
+func (nps *NodePoolService) NodeByID(id string) (ports.ObjectStorage, bool) {
+	for _, node := range nps.Nodes() {
+		if node.ID() == id {
+			return node, true
+		}
+	}
+
+	return nil, false
+}
+
+// nodeAs returns the node as a T, looking through the decorators implementing ports.NodeDecorator
+func nodeAs[T any](node ports.ObjectStorage) (T, bool) {
+	for {
+		if t, ok := node.(T); ok {
+			return t, true
+		}
+
+		decorator, ok := node.(ports.NodeDecorator)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		node = decorator.Unwrap()
+	}
+}
+
+// ringIndex returns the index of the first ring node clockwise from the hash position, the ring must not be empty
+func ringIndex(ringNodes []*RingNode, hashID uint64) int {
+	i := sort.Search(len(ringNodes), func(i int) bool {
+		return ringNodes[i].HashID >= hashID
 	})
 
-	if i >= len(nps.nodes) {
+	if i >= len(ringNodes) {
 		i = 0
 	}
 
-	if !nps.nodes[i].Node.IsOnline() {
-		return nil, models.ErrObjectStorageNotAvailable
+	return i
+}
+
+// ringOwners walks the ring clockwise from the hash position and returns up to n distinct physical nodes
+func ringOwners(ringNodes []*RingNode, hashID uint64, n int) []ports.ObjectStorage {
+	if len(ringNodes) == 0 {
+		return nil
 	}
 
-	return nps.nodes[i].Node, nil
+	nodes := make([]ports.ObjectStorage, 0, min(n, len(ringNodes)))
+	seen := make(map[string]bool, cap(nodes))
+
+	start := ringIndex(ringNodes, hashID)
+	for offset := 0; offset < len(ringNodes) && len(nodes) < n; offset++ {
+		node := ringNodes[(start+offset)%len(ringNodes)].Node
+		if seen[node.ID()] {
+			continue
+		}
+		seen[node.ID()] = true
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+// KeyHash returns the position of a key on the ring
+func (nps *NodePoolService) KeyHash(key string) uint64 {
+	return nps.hash([]byte(key))
+}
+
+// DistributionReport counts how many of the given keys each physical node of the ring owns
+func (nps *NodePoolService) DistributionReport(keys []string) []NodeDistribution {
+	nps.mu.Lock()
+	defer nps.mu.Unlock()
+
+	report := make([]NodeDistribution, 0)
+	positions := make(map[string]int)
+	for _, ringNode := range nps.nodes {
+		id := ringNode.Node.ID()
+		if _, ok := positions[id]; !ok {
+			positions[id] = len(report)
+			report = append(report, NodeDistribution{NodeID: id})
+			if metadata, ok := ringNode.Node.(ports.NodeMetadata); ok {
+				report[positions[id]].Zone = metadata.Zone()
+			}
+		}
+		report[positions[id]].VirtualNodes++
+	}
+
+	if len(nps.nodes) == 0 {
+		return report
+	}
+
+	for _, key := range keys {
+		report[positions[nps.nodes[ringIndex(nps.nodes, nps.hash([]byte(key)))].Node.ID()]].Keys++
+	}
+
+	for i := range report {
+		if len(keys) > 0 {
+			report[i].Share = float64(report[i].Keys) / float64(len(keys))
+		}
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].NodeID < report[j].NodeID
+	})
+
+	return report
+}
+
+// Nodes returns every physical object storage node of the pool, ordered by ID
+func (nps *NodePoolService) Nodes() []ports.ObjectStorage {
+	nps.mu.Lock()
+	defer nps.mu.Unlock()
+
+	seen := make(map[string]bool, len(nps.nodes))
+	nodes := make([]ports.ObjectStorage, 0, len(nps.nodes))
+	for _, ringNode := range nps.nodes {
+		if seen[ringNode.Node.ID()] {
+			continue
+		}
+		seen[ringNode.Node.ID()] = true
+		nodes = append(nodes, ringNode.Node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID() < nodes[j].ID()
+	})
+
+	return nodes
 }
 
-// StopRefreshingNodes stops the periodic node refreshing task
+// StopRefreshingNodes stops the periodic node refreshing task and the discovery watcher
 func (nps *NodePoolService) StopRefreshingNodes() {
 	nps.scheduler.Stop()
+	if nps.stopWatching != nil {
+		nps.stopWatching()
+	}
 }
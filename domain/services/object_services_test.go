@@ -0,0 +1,135 @@
+package services_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestPutObjectServiceVerifiesDigests(t *testing.T) {
+	ctx := context.Background()
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	pos := services.NewPutObjectService(node, 0)
+
+	digest := sha256.Sum256([]byte("content"))
+	err := pos.PutObject(ctx, &models.Object{
+		ID:       "verified",
+		Content:  strings.NewReader("content"),
+		Size:     7,
+		Metadata: map[string]string{models.MetadataSHA256: hex.EncodeToString(digest[:])},
+	})
+	if err != nil {
+		t.Fatalf("put object: %v", err)
+	}
+	if content := getObject(t, node, "verified"); content != "content" {
+		t.Fatalf("content = %q, want %q", content, "content")
+	}
+
+	err = pos.PutObject(ctx, &models.Object{
+		ID:       "corrupted",
+		Content:  strings.NewReader("corrupted"),
+		Size:     9,
+		Metadata: map[string]string{models.MetadataSHA256: hex.EncodeToString(digest[:])},
+	})
+	if !errors.Is(err, models.ErrDigestMismatch) {
+		t.Fatalf("put error = %v, want %v", err, models.ErrDigestMismatch)
+	}
+	if _, err = node.StatObject(ctx, "corrupted"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("stat error of the rejected object = %v, want %v", err, models.ErrObjectNotFound)
+	}
+}
+
+func TestPutObjectServiceEnforcesMaxSize(t *testing.T) {
+	ctx := context.Background()
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	pos := services.NewPutObjectService(node, 4)
+
+	if err := pos.PutObject(ctx, &models.Object{ID: "fits", Content: strings.NewReader("1234"), Size: 4}); err != nil {
+		t.Fatalf("put object of the maximum size: %v", err)
+	}
+
+	// a declared size can't be trusted, so chunked uploads are limited while streaming
+	err := pos.PutObject(ctx, &models.Object{ID: "chunked", Content: strings.NewReader("12345"), Size: -1})
+	if !errors.Is(err, models.ErrObjectTooLarge) {
+		t.Fatalf("put error = %v, want %v", err, models.ErrObjectTooLarge)
+	}
+	if _, err = node.StatObject(ctx, "chunked"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("stat error of the rejected object = %v, want %v", err, models.ErrObjectNotFound)
+	}
+
+	err = pos.PutObject(ctx, &models.Object{ID: "declared", Content: strings.NewReader("12345"), Size: 5})
+	if !errors.Is(err, models.ErrObjectTooLarge) {
+		t.Fatalf("put error = %v, want %v", err, models.ErrObjectTooLarge)
+	}
+}
+
+func TestGetObjectServiceReadsRanges(t *testing.T) {
+	ctx := context.Background()
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	putObject(t, node, "ranged", "0123456789")
+
+	gos := services.NewGetObjectService(node, true)
+	for _, test := range []struct {
+		rng  models.ByteRange
+		want string
+	}{
+		{rng: models.ByteRange{Start: 2, End: 4}, want: "234"},
+		{rng: models.ByteRange{Start: 7, End: -1}, want: "789"},
+		{rng: models.ByteRange{Start: -1, End: 2}, want: "89"},
+		{rng: models.ByteRange{Start: 8, End: 20}, want: "89"},
+	} {
+		rng := test.rng
+		obj, err := gos.GetObject(ctx, "ranged", &rng)
+		if err != nil {
+			t.Fatalf("get range %+v: %v", test.rng, err)
+		}
+		content, err := io.ReadAll(obj.Content)
+		if err != nil {
+			t.Fatalf("read range %+v: %v", test.rng, err)
+		}
+		if string(content) != test.want {
+			t.Errorf("range %+v content = %q, want %q", test.rng, content, test.want)
+		}
+	}
+
+	if _, err := gos.GetObject(ctx, "ranged", &models.ByteRange{Start: 10, End: -1}); !errors.Is(err, models.ErrRangeNotSatisfiable) {
+		t.Fatalf("get error = %v, want %v", err, models.ErrRangeNotSatisfiable)
+	}
+}
+
+func TestStatAndDeleteObjectServices(t *testing.T) {
+	ctx := context.Background()
+	node := object_storage.NewMemoryObjectStore("node", 0)
+	putObject(t, node, "deleted", "content")
+
+	sos := services.NewStatObjectService(node)
+	stat, err := sos.StatObject(ctx, "deleted")
+	if err != nil {
+		t.Fatalf("stat object: %v", err)
+	}
+	if stat.Size != 7 {
+		t.Fatalf("size = %d, want 7", stat.Size)
+	}
+
+	dos := services.NewDeleteObjectService(node)
+	if err = dos.DeleteObject(ctx, "deleted"); err != nil {
+		t.Fatalf("delete object: %v", err)
+	}
+	if _, err = sos.StatObject(ctx, "deleted"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("stat error = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	if err = dos.DeleteObject(ctx, "deleted"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("delete error = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	if _, err = sos.StatObject(ctx, "~reserved"); !errors.Is(err, models.ErrObjectIDNotValid) {
+		t.Fatalf("stat error = %v, want %v", err, models.ErrObjectIDNotValid)
+	}
+}
@@ -2,29 +2,128 @@ package services
 
 import (
 	"context"
+	"encoding/hex"
+	"io"
 
 	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
 )
 
 type PutObjectService struct {
-	nps *NodePoolService
+	storage       ports.ObjectStorage
+	maxObjectSize int64
 }
 
-func NewPutObjectService(nps *NodePoolService) *PutObjectService {
+// NewPutObjectService creates a new instance of PutObjectService.
+// A maxObjectSize lower or equal to zero disables the object size limit
+func NewPutObjectService(storage ports.ObjectStorage, maxObjectSize int64) *PutObjectService {
 	return &PutObjectService{
-		nps: nps,
+		storage:       storage,
+		maxObjectSize: maxObjectSize,
 	}
 }
 
+// PutObject streams an object to the storage. Digests found in the object metadata, base64 or hex encoded,
+// are verified while streaming and stored hex encoded, a mismatch failing with models.ErrDigestMismatch
 func (pos *PutObjectService) PutObject(ctx context.Context, obj *models.Object) error {
-	if !obj.ID.IsValidID() {
+	if !obj.ID.IsValidKey() {
 		return models.ErrObjectIDNotValid
 	}
 
-	objectStorageNode, err := pos.nps.GetNode(obj.ID.Value())
+	if pos.maxObjectSize > 0 && obj.Size > pos.maxObjectSize {
+		return models.ErrObjectTooLarge
+	}
+
+	digests, metadata, err := parseDigests(obj.Metadata)
 	if err != nil {
 		return err
 	}
 
-	return objectStorageNode.PutObject(ctx, obj)
+	checkedObj := *obj
+	checkedObj.Metadata = metadata
+
+	var dr *digestReader
+	if len(digests) > 0 {
+		dr = newDigestReader(obj.Content, obj.Size, digests)
+		checkedObj.Content = dr
+
+		// storages may not read an empty content at all
+		if obj.Size == 0 {
+			if err = dr.verify(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the declared size can't be trusted for chunked uploads, so the limit is enforced while streaming
+	var lr *limitedReader
+	if pos.maxObjectSize > 0 {
+		lr = &limitedReader{r: checkedObj.Content, remaining: pos.maxObjectSize}
+		checkedObj.Content = lr
+	}
+
+	if err = pos.storage.PutObject(ctx, &checkedObj); err != nil {
+		switch {
+		case lr != nil && lr.exceeded:
+			return models.ErrObjectTooLarge
+		case dr != nil && dr.mismatch:
+			return models.ErrDigestMismatch
+		}
+		return err
+	}
+
+	return nil
+}
+
+// parseDigests decodes the digests of the object metadata, and returns a copy of the metadata with hex encoded digests
+func parseDigests(metadata map[string]string) (map[string][]byte, map[string]string, error) {
+	if len(metadata) == 0 {
+		return nil, metadata, nil
+	}
+
+	digests := make(map[string][]byte)
+	normalized := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		normalized[key] = value
+
+		if key != models.MetadataSHA256 && key != models.MetadataMD5 {
+			continue
+		}
+
+		digest, err := models.ParseDigest(key, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		digests[key] = digest
+		normalized[key] = hex.EncodeToString(digest)
+	}
+
+	return digests, normalized, nil
+}
+
+// limitedReader reads from r until more than remaining bytes have been read, failing with models.ErrObjectTooLarge from then on
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.exceeded {
+		return 0, models.ErrObjectTooLarge
+	}
+
+	// read one byte past the limit so that content of exactly the maximum size is accepted
+	if int64(len(p)) > lr.remaining+1 {
+		p = p[:lr.remaining+1]
+	}
+
+	n, err := lr.r.Read(p)
+	lr.remaining -= int64(n)
+	if lr.remaining < 0 {
+		lr.exceeded = true
+		return 0, models.ErrObjectTooLarge
+	}
+
+	return n, err
 }
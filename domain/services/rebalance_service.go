@@ -0,0 +1,632 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"github.com/google/uuid"
+	"golang.org/x/time/rate"
+)
+
+const rebalanceListPageSize = 1000
+
+// RebalanceOptions configures how objects are migrated after ring membership changes
+type RebalanceOptions struct {
+	// Replicas is the replication factor objects were written with
+	Replicas int
+	// ObjectsPerSecond throttles the number of objects copied per second, unlimited when lower or equal to zero
+	ObjectsPerSecond float64
+	// StateFile persists the migration state so it can be resumed after a restart, disabled when empty
+	StateFile string
+}
+
+// MovedRange is an arc (Start, End] of the ring whose owners changed, wrapping around zero when Start >= End.
+// Objects hashed in the range are copied from the previous owners to the new owners that didn't hold them,
+// and then removed from the previous owners that no longer own the range
+type MovedRange struct {
+	Start   uint64
+	End     uint64
+	Sources []ports.ObjectStorage
+	Targets []ports.ObjectStorage
+	// Stale are the previous owners that aren't owners anymore
+	Stale    []ports.ObjectStorage
+	migrated bool
+}
+
+// RebalanceProgress reports the state of the current or last migration
+type RebalanceProgress struct {
+	Active         bool
+	StartedAt      time.Time
+	FinishedAt     time.Time
+	Ranges         int
+	MigratedRanges int
+	Scanned        int64
+	Copied         int64
+	Skipped        int64
+	Removed        int64
+	Failed         int64
+}
+
+// rebalanceState is the persisted part of a migration
+type rebalanceState struct {
+	BaselineNodeIDs []string
+	TargetNodeIDs   []string
+	Checkpoints     map[string]string
+}
+
+// RebalanceService migrates objects to their new owners when the ring membership changes.
+// It keeps the baseline ring, the last ring whose object placement is fully migrated, and copies the
+// key ranges that moved between the baseline and the current ring. Reads can fall back to the previous
+// owners of ranges that are not migrated yet
+type RebalanceService struct {
+	nps       *NodePoolService
+	replicas  int
+	limiter   *rate.Limiter
+	stateFile string
+
+	baseline []*RingNode
+	target   []*RingNode
+	ranges   []*MovedRange
+	// checkpoints hold, for each source node, the last object ID migrated
+	checkpoints map[string]string
+	progress    RebalanceProgress
+	// pending is the state loaded from the state file until the first ring change resumes it
+	pending *rebalanceState
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mu      sync.Mutex
+	// runMu serializes ring changes and Stop, which start and stop the migration, cancel and done being guarded by it
+	runMu sync.Mutex
+	// saveMu keeps saves in order, so that an older state never overwrites a newer one
+	saveMu sync.Mutex
+}
+
+// NewRebalanceService creates a new instance of RebalanceService, loading the state of an interrupted migration when there is one
+func NewRebalanceService(nps *NodePoolService, opts RebalanceOptions) (*RebalanceService, error) {
+	if opts.Replicas < 1 {
+		opts.Replicas = 1
+	}
+
+	limit := rate.Inf
+	if opts.ObjectsPerSecond > 0 {
+		limit = rate.Limit(opts.ObjectsPerSecond)
+	}
+
+	rbs := &RebalanceService{
+		nps:         nps,
+		replicas:    opts.Replicas,
+		limiter:     rate.NewLimiter(limit, 1),
+		stateFile:   opts.StateFile,
+		checkpoints: make(map[string]string),
+	}
+
+	if opts.StateFile != "" {
+		raw, err := os.ReadFile(opts.StateFile)
+		switch {
+		case err == nil:
+			var state rebalanceState
+			if err = json.Unmarshal(raw, &state); err != nil {
+				return nil, fmt.Errorf("read rebalance state: %w", err)
+			}
+			rbs.pending = &state
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("read rebalance state: %w", err)
+		}
+	}
+
+	return rbs, nil
+}
+
+// RingChanged diffs the baseline ring with the new ring and migrates the ranges that moved.
+// A running migration towards another ring is cancelled and restarted from the baseline
+func (rbs *RebalanceService) RingChanged(previous, current []*RingNode) {
+	rbs.runMu.Lock()
+	defer rbs.runMu.Unlock()
+
+	rbs.mu.Lock()
+	if rbs.baseline == nil {
+		rbs.baseline = previous
+		if rbs.pending != nil {
+			rbs.resume(current)
+		}
+	}
+
+	// refreshes keep rebuilding the same ring, which only restarts a migration that stopped before completing
+	unchanged := sameRing(rbs.target, current) && (rbs.progress.Active || sameRing(rbs.baseline, rbs.target))
+	rbs.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	rbs.stop()
+
+	rbs.mu.Lock()
+	targetChanged := !sameRing(rbs.target, current)
+	rbs.target = current
+	rbs.ranges = diffRings(rbs.baseline, current, rbs.replicas)
+	if targetChanged {
+		rbs.checkpoints = make(map[string]string)
+	}
+
+	if len(rbs.ranges) == 0 {
+		rbs.baseline = current
+		rbs.checkpoints = make(map[string]string)
+		rbs.mu.Unlock()
+		rbs.saveState()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = context_wrapper.WithCorrelationID(ctx, uuid.New().String())
+	rbs.cancel = cancel
+	rbs.done = make(chan struct{})
+	rbs.progress = RebalanceProgress{
+		Active:    true,
+		StartedAt: time.Now(),
+		Ranges:    len(rbs.ranges),
+	}
+	ranges := rbs.ranges
+	rbs.mu.Unlock()
+
+	rbs.saveState()
+
+	log.Infot(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("ring membership changed, migrating %d key ranges", len(ranges)))
+
+	go rbs.migrate(ctx, ranges, rbs.done)
+}
+
+// resume restores the baseline ring and checkpoints of an interrupted migration, the lock must be held
+func (rbs *RebalanceService) resume(current []*RingNode) {
+	state := rbs.pending
+	rbs.pending = nil
+
+	// the nodes of the baseline that are still discovered are the only ones whose data can be reached
+	nodesByID := make(map[string]ports.ObjectStorage)
+	for _, ringNode := range current {
+		nodesByID[ringNode.Node.ID()] = ringNode.Node
+	}
+
+	baselineNodes := make([]ports.ObjectStorage, 0, len(state.BaselineNodeIDs))
+	for _, id := range state.BaselineNodeIDs {
+		if node, ok := nodesByID[id]; ok {
+			baselineNodes = append(baselineNodes, node)
+		}
+	}
+	rbs.baseline = rbs.nps.ringNodes(baselineNodes)
+
+	// checkpoints are only meaningful when migrating towards the same ring
+	if sameNodeIDs(ringNodeIDs(current), state.TargetNodeIDs) {
+		rbs.target = current
+		rbs.checkpoints = state.Checkpoints
+	}
+}
+
+// PreviousOwners returns the previous owners of a key whose range is still being migrated, nil otherwise
+func (rbs *RebalanceService) PreviousOwners(key string) []ports.ObjectStorage {
+	hashID := rbs.nps.KeyHash(key)
+
+	rbs.mu.Lock()
+	defer rbs.mu.Unlock()
+
+	for _, r := range rbs.ranges {
+		if !r.migrated && r.contains(hashID) {
+			return r.Sources
+		}
+	}
+
+	return nil
+}
+
+// Progress returns the progress of the current or last migration
+func (rbs *RebalanceService) Progress() RebalanceProgress {
+	rbs.mu.Lock()
+	defer rbs.mu.Unlock()
+
+	return rbs.progress
+}
+
+// Stop cancels the running migration, its state is kept to resume it later
+func (rbs *RebalanceService) Stop() {
+	rbs.runMu.Lock()
+	defer rbs.runMu.Unlock()
+
+	rbs.stop()
+	rbs.saveState()
+}
+
+// stop cancels the migration and waits for it to return. runMu must be held, and the lock must not
+// since the migration takes it until it returns
+func (rbs *RebalanceService) stop() {
+	if rbs.cancel == nil {
+		return
+	}
+
+	rbs.cancel()
+	<-rbs.done
+	rbs.cancel, rbs.done = nil, nil
+}
+
+// migrate copies the objects of the moved ranges, scanning every source node once
+func (rbs *RebalanceService) migrate(ctx context.Context, ranges []*MovedRange, done chan struct{}) {
+	defer close(done)
+
+	correlationID := context_wrapper.GetCorrelationID(ctx)
+
+	tasks := make(map[string][]*MovedRange)
+	sources := make(map[string]ports.ObjectStorage)
+	for _, r := range ranges {
+		online := onlineNodes(r.Sources)
+		if len(online) == 0 {
+			log.Warnt(correlationID, fmt.Sprintf("no previous owner online to migrate range (%d, %d]", r.Start, r.End))
+			continue
+		}
+		tasks[online[0].ID()] = append(tasks[online[0].ID()], r)
+		sources[online[0].ID()] = online[0]
+	}
+
+	for sourceID, sourceRanges := range tasks {
+		migrated, err := rbs.migrateSource(ctx, sources[sourceID], sourceRanges)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Errort(correlationID, fmt.Sprintf("could not migrate objects from node %s with error %s", sourceID, err))
+			}
+			continue
+		}
+
+		rbs.mu.Lock()
+		for _, r := range migrated {
+			r.migrated = true
+			rbs.progress.MigratedRanges++
+		}
+		rbs.mu.Unlock()
+	}
+
+	rbs.mu.Lock()
+	if ctx.Err() != nil {
+		rbs.mu.Unlock()
+		return
+	}
+
+	rbs.progress.Active = false
+	rbs.progress.FinishedAt = time.Now()
+
+	if rbs.progress.MigratedRanges == rbs.progress.Ranges {
+		rbs.baseline = rbs.target
+		rbs.ranges = nil
+		rbs.checkpoints = make(map[string]string)
+		log.Infot(correlationID, fmt.Sprintf("migration finished, %d objects copied", rbs.progress.Copied))
+	} else {
+		log.Warnt(correlationID, fmt.Sprintf("migration finished with %d of %d ranges migrated, it is retried on the next ring refresh", rbs.progress.MigratedRanges, rbs.progress.Ranges))
+	}
+	rbs.mu.Unlock()
+
+	rbs.saveState()
+}
+
+// migrateSource lists every object of a source node from its checkpoint and copies those hashed in the given ranges.
+// It returns the ranges whose objects were all copied, the checkpoint only moving forward until a copy fails
+// so that the next migration lists the failed objects again
+func (rbs *RebalanceService) migrateSource(ctx context.Context, source ports.ObjectStorage, ranges []*MovedRange) ([]*MovedRange, error) {
+	rbs.mu.Lock()
+	startAfter := rbs.checkpoints[source.ID()]
+	rbs.mu.Unlock()
+
+	failed := make(map[*MovedRange]bool)
+	for {
+		page, err := source.ListObjects(ctx, "", startAfter, rebalanceListPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page {
+			hashID := rbs.nps.KeyHash(obj.ID.Value())
+			for _, r := range ranges {
+				if !r.contains(hashID) {
+					continue
+				}
+				copied := true
+				for _, target := range r.Targets {
+					if err = rbs.copyObject(ctx, source, target, obj); err != nil {
+						failed[r], copied = true, false
+					}
+				}
+				// stale copies are only removed once every target holds the object, since deletes and listings
+				// stop reaching the previous owners when the range is migrated
+				if copied {
+					for _, stale := range r.Stale {
+						if err = rbs.removeStaleCopy(ctx, stale, r.Targets, obj); err != nil {
+							failed[r] = true
+						}
+					}
+				}
+				break
+			}
+
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+
+		if len(page) == 0 {
+			break
+		}
+
+		startAfter = page[len(page)-1].ID.Value()
+
+		rbs.mu.Lock()
+		rbs.progress.Scanned += int64(len(page))
+		checkpoint := len(failed) == 0
+		if checkpoint {
+			rbs.checkpoints[source.ID()] = startAfter
+		}
+		rbs.mu.Unlock()
+
+		if checkpoint {
+			rbs.saveState()
+		}
+
+		if len(page) < rebalanceListPageSize {
+			break
+		}
+	}
+
+	migrated := make([]*MovedRange, 0, len(ranges))
+	for _, r := range ranges {
+		if !failed[r] {
+			migrated = append(migrated, r)
+		}
+	}
+
+	return migrated, nil
+}
+
+// copyObject copies an object to a target node unless the target already holds the same or a newer copy.
+// Objects skipped because the target is up to date or because they were deleted since they were listed don't fail
+func (rbs *RebalanceService) copyObject(ctx context.Context, source, target ports.ObjectStorage, listed *models.Object) error {
+	outcome := &rbs.progress.Failed
+	defer func() {
+		rbs.mu.Lock()
+		*outcome++
+		rbs.mu.Unlock()
+	}()
+
+	if err := rbs.limiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	current, err := target.StatObject(ctx, listed.ID.Value())
+	if err == nil && !current.LastModified.Before(listed.LastModified) {
+		outcome = &rbs.progress.Skipped
+		return nil
+	}
+	if err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+		log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not stat object %s on node %s with error %s", listed.ID.Value(), target.ID(), err))
+		return err
+	}
+
+	obj, err := source.GetObject(ctx, listed.ID.Value(), nil)
+	if err != nil {
+		// objects deleted since they were listed don't need to be migrated
+		if errors.Is(err, models.ErrObjectNotFound) {
+			outcome = &rbs.progress.Skipped
+			return nil
+		}
+		log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not read object %s from node %s with error %s", listed.ID.Value(), source.ID(), err))
+		return err
+	}
+	if closer, ok := obj.Content.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if err = target.PutObject(ctx, obj); err != nil {
+		log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not copy object %s to node %s with error %s", listed.ID.Value(), target.ID(), err))
+		return err
+	}
+
+	outcome = &rbs.progress.Copied
+
+	return nil
+}
+
+// removeStaleCopy deletes the copy of a migrated object from a node that doesn't own it anymore. A copy newer than
+// the migrated one, written while the node was still an owner, is copied to the targets before being deleted
+func (rbs *RebalanceService) removeStaleCopy(ctx context.Context, stale ports.ObjectStorage, targets []ports.ObjectStorage, migrated *models.Object) error {
+	current, err := stale.StatObject(ctx, migrated.ID.Value())
+	if errors.Is(err, models.ErrObjectNotFound) {
+		return nil
+	}
+	if err == nil && current.LastModified.After(migrated.LastModified) {
+		for _, target := range targets {
+			if err = rbs.copyObject(ctx, stale, target, current); err != nil {
+				return err
+			}
+		}
+	}
+	if err == nil {
+		err = stale.DeleteObject(ctx, migrated.ID.Value())
+	}
+	if err != nil && !errors.Is(err, models.ErrObjectNotFound) {
+		log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not remove object %s from node %s with error %s", migrated.ID.Value(), stale.ID(), err))
+		return err
+	}
+
+	rbs.mu.Lock()
+	rbs.progress.Removed++
+	rbs.mu.Unlock()
+
+	return nil
+}
+
+// saveState persists the migration state when a state file is configured. The state is copied under the lock,
+// which must not be held, and written without it so that reads and progress updates don't wait for the disk
+func (rbs *RebalanceService) saveState() {
+	if rbs.stateFile == "" {
+		return
+	}
+
+	rbs.saveMu.Lock()
+	defer rbs.saveMu.Unlock()
+
+	rbs.mu.Lock()
+	state := rebalanceState{
+		BaselineNodeIDs: ringNodeIDs(rbs.baseline),
+		TargetNodeIDs:   ringNodeIDs(rbs.target),
+		Checkpoints:     maps.Clone(rbs.checkpoints),
+	}
+	rbs.mu.Unlock()
+
+	raw, err := json.Marshal(state)
+	if err != nil {
+		log.Errorf("could not encode rebalance state with error %s", err)
+		return
+	}
+
+	tmp := rbs.stateFile + ".tmp"
+	if err = os.WriteFile(tmp, raw, 0o644); err == nil {
+		err = os.Rename(tmp, rbs.stateFile)
+	}
+	if err != nil {
+		log.Errorf("could not save rebalance state with error %s", err)
+	}
+}
+
+// contains reports whether a hash position falls in the range
+func (r *MovedRange) contains(hashID uint64) bool {
+	if r.Start < r.End {
+		return hashID > r.Start && hashID <= r.End
+	}
+
+	return hashID > r.Start || hashID <= r.End
+}
+
+// diffRings returns the ranges of the ring whose n owners in current include nodes that weren't owners in previous.
+// Every arc between two consecutive positions of either ring has the same owners in each ring, so owners are compared arc by arc
+func diffRings(previous, current []*RingNode, n int) []*MovedRange {
+	if len(previous) == 0 || len(current) == 0 {
+		return nil
+	}
+
+	positions := make([]uint64, 0, len(previous)+len(current))
+	for _, ringNode := range previous {
+		positions = append(positions, ringNode.HashID)
+	}
+	for _, ringNode := range current {
+		positions = append(positions, ringNode.HashID)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	positions = slices.Compact(positions)
+
+	ranges := make([]*MovedRange, 0)
+	for i, end := range positions {
+		// with a single position, start equals end and the range covers the whole ring
+		start := positions[(i+len(positions)-1)%len(positions)]
+
+		sources, owners := ringOwners(previous, end, n), ringOwners(current, end, n)
+		targets := missingNodes(owners, sources)
+		if len(targets) == 0 {
+			continue
+		}
+		stale := missingNodes(sources, owners)
+
+		// consecutive arcs moving between the same nodes are merged into a single range
+		if last := len(ranges) - 1; last >= 0 && ranges[last].End == start && sameNodes(ranges[last].Sources, sources) &&
+			sameNodes(ranges[last].Targets, targets) && sameNodes(ranges[last].Stale, stale) {
+			ranges[last].End = end
+			continue
+		}
+
+		ranges = append(ranges, &MovedRange{Start: start, End: end, Sources: sources, Targets: targets, Stale: stale})
+	}
+
+	return ranges
+}
+
+// missingNodes returns the nodes that are not in others
+func missingNodes(nodes, others []ports.ObjectStorage) []ports.ObjectStorage {
+	missing := make([]ports.ObjectStorage, 0)
+	for _, node := range nodes {
+		found := false
+		for _, other := range others {
+			if other.ID() == node.ID() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, node)
+		}
+	}
+
+	return missing
+}
+
+func sameNodes(a, b []ports.ObjectStorage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].ID() != b[i].ID() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameRing(a, b []*RingNode) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].HashID != b[i].HashID || a[i].Node.ID() != b[i].Node.ID() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ringNodeIDs returns the sorted IDs of the physical nodes of a ring
+func ringNodeIDs(ringNodes []*RingNode) []string {
+	seen := make(map[string]bool)
+	ids := make([]string, 0)
+	for _, ringNode := range ringNodes {
+		if !seen[ringNode.Node.ID()] {
+			seen[ringNode.Node.ID()] = true
+			ids = append(ids, ringNode.Node.ID())
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+func sameNodeIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
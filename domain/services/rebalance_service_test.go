@@ -0,0 +1,162 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/discovery-service"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestRebalanceServiceKeepsFailedRangesUntilCopied(t *testing.T) {
+	nodeA := object_storage.NewMemoryObjectStore("node-a", 0)
+	nodeB := object_storage.NewMemoryObjectStore("node-b", 0)
+	nps := services.NewNodePoolService(discovery_service.NewMemoryDiscoveryService(), services.RingOptions{})
+
+	rbs, err := services.NewRebalanceService(nps, services.RebalanceOptions{
+		Replicas:  1,
+		StateFile: filepath.Join(t.TempDir(), "rebalance-state.json"),
+	})
+	if err != nil {
+		t.Fatalf("create rebalance service: %v", err)
+	}
+	defer rbs.Stop()
+	nps.SetRingChangeListener(rbs)
+
+	nps.BalanceNodes([]ports.ObjectStorage{nodeA})
+
+	keys := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("object%d", i)
+		putObject(t, nodeA, key, key)
+		keys = append(keys, key)
+	}
+
+	nodeB.SetOnline(false)
+	nps.BalanceNodes([]ports.ObjectStorage{nodeA, nodeB})
+	progress := waitForMigration(t, rbs)
+
+	if progress.Failed == 0 || progress.MigratedRanges == progress.Ranges {
+		t.Fatalf("progress with an offline target = %+v, want failed copies and ranges left to migrate", progress)
+	}
+	moved := movedKeys(t, nps, keys, nodeB.ID())
+	for _, key := range moved {
+		if owners := rbs.PreviousOwners(key); len(owners) != 1 || owners[0].ID() != nodeA.ID() {
+			t.Fatalf("previous owners of %s = %v, want %s", key, owners, nodeA.ID())
+		}
+	}
+
+	nodeB.SetOnline(true)
+	nps.BalanceNodes([]ports.ObjectStorage{nodeA, nodeB})
+	progress = waitForMigration(t, rbs)
+
+	if progress.MigratedRanges != progress.Ranges || progress.Copied != int64(len(moved)) {
+		t.Fatalf("progress with an online target = %+v, want every range migrated and %d objects copied", progress, len(moved))
+	}
+	for _, key := range moved {
+		if owners := rbs.PreviousOwners(key); owners != nil {
+			t.Fatalf("previous owners of migrated %s = %v, want none", key, owners)
+		}
+		if content := getObject(t, nodeB, key); content != key {
+			t.Fatalf("migrated content of %s = %q, want %q", key, content, key)
+		}
+	}
+}
+
+func TestRebalanceServiceRemovesStaleCopies(t *testing.T) {
+	ctx := context.Background()
+	nodeA := object_storage.NewMemoryObjectStore("node-a", 0)
+	nodeB := object_storage.NewMemoryObjectStore("node-b", 0)
+	nps := services.NewNodePoolService(discovery_service.NewMemoryDiscoveryService(), services.RingOptions{})
+
+	rbs, err := services.NewRebalanceService(nps, services.RebalanceOptions{Replicas: 1})
+	if err != nil {
+		t.Fatalf("create rebalance service: %v", err)
+	}
+	defer rbs.Stop()
+	nps.SetRingChangeListener(rbs)
+
+	rs, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{Replicas: 1, Rebalance: rbs})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+
+	nps.BalanceNodes([]ports.ObjectStorage{nodeA})
+
+	keys := make([]string, 0, 50)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("object%d", i)
+		putObject(t, rs, key, key)
+		keys = append(keys, key)
+	}
+
+	nps.BalanceNodes([]ports.ObjectStorage{nodeA, nodeB})
+	progress := waitForMigration(t, rbs)
+
+	moved := movedKeys(t, nps, keys, nodeB.ID())
+	if progress.MigratedRanges != progress.Ranges || progress.Removed != int64(len(moved)) {
+		t.Fatalf("progress = %+v, want every range migrated and %d stale copies removed", progress, len(moved))
+	}
+	for _, key := range moved {
+		if _, err = nodeA.StatObject(ctx, key); !errors.Is(err, models.ErrObjectNotFound) {
+			t.Fatalf("stat of migrated %s on the previous owner error = %v, want %v", key, err, models.ErrObjectNotFound)
+		}
+	}
+
+	for _, key := range keys {
+		if err = rs.DeleteObject(ctx, key); err != nil {
+			t.Fatalf("delete %s: %v", key, err)
+		}
+	}
+
+	list, err := services.NewListObjectsService(nps, nil).ListObjects(ctx, "", 0, "")
+	if err != nil {
+		t.Fatalf("list objects: %v", err)
+	}
+	if len(list.Objects) != 0 {
+		t.Fatalf("listed %d objects after deleting every object, want none", len(list.Objects))
+	}
+}
+
+// movedKeys returns the keys the ring now places on the node with the given ID
+func movedKeys(t *testing.T, nps *services.NodePoolService, keys []string, id string) []string {
+	t.Helper()
+
+	moved := make([]string, 0)
+	for _, key := range keys {
+		nodes, err := nps.GetNodes(key, 1)
+		if err != nil {
+			t.Fatalf("get nodes of %s: %v", key, err)
+		}
+		if nodes[0].ID() == id {
+			moved = append(moved, key)
+		}
+	}
+	if len(moved) == 0 {
+		t.Fatalf("no key moved to node %s", id)
+	}
+
+	return moved
+}
+
+func waitForMigration(t *testing.T, rbs *services.RebalanceService) services.RebalanceProgress {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if progress := rbs.Progress(); !progress.Active {
+			return progress
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("migration still active after 5s")
+
+	return services.RebalanceProgress{}
+}
@@ -0,0 +1,555 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+)
+
+// ReplicationOptions configures how many copies of an object are kept and how many of them must answer an operation
+type ReplicationOptions struct {
+	// Replicas is the number N of distinct nodes holding a copy of each object
+	Replicas int
+	// WriteQuorum is the number W of replicas that must acknowledge a write or a delete
+	WriteQuorum int
+	// ReadQuorum is the number R of replicas consulted on reads, the newest copy among them being returned
+	ReadQuorum int
+	// Handoff enables failover when not nil: replicas of offline owners are written to their online successors
+	// and recorded as hints, and reads probe successors when owners can't answer
+	Handoff *HintedHandoffService
+	// Hints records the deletes missed by replicas so that they are replayed once the replicas are back, Handoff when nil.
+	// Without it, a replica that missed a delete brings the object back to the reads reaching it
+	Hints *HintedHandoffService
+	// Rebalance lets reads and deletes reach the previous owners of keys whose range is still being migrated, when not nil
+	Rebalance *RebalanceService
+}
+
+// ReplicatedStorage is an object storage that spreads every object over the N ring nodes owning its key.
+// It implements ports.ObjectStorage so services don't need to know about replicas
+type ReplicatedStorage struct {
+	nps       *NodePoolService
+	handoff   *HintedHandoffService
+	hints     *HintedHandoffService
+	rebalance *RebalanceService
+	n         int
+	w         int
+	r         int
+}
+
+// NewReplicatedStorage creates a new instance of ReplicatedStorage on top of the given node pool.
+// Zero options default to a single copy, which routes every object to the node owning its key
+func NewReplicatedStorage(nps *NodePoolService, opts ReplicationOptions) (*ReplicatedStorage, error) {
+	if opts.Replicas == 0 {
+		opts.Replicas = 1
+	}
+	if opts.WriteQuorum == 0 {
+		opts.WriteQuorum = opts.Replicas
+	}
+	if opts.ReadQuorum == 0 {
+		opts.ReadQuorum = 1
+	}
+
+	if opts.Replicas < 1 || opts.WriteQuorum < 1 || opts.WriteQuorum > opts.Replicas || opts.ReadQuorum < 1 || opts.ReadQuorum > opts.Replicas {
+		return nil, fmt.Errorf("invalid replication N=%d W=%d R=%d", opts.Replicas, opts.WriteQuorum, opts.ReadQuorum)
+	}
+	if opts.Hints == nil {
+		opts.Hints = opts.Handoff
+	}
+
+	return &ReplicatedStorage{
+		nps:       nps,
+		handoff:   opts.Handoff,
+		hints:     opts.Hints,
+		rebalance: opts.Rebalance,
+		n:         opts.Replicas,
+		w:         opts.WriteQuorum,
+		r:         opts.ReadQuorum,
+	}, nil
+}
+
+// GetObject reads the metadata of R replicas and opens the content of the most recently modified copy
+func (rs *ReplicatedStorage) GetObject(ctx context.Context, id string, rng *models.ByteRange) (*models.Object, error) {
+	newest, err := rs.newestReplica(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newest.GetObject(ctx, id, rng)
+}
+
+// StatObject returns the metadata of the most recently modified copy among R replicas
+func (rs *ReplicatedStorage) StatObject(ctx context.Context, id string) (*models.Object, error) {
+	newest, err := rs.newestReplica(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newest.StatObject(ctx, id)
+}
+
+// PutObject streams the object content to the N replicas at once and succeeds when at least W of them stored it
+func (rs *ReplicatedStorage) PutObject(ctx context.Context, o *models.Object) error {
+	placements, err := rs.placements(o.ID.Value())
+	if err != nil {
+		return err
+	}
+
+	return rs.putReplicas(ctx, o, placements, rs.w)
+}
+
+// ReplicateObject copies an object stored on a single node by other means, such as a multipart upload,
+// to the other replicas of its key. The source counts towards the write quorum when it is one of them
+func (rs *ReplicatedStorage) ReplicateObject(ctx context.Context, id string, source ports.ObjectStorage) error {
+	placements, err := rs.placements(id)
+	if err != nil {
+		return err
+	}
+
+	w := rs.w
+	targets := make([]Placement, 0, len(placements))
+	for _, placement := range placements {
+		if placement.Node.ID() == source.ID() {
+			w--
+			continue
+		}
+		targets = append(targets, placement)
+	}
+
+	if len(onlinePlacements(targets)) == 0 && w <= 0 {
+		return nil
+	}
+
+	obj, err := source.GetObject(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+	defer closeContent(obj)
+
+	return rs.putReplicas(ctx, obj, targets, max(w, 0))
+}
+
+// putReplicas writes the object to the given placements, requiring w acknowledgements.
+// Successful writes on behalf of an offline owner are recorded as hints
+func (rs *ReplicatedStorage) putReplicas(ctx context.Context, o *models.Object, placements []Placement, w int) error {
+	placements = onlinePlacements(placements)
+	if len(placements) < w {
+		return models.ErrObjectStorageNotAvailable
+	}
+
+	online := make([]ports.ObjectStorage, len(placements))
+	for i, placement := range placements {
+		online[i] = placement.Node
+	}
+
+	writers := make([]*io.PipeWriter, len(online))
+	errs := make([]error, len(online))
+
+	var wg sync.WaitGroup
+	for i, node := range online {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		wg.Add(1)
+		go func(i int, node ports.ObjectStorage, pr *io.PipeReader) {
+			defer wg.Done()
+
+			replica := *o
+			replica.Content = pr
+			errs[i] = node.PutObject(ctx, &replica)
+			// unblocks the fan out writer when the node gave up before reading the whole content
+			pr.CloseWithError(fmt.Errorf("replica %s: %w", node.ID(), errorOrClosed(errs[i])))
+		}(i, node, pr)
+	}
+
+	fw := &fanOutWriter{writers: append([]*io.PipeWriter(nil), writers...), alive: len(writers), quorum: w}
+	_, copyErr := io.Copy(fw, o.Content)
+	for _, pw := range writers {
+		if copyErr != nil {
+			pw.CloseWithError(copyErr)
+		} else {
+			pw.Close()
+		}
+	}
+	wg.Wait()
+
+	if copyErr != nil && !errors.Is(copyErr, errQuorumLost) {
+		return copyErr
+	}
+
+	acks, firstErr := 0, error(nil)
+	for i, err := range errs {
+		if err == nil {
+			acks++
+			rs.recordHint(o.ID.Value(), placements[i], false)
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not write object %s to replica %s with error %s", o.ID.Value(), online[i].ID(), err))
+	}
+
+	if acks < w {
+		if firstErr == nil {
+			firstErr = models.ErrObjectStorageNotAvailable
+		}
+		return fmt.Errorf("write quorum not reached (%d/%d): %w", acks, w, firstErr)
+	}
+
+	return nil
+}
+
+// DeleteObject removes the object from the N replicas and succeeds when at least W of them no longer hold it.
+// Replicas missing the delete, because they are offline or failed, are recorded as hints to be deleted once they are back
+func (rs *ReplicatedStorage) DeleteObject(ctx context.Context, id string) error {
+	placements, err := rs.placements(id)
+	if err != nil {
+		return err
+	}
+
+	offline := placements
+	placements = onlinePlacements(placements)
+	if len(placements) < rs.w {
+		return models.ErrObjectStorageNotAvailable
+	}
+
+	errs := make([]error, len(placements))
+	var wg sync.WaitGroup
+	for i, placement := range placements {
+		wg.Add(1)
+		go func(i int, node ports.ObjectStorage) {
+			defer wg.Done()
+			errs[i] = node.DeleteObject(ctx, id)
+		}(i, placement.Node)
+	}
+	wg.Wait()
+
+	// a replica that didn't have the object counts as an acknowledgement,
+	// but the object must have existed somewhere, or be deleted later from an offline owner, for the delete to succeed
+	acks, deleted, firstErr := 0, 0, error(nil)
+	missed := make([]Placement, 0)
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			acks++
+			deleted++
+		case errors.Is(err, models.ErrObjectNotFound):
+			acks++
+		case firstErr == nil:
+			firstErr = err
+			missed = append(missed, placements[i])
+			continue
+		default:
+			missed = append(missed, placements[i])
+			continue
+		}
+
+		if placements[i].HandoffFor != "" {
+			rs.recordHint(id, placements[i], true)
+			deleted++
+		}
+	}
+
+	if acks < rs.w {
+		if firstErr == nil {
+			firstErr = models.ErrObjectStorageNotAvailable
+		}
+		return fmt.Errorf("write quorum not reached (%d/%d): %w", acks, rs.w, firstErr)
+	}
+
+	for _, placement := range offline {
+		if !placement.Node.IsOnline() {
+			missed = append(missed, placement)
+		}
+	}
+	for _, placement := range missed {
+		if rs.recordMissedDelete(id, placement) {
+			deleted++
+		}
+	}
+
+	// previous owners of a range being migrated still hold copies that the migration or fallback reads would bring back
+	for _, node := range rs.previousOwners(id) {
+		if err = node.DeleteObject(ctx, id); err == nil {
+			deleted++
+		} else if !errors.Is(err, models.ErrObjectNotFound) {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not delete object %s from previous owner %s with error %s", id, node.ID(), err))
+		}
+	}
+
+	if deleted == 0 {
+		return models.ErrObjectNotFound
+	}
+
+	return nil
+}
+
+// ListObjects merges the listings of every node of the pool, reporting objects held by several replicas once
+func (rs *ReplicatedStorage) ListObjects(ctx context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	nodes := rs.nps.Nodes()
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no nodes in the pool")
+	}
+
+	positions := make(listCursor, len(nodes))
+	for _, node := range nodes {
+		positions[node.ID()] = startAfter
+	}
+
+	pages, err := listNodePages(ctx, nodes, prefix, positions, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeObjectPages(nodes, pages, limit, positions), nil
+}
+
+// ResolveListing drops the objects removed by deletes that some replicas missed, which those replicas still list
+// until the deletes are replayed. ListObjects keeps them, so that its pages stay full for callers paging through them
+func (rs *ReplicatedStorage) ResolveListing(_ context.Context, objects []*models.Object) ([]*models.Object, error) {
+	visible := make([]*models.Object, 0, len(objects))
+	for _, obj := range objects {
+		if !rs.missedDelete(obj.ID.Value(), obj) {
+			visible = append(visible, obj)
+		}
+	}
+
+	return visible, nil
+}
+
+// ID returns the identifier of the replicated storage
+func (rs *ReplicatedStorage) ID() string {
+	return "replicated"
+}
+
+// IsOnline reports whether enough nodes are online to reach the write quorum
+func (rs *ReplicatedStorage) IsOnline() bool {
+	return len(onlineNodes(rs.nps.Nodes())) >= rs.w
+}
+
+// newestReplica asks R replicas for the object metadata and returns the one holding the most recent copy.
+// Replicas that fail are replaced by the next ones of the preference list while there are any left
+func (rs *ReplicatedStorage) newestReplica(ctx context.Context, id string) (ports.ObjectStorage, error) {
+	n := rs.n
+	if rs.handoff != nil {
+		// with failover, successors may hold hinted copies and are probed after the owners
+		n = len(rs.nps.Nodes())
+	}
+
+	nodes, err := rs.nps.GetNodes(id, n)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := onlineNodes(nodes)
+
+	var (
+		newestNode ports.ObjectStorage
+		newest     *models.Object
+		responses  int
+		firstErr   error
+	)
+
+	for responses < rs.r && len(candidates) > 0 {
+		batch := candidates[:min(rs.r-responses, len(candidates))]
+		candidates = candidates[len(batch):]
+
+		stats := make([]*models.Object, len(batch))
+		errs := make([]error, len(batch))
+
+		var wg sync.WaitGroup
+		for i, node := range batch {
+			wg.Add(1)
+			go func(i int, node ports.ObjectStorage) {
+				defer wg.Done()
+				stats[i], errs[i] = node.StatObject(ctx, id)
+			}(i, node)
+		}
+		wg.Wait()
+
+		for i, err := range errs {
+			// a replica that missed a delete still holds the copy it deleted until the delete is replayed
+			if err == nil && rs.missedDelete(id, stats[i]) {
+				err = models.ErrObjectNotFound
+			}
+
+			switch {
+			case err == nil:
+				responses++
+				if newest == nil || stats[i].LastModified.After(newest.LastModified) {
+					newest, newestNode = stats[i], batch[i]
+				}
+			case errors.Is(err, models.ErrObjectNotFound):
+				responses++
+			case firstErr == nil:
+				firstErr = err
+			}
+		}
+	}
+
+	if responses < rs.r {
+		if firstErr == nil {
+			firstErr = models.ErrObjectStorageNotAvailable
+		}
+		return nil, fmt.Errorf("read quorum not reached (%d/%d): %w", responses, rs.r, firstErr)
+	}
+
+	// keys of a range that is still being migrated may only exist on their previous owners
+	if newestNode == nil {
+		for _, node := range rs.previousOwners(id) {
+			stat, err := node.StatObject(ctx, id)
+			if err == nil && (newest == nil || stat.LastModified.After(newest.LastModified)) {
+				newest, newestNode = stat, node
+			}
+		}
+	}
+
+	if newestNode == nil {
+		return nil, models.ErrObjectNotFound
+	}
+
+	return newestNode, nil
+}
+
+// previousOwners returns the online previous owners of a key whose range is not migrated yet
+func (rs *ReplicatedStorage) previousOwners(key string) []ports.ObjectStorage {
+	if rs.rebalance == nil {
+		return nil
+	}
+
+	return onlineNodes(rs.rebalance.PreviousOwners(key))
+}
+
+// placements returns where the replicas of a key go, replacing offline owners by their successors when failover is enabled
+func (rs *ReplicatedStorage) placements(key string) ([]Placement, error) {
+	if rs.handoff != nil {
+		return rs.nps.GetHealthyNodes(key, rs.n)
+	}
+
+	nodes, err := rs.nps.GetNodes(key, rs.n)
+	if err != nil {
+		return nil, err
+	}
+
+	placements := make([]Placement, len(nodes))
+	for i, node := range nodes {
+		placements[i] = Placement{Node: node}
+	}
+
+	return placements, nil
+}
+
+func (rs *ReplicatedStorage) recordHint(key string, placement Placement, deleted bool) {
+	if rs.handoff == nil || placement.HandoffFor == "" {
+		return
+	}
+
+	hint := &Hint{
+		Key:       key,
+		OwnerID:   placement.HandoffFor,
+		Replicas:  rs.n,
+		Deleted:   deleted,
+		CreatedAt: time.Now(),
+	}
+	if !deleted {
+		hint.Holder = placement.Node
+	}
+
+	rs.handoff.RecordHint(hint)
+}
+
+// recordMissedDelete records a hint to delete the object from a replica that missed the delete, returning whether it did.
+// Placements standing in for an offline owner hold a copy of their own, the owner being recorded by putReplicas
+func (rs *ReplicatedStorage) recordMissedDelete(key string, placement Placement) bool {
+	if rs.hints == nil || placement.HandoffFor != "" {
+		return false
+	}
+
+	rs.hints.RecordHint(&Hint{
+		Key:       key,
+		OwnerID:   placement.Node.ID(),
+		Replicas:  rs.n,
+		Deleted:   true,
+		CreatedAt: time.Now(),
+	})
+
+	return true
+}
+
+// missedDelete reports whether a copy of the key was removed by a delete that some replicas missed
+func (rs *ReplicatedStorage) missedDelete(key string, stat *models.Object) bool {
+	if rs.hints == nil {
+		return false
+	}
+
+	deletedAt, ok := rs.hints.PendingDelete(key)
+
+	return ok && !stat.LastModified.After(deletedAt)
+}
+
+func onlinePlacements(placements []Placement) []Placement {
+	online := make([]Placement, 0, len(placements))
+	for _, placement := range placements {
+		if placement.Node.IsOnline() {
+			online = append(online, placement)
+		}
+	}
+
+	return online
+}
+
+func onlineNodes(nodes []ports.ObjectStorage) []ports.ObjectStorage {
+	online := make([]ports.ObjectStorage, 0, len(nodes))
+	for _, node := range nodes {
+		if node.IsOnline() {
+			online = append(online, node)
+		}
+	}
+
+	return online
+}
+
+func errorOrClosed(err error) error {
+	if err == nil {
+		return io.ErrClosedPipe
+	}
+
+	return err
+}
+
+var errQuorumLost = errors.New("not enough replicas left to reach the write quorum")
+
+// fanOutWriter copies every write to all the replica writers that are still accepting data.
+// A failing replica is dropped, and writing only fails once fewer replicas than the quorum remain
+type fanOutWriter struct {
+	writers []*io.PipeWriter
+	alive   int
+	quorum  int
+}
+
+func (fw *fanOutWriter) Write(p []byte) (int, error) {
+	for i, w := range fw.writers {
+		if w == nil {
+			continue
+		}
+
+		if _, err := w.Write(p); err != nil {
+			fw.writers[i] = nil
+			fw.alive--
+		}
+	}
+
+	if fw.alive < fw.quorum {
+		return 0, errQuorumLost
+	}
+
+	return len(p), nil
+}
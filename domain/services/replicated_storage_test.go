@@ -0,0 +1,172 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/services"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestReplicatedStorageWritesEveryReplica(t *testing.T) {
+	ctx := context.Background()
+	nps, nodes := newMemoryPool(3)
+
+	rs, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{Replicas: 3, WriteQuorum: 2, ReadQuorum: 2})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+
+	putObject(t, rs, "replicated", "first")
+	for _, node := range nodes {
+		if content := getObject(t, node, "replicated"); content != "first" {
+			t.Fatalf("replica %s content = %q, want %q", node.ID(), content, "first")
+		}
+	}
+
+	// a write reaching the quorum succeeds without the offline replica, and reads return the newest copy
+	nodes[0].SetOnline(false)
+	putObject(t, rs, "replicated", "second")
+	nodes[0].SetOnline(true)
+
+	if content := getObject(t, rs, "replicated"); content != "second" {
+		t.Fatalf("content = %q, want %q", content, "second")
+	}
+
+	if err = rs.DeleteObject(ctx, "replicated"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	for _, node := range nodes {
+		if _, err = node.StatObject(ctx, "replicated"); !errors.Is(err, models.ErrObjectNotFound) {
+			t.Fatalf("replica %s stat error = %v, want %v", node.ID(), err, models.ErrObjectNotFound)
+		}
+	}
+	if err = rs.DeleteObject(ctx, "replicated"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("second delete error = %v, want %v", err, models.ErrObjectNotFound)
+	}
+}
+
+func TestReplicatedStorageFailsWithoutQuorum(t *testing.T) {
+	nps, nodes := newMemoryPool(3)
+
+	rs, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{Replicas: 3, WriteQuorum: 3})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+
+	nodes[1].SetOnline(false)
+
+	err = rs.PutObject(context.Background(), &models.Object{ID: "unwritten", Content: strings.NewReader("content"), Size: 7})
+	if !errors.Is(err, models.ErrObjectStorageNotAvailable) {
+		t.Fatalf("put error = %v, want %v", err, models.ErrObjectStorageNotAvailable)
+	}
+}
+
+func TestReplicatedStorageHandsOffToSuccessors(t *testing.T) {
+	ctx := context.Background()
+	nps, nodes := newMemoryPool(3)
+
+	hhs, err := services.NewHintedHandoffService(nps, services.HintedHandoffOptions{})
+	if err != nil {
+		t.Fatalf("create hinted handoff service: %v", err)
+	}
+	rs, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{Replicas: 2, Handoff: hhs})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+
+	preference, err := nps.GetNodes("handedoff", 3)
+	if err != nil {
+		t.Fatalf("get nodes: %v", err)
+	}
+	owner, successor := memoryNode(nodes, preference[0].ID()), memoryNode(nodes, preference[2].ID())
+	owner.SetOnline(false)
+
+	// the write reaches its quorum with the successor standing in for the offline owner
+	putObject(t, rs, "handedoff", "content")
+	if content := getObject(t, successor, "handedoff"); content != "content" {
+		t.Fatalf("successor content = %q, want %q", content, "content")
+	}
+	if pending := hhs.PendingHints(); pending != 1 {
+		t.Fatalf("pending hints = %d, want 1", pending)
+	}
+
+	owner.SetOnline(true)
+	hhs.ReplayHints(ctx)
+
+	if content := getObject(t, owner, "handedoff"); content != "content" {
+		t.Fatalf("owner content after replay = %q, want %q", content, "content")
+	}
+	if _, err = successor.StatObject(ctx, "handedoff"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("successor stat error after replay = %v, want %v", err, models.ErrObjectNotFound)
+	}
+}
+
+func TestReplicatedStorageRepairsMissedDeletes(t *testing.T) {
+	ctx := context.Background()
+	nps, nodes := newMemoryPool(3)
+
+	hints, err := services.NewHintedHandoffService(nps, services.HintedHandoffOptions{})
+	if err != nil {
+		t.Fatalf("create hinted handoff service: %v", err)
+	}
+	rs, err := services.NewReplicatedStorage(nps, services.ReplicationOptions{Replicas: 3, WriteQuorum: 2, ReadQuorum: 2, Hints: hints})
+	if err != nil {
+		t.Fatalf("create replicated storage: %v", err)
+	}
+
+	putObject(t, rs, "deleted", "content")
+
+	preference, err := nps.GetNodes("deleted", 3)
+	if err != nil {
+		t.Fatalf("get nodes: %v", err)
+	}
+	owner := memoryNode(nodes, preference[0].ID())
+
+	// the delete reaches its quorum without the first owner, which keeps its copy while offline
+	owner.SetOnline(false)
+	if err = rs.DeleteObject(ctx, "deleted"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	owner.SetOnline(true)
+
+	if _, err = rs.StatObject(ctx, "deleted"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("stat error before the delete is replayed = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	list, err := services.NewListObjectsService(nps, rs).ListObjects(ctx, "", 0, "")
+	if err != nil {
+		t.Fatalf("list objects: %v", err)
+	}
+	if len(list.Objects) != 0 {
+		t.Fatalf("listed %d objects before the delete is replayed, want none", len(list.Objects))
+	}
+
+	hints.ReplayHints(ctx)
+
+	if _, err = owner.StatObject(ctx, "deleted"); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Fatalf("owner stat error after replay = %v, want %v", err, models.ErrObjectNotFound)
+	}
+	if pending := hints.PendingHints(); pending != 0 {
+		t.Fatalf("pending hints after replay = %d, want 0", pending)
+	}
+
+	// writes after the delete are visible again
+	putObject(t, rs, "deleted", "rewritten")
+	if content := getObject(t, rs, "deleted"); content != "rewritten" {
+		t.Fatalf("content = %q, want %q", content, "rewritten")
+	}
+}
+
+// memoryNode returns the node of the pool with the given ID
+func memoryNode(nodes []*object_storage.MemoryObjectStore, id string) *object_storage.MemoryObjectStore {
+	for _, node := range nodes {
+		if node.ID() == id {
+			return node
+		}
+	}
+
+	return nil
+}
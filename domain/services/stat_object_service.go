@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+
+	"storage-gateway/domain/models"
+	"storage-gateway/domain/ports"
+)
+
+type StatObjectService struct {
+	storage ports.ObjectStorage
+}
+
+func NewStatObjectService(storage ports.ObjectStorage) *StatObjectService {
+	return &StatObjectService{
+		storage: storage,
+	}
+}
+
+func (sos *StatObjectService) StatObject(ctx context.Context, objectID models.ObjectID) (*models.Object, error) {
+	if !objectID.IsValidKey() {
+		return nil, models.ErrObjectIDNotValid
+	}
+
+	return sos.storage.StatObject(ctx, objectID.Value())
+}
@@ -0,0 +1,145 @@
+package discovery_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"storage-gateway/domain/ports"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+// SRVResolver resolves DNS SRV records, *net.Resolver being the default implementation
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Credentials are the credentials shared by the nodes discovered through DNS or Kubernetes
+type Credentials struct {
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+}
+
+// DNSDiscoveryService represents a service discovering object storage nodes from the targets of a DNS SRV record,
+// such as _minio._tcp.storage.internal
+type DNSDiscoveryService struct {
+	resolver    SRVResolver
+	service     string
+	proto       string
+	name        string
+	node        object_storage.S3NodeConfig
+	secretsFile string
+}
+
+// NewDNSDiscoveryService creates a new instance of DNSDiscoveryService, node being the configuration shared by every target.
+// Static credentials are read from secretsFile on every discovery when it is set, so they can be rotated without a restart,
+// other credential providers ignoring it
+func NewDNSDiscoveryService(resolver SRVResolver, service, proto, name string, node object_storage.S3NodeConfig, secretsFile string) (*DNSDiscoveryService, error) {
+	if name == "" {
+		return nil, errors.New("dns discovery name is required")
+	}
+
+	if staticCredentials(node.Credentials) && node.Credentials.AccessKey == "" && secretsFile == "" {
+		return nil, errors.New("dns discovery requires credentials or a secrets file")
+	}
+
+	return &DNSDiscoveryService{
+		resolver:    resolver,
+		service:     service,
+		proto:       proto,
+		name:        name,
+		node:        node,
+		secretsFile: secretsFile,
+	}, nil
+}
+
+// NewDNSResolver returns a resolver querying the given DNS server address, or the system resolver when server is empty
+func NewDNSResolver(server string) *net.Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// DiscoverNodes resolves the SRV record and returns an object storage node for each target.
+// Targets of every priority are used since each node holds its own part of the keyspace,
+// and SRV weights are scaled down so that the lightest target gets a ring weight of one
+func (dds *DNSDiscoveryService) DiscoverNodes(ctx context.Context) ([]ports.ObjectStorage, error) {
+	_, records, err := dds.resolver.LookupSRV(ctx, dds.service, dds.proto, dds.name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup srv %s: %w", dds.name, err)
+	}
+
+	template := dds.node
+	if dds.secretsFile != "" && staticCredentials(template.Credentials) {
+		credentials, err := dds.readCredentials()
+		if err != nil {
+			return nil, err
+		}
+		template.Credentials.AccessKey, template.Credentials.SecretKey = credentials.AccessKey, credentials.SecretKey
+	}
+
+	minWeight := uint16(0)
+	for _, record := range records {
+		if record.Weight > 0 && (minWeight == 0 || record.Weight < minWeight) {
+			minWeight = record.Weight
+		}
+	}
+
+	var objectStorages []ports.ObjectStorage
+	for _, record := range records {
+		endpoint := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+
+		cfg := template
+		cfg.Endpoint = endpoint
+
+		node, err := object_storage.NewS3ObjectStore(ctx, endpoint, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", endpoint, err)
+		}
+
+		weight := 1
+		if minWeight > 0 {
+			weight = int(record.Weight / minWeight)
+		}
+
+		objectStorages = append(objectStorages, object_storage.WithNodeMetadata(node, weight, ""))
+	}
+
+	return objectStorages, nil
+}
+
+func (dds *DNSDiscoveryService) readCredentials() (Credentials, error) {
+	raw, err := os.ReadFile(dds.secretsFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("read secrets file: %w", err)
+	}
+
+	var credentials Credentials
+	if err = json.Unmarshal(raw, &credentials); err != nil {
+		return Credentials{}, fmt.Errorf("parse secrets file: %w", err)
+	}
+
+	if credentials.AccessKey == "" || credentials.SecretKey == "" {
+		return Credentials{}, errors.New("keys not found in secrets file")
+	}
+
+	return credentials, nil
+}
+
+// staticCredentials tells whether nodes use static credentials, whose keys are the ones discovered along with the nodes
+func staticCredentials(credentials object_storage.S3Credentials) bool {
+	return credentials.Provider == "" || credentials.Provider == object_storage.CredentialsStatic
+}
@@ -0,0 +1,154 @@
+package discovery_service_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"storage-gateway/domain/ports"
+	"storage-gateway/infrastructure/discovery-service"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+// fakeSRVResolver answers every lookup with its records, or fails with its error
+type fakeSRVResolver struct {
+	records []*net.SRV
+	err     error
+}
+
+func (r *fakeSRVResolver) LookupSRV(_ context.Context, _, _, _ string) (string, []*net.SRV, error) {
+	if r.err != nil {
+		return "", nil, r.err
+	}
+
+	return "", r.records, nil
+}
+
+func TestDNSDiscoveryServiceDiscoverNodes(t *testing.T) {
+	// every target has its own S3 server, which only has to answer that the bucket of the node exists
+	targets := make([]*net.SRV, 0, 4)
+	for _, record := range []struct {
+		priority uint16
+		weight   uint16
+	}{
+		{priority: 10, weight: 10},
+		{priority: 10, weight: 30},
+		{priority: 20, weight: 20},
+		{priority: 20, weight: 0},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		t.Cleanup(server.Close)
+
+		host, port := splitHostPort(t, server.Listener.Addr().String())
+		targets = append(targets, &net.SRV{Target: host + ".", Port: port, Priority: record.priority, Weight: record.weight})
+	}
+
+	dds := newDNSDiscoveryService(t, &fakeSRVResolver{records: targets})
+
+	nodes, err := dds.DiscoverNodes(context.Background())
+	if err != nil {
+		t.Fatalf("discover nodes: %v", err)
+	}
+
+	// targets of every priority are nodes, the lightest weighted one getting a weight of one
+	wantWeights := []int{1, 3, 2, 1}
+	if len(nodes) != len(wantWeights) {
+		t.Fatalf("discovered %d nodes, want %d", len(nodes), len(wantWeights))
+	}
+	for i, node := range nodes {
+		wantID := net.JoinHostPort(strings.TrimSuffix(targets[i].Target, "."), strconv.Itoa(int(targets[i].Port)))
+		if node.ID() != wantID {
+			t.Errorf("node %d ID = %s, want %s", i, node.ID(), wantID)
+		}
+
+		metadata, ok := node.(ports.NodeMetadata)
+		if !ok {
+			t.Fatalf("node %s has no metadata", node.ID())
+		}
+		if metadata.Weight() != wantWeights[i] {
+			t.Errorf("node %s weight = %d, want %d", node.ID(), metadata.Weight(), wantWeights[i])
+		}
+	}
+}
+
+func TestDNSDiscoveryServiceLookupFailure(t *testing.T) {
+	lookupErr := &net.DNSError{Err: "no such host", Name: "_minio._tcp.storage.internal", IsNotFound: true}
+	dds := newDNSDiscoveryService(t, &fakeSRVResolver{err: lookupErr})
+
+	nodes, err := dds.DiscoverNodes(context.Background())
+	if !errors.Is(err, lookupErr) {
+		t.Fatalf("discover nodes error = %v, want %v", err, lookupErr)
+	}
+	if nodes != nil {
+		t.Fatalf("discovered nodes = %v, want none", nodes)
+	}
+}
+
+func TestDNSDiscoveryServiceKeepsCredentialsProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	host, port := splitHostPort(t, server.Listener.Addr().String())
+	resolver := &fakeSRVResolver{records: []*net.SRV{{Target: host + ".", Port: port}}}
+
+	// the secrets file only provides static keys, so the env provider doesn't read the missing file
+	dds, err := discovery_service.NewDNSDiscoveryService(resolver, "minio", "tcp", "storage.internal", object_storage.S3NodeConfig{
+		Region:       "us-east-1",
+		BucketLookup: "path",
+		Credentials:  object_storage.S3Credentials{Provider: object_storage.CredentialsEnv},
+	}, filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("create dns discovery: %v", err)
+	}
+
+	nodes, err := dds.DiscoverNodes(context.Background())
+	if err != nil {
+		t.Fatalf("discover nodes: %v", err)
+	}
+	if len(nodes) != 1 {
+		t.Fatalf("discovered %d nodes, want 1", len(nodes))
+	}
+}
+
+func TestNewDNSDiscoveryServiceRequiresCredentials(t *testing.T) {
+	_, err := discovery_service.NewDNSDiscoveryService(&fakeSRVResolver{}, "minio", "tcp", "storage.internal", object_storage.S3NodeConfig{}, "")
+	if err == nil {
+		t.Fatal("dns discovery without credentials created, want an error")
+	}
+}
+
+func newDNSDiscoveryService(t *testing.T, resolver discovery_service.SRVResolver) *discovery_service.DNSDiscoveryService {
+	t.Helper()
+
+	dds, err := discovery_service.NewDNSDiscoveryService(resolver, "minio", "tcp", "storage.internal", object_storage.S3NodeConfig{
+		Region:       "us-east-1",
+		BucketLookup: "path",
+		Credentials:  object_storage.S3Credentials{AccessKey: "access", SecretKey: "secret"},
+	}, "")
+	if err != nil {
+		t.Fatalf("create dns discovery: %v", err)
+	}
+
+	return dds
+}
+
+func splitHostPort(t *testing.T, addr string) (string, uint16) {
+	t.Helper()
+
+	host, rawPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.ParseUint(rawPort, 10, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return host, uint16(port)
+}
@@ -5,90 +5,303 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"storage-gateway/domain/ports"
 	"storage-gateway/infrastructure/object-storage"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 )
 
-// DockerDiscoveryService represents a service for discovering Docker containers and extracting object storage information
-type DockerDiscoveryService struct {
-	c *client.Client
-}
-
 const (
 	EnvKeyMinioAccessKey = "MINIO_ACCESS_KEY"
 	EnvKeyMinioSecretKey = "MINIO_SECRET_KEY"
 )
 
+// Container labels configuring the discovery of an object storage node
+const (
+	LabelEnable  = "storage-gateway.enable"
+	LabelPort    = "storage-gateway.port"
+	LabelNetwork = "storage-gateway.network"
+	LabelWeight  = "storage-gateway.weight"
+	LabelZone    = "storage-gateway.zone"
+	LabelBucket  = "storage-gateway.bucket"
+	LabelRegion  = "storage-gateway.region"
+)
+
+const (
+	defaultNodePort = "9000"
+	// eventsRetryDelay is the wait before subscribing again to the Docker events stream after it broke
+	eventsRetryDelay = 5 * time.Second
+)
+
+// DockerOptions holds the values used for containers that don't set them with labels
+type DockerOptions struct {
+	// NameFilter also selects the containers without a storage-gateway.enable label whose name contains it, none when empty
+	NameFilter string
+	// Network is the network the node is reached on, the only network of the container when empty
+	Network string
+	// Port is the port the node listens on, 9000 when empty
+	Port string
+	// AccessKeyEnv and SecretKeyEnv are the container env vars holding the node credentials, only read with static credentials
+	AccessKeyEnv string
+	SecretKeyEnv string
+	// Node is the configuration shared by every container, its endpoint and static credentials being discovered
+	Node object_storage.S3NodeConfig
+}
+
+// DockerDiscoveryService represents a service for discovering Docker containers and extracting object storage information
+type DockerDiscoveryService struct {
+	c    *client.Client
+	opts DockerOptions
+}
+
 // NewDockerDiscoveryService creates a new instance of DockerDiscoveryService
-func NewDockerDiscoveryService() (*DockerDiscoveryService, error) {
+func NewDockerDiscoveryService(opts DockerOptions) (*DockerDiscoveryService, error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, fmt.Errorf("new docker client: %w", err)
 	}
 
+	if opts.Port == "" {
+		opts.Port = defaultNodePort
+	}
+
+	if opts.AccessKeyEnv == "" {
+		opts.AccessKeyEnv = EnvKeyMinioAccessKey
+	}
+
+	if opts.SecretKeyEnv == "" {
+		opts.SecretKeyEnv = EnvKeyMinioSecretKey
+	}
+
 	return &DockerDiscoveryService{
-		c: cli,
+		c:    cli,
+		opts: opts,
 	}, nil
 }
 
-// DiscoverNodes searches for Docker containers starting with the name "amazin-object-storage"
-// and returns a list of object storage nodes for each Docker container discovered
+// DiscoverNodes searches for the running Docker containers labeled with storage-gateway.enable=true, or matching the name filter,
+// and returns a list of object storage nodes for each Docker container discovered.
+// Containers whose health check reports them as unhealthy are left out, and misconfigured ones are skipped with a warning
 func (dds *DockerDiscoveryService) DiscoverNodes(ctx context.Context) ([]ports.ObjectStorage, error) {
-	containers, err := dds.c.ContainerList(ctx, types.ContainerListOptions{
-		Filters: filters.NewArgs(filters.Arg("name", "amazin-object-storage")),
-	})
+	containers, err := dds.c.ContainerList(ctx, types.ContainerListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	var objectStorages []ports.ObjectStorage
 	for _, c := range containers {
-		containerInfo, err := dds.c.ContainerInspect(ctx, c.ID)
+		if !dds.selected(c.Labels, c.Names) {
+			continue
+		}
+
+		node, err := dds.containerNode(ctx, c)
 		if err != nil {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("skipping container %s: %s", c.ID, err))
+			continue
+		}
+
+		if node != nil {
+			objectStorages = append(objectStorages, node)
+		}
+	}
+
+	return objectStorages, nil
+}
+
+// containerNode creates the object storage node of a container, nil when the container is unhealthy
+func (dds *DockerDiscoveryService) containerNode(ctx context.Context, c types.Container) (ports.ObjectStorage, error) {
+	containerInfo, err := dds.c.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if containerInfo.State != nil && containerInfo.State.Health != nil && containerInfo.State.Health.Status == types.Unhealthy {
+		return nil, nil
+	}
+
+	cfg := dds.opts.Node
+	if staticCredentials(cfg.Credentials) {
+		if cfg.Credentials.AccessKey, cfg.Credentials.SecretKey, err = dds.containerKeys(containerInfo.Config.Env); err != nil {
 			return nil, err
 		}
+	}
 
-		var (
-			accessKey string
-			secretKey string
-		)
-
-		for _, envVar := range containerInfo.Config.Env {
-			parts := strings.SplitN(envVar, "=", 2)
-			if len(parts) == 2 {
-				name, value := parts[0], parts[1]
-				if name == EnvKeyMinioAccessKey {
-					accessKey = value
-				}
-				if name == EnvKeyMinioSecretKey {
-					secretKey = value
-				}
-			}
+	ipAddress, err := dds.containerAddress(c)
+	if err != nil {
+		return nil, err
+	}
+
+	port := dds.opts.Port
+	if label, ok := c.Labels[LabelPort]; ok {
+		port = label
+	}
+
+	weight := 0
+	if label, ok := c.Labels[LabelWeight]; ok {
+		if weight, err = strconv.Atoi(label); err != nil || weight < 1 {
+			return nil, fmt.Errorf("weight label %q not valid", label)
 		}
+	}
+
+	cfg.Endpoint = net.JoinHostPort(ipAddress, port)
+	if label, ok := c.Labels[LabelBucket]; ok {
+		cfg.Bucket = label
+	}
+	if label, ok := c.Labels[LabelRegion]; ok {
+		cfg.Region = label
+	}
 
-		if accessKey == "" || secretKey == "" {
-			return nil, errors.New("keys not found")
+	// create a new S3ObjectStore instance for the discovered container
+	node, err := object_storage.NewS3ObjectStore(ctx, c.ID, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return object_storage.WithNodeMetadata(node, weight, c.Labels[LabelZone]), nil
+}
+
+// containerKeys returns the static credentials of a node from the env vars of its container
+func (dds *DockerDiscoveryService) containerKeys(env []string) (string, string, error) {
+	var (
+		accessKey string
+		secretKey string
+	)
+
+	for _, envVar := range env {
+		parts := strings.SplitN(envVar, "=", 2)
+		if len(parts) == 2 {
+			name, value := parts[0], parts[1]
+			if name == dds.opts.AccessKeyEnv {
+				accessKey = value
+			}
+			if name == dds.opts.SecretKeyEnv {
+				secretKey = value
+			}
 		}
+	}
 
-		n, ok := c.NetworkSettings.Networks["storage-gateway_object-storage"]
-		if !ok {
-			return nil, errors.New("network not found")
+	if accessKey == "" || secretKey == "" {
+		return "", "", errors.New("keys not found")
+	}
+
+	return accessKey, secretKey, nil
+}
+
+// containerAddress returns the IP address of the container on the network it is reached on
+func (dds *DockerDiscoveryService) containerAddress(c types.Container) (string, error) {
+	if c.NetworkSettings == nil {
+		return "", errors.New("network not found")
+	}
+
+	network := dds.opts.Network
+	if label, ok := c.Labels[LabelNetwork]; ok {
+		network = label
+	}
+
+	if network == "" {
+		if len(c.NetworkSettings.Networks) != 1 {
+			return "", errors.New("network not configured and container not on a single network")
+		}
+		for _, n := range c.NetworkSettings.Networks {
+			return n.IPAddress, nil
 		}
+	}
 
-		// create a new MinioObjectStore instance for the discovered container
-		node, err := object_storage.NewMinioObjectStore(ctx, c.ID, net.JoinHostPort(n.IPAddress, "9000"), accessKey, secretKey)
-		if err != nil {
-			return nil, err
+	n, ok := c.NetworkSettings.Networks[network]
+	if !ok {
+		return "", fmt.Errorf("network %s not found", network)
+	}
+
+	return n.IPAddress, nil
+}
+
+// selected tells whether a container is an object storage node, its storage-gateway.enable label taking precedence over its names
+func (dds *DockerDiscoveryService) selected(labels map[string]string, names []string) bool {
+	if label, ok := labels[LabelEnable]; ok {
+		enabled, _ := strconv.ParseBool(label)
+		return enabled
+	}
+
+	if dds.opts.NameFilter == "" {
+		return false
+	}
+
+	for _, name := range names {
+		if strings.Contains(name, dds.opts.NameFilter) {
+			return true
 		}
+	}
 
-		objectStorages = append(objectStorages, node)
+	return false
+}
+
+// Watch subscribes to the Docker events stream and notifies every start, death or health change of an object storage container.
+// The subscription is renewed when the stream breaks, with a notification since events may have been missed meanwhile
+func (dds *DockerDiscoveryService) Watch(ctx context.Context) (<-chan struct{}, error) {
+	changes := make(chan struct{}, 1)
+
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
 	}
 
-	return objectStorages, nil
+	go func() {
+		defer close(changes)
+
+		for {
+			messages, errs := dds.c.Events(ctx, types.EventsOptions{
+				Filters: filters.NewArgs(
+					filters.Arg("type", string(events.ContainerEventType)),
+					filters.Arg("event", "start"),
+					filters.Arg("event", "die"),
+					filters.Arg("event", "health_status"),
+				),
+			})
+
+			if err := dds.forwardEvents(ctx, messages, errs, notify); err == nil {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(eventsRetryDelay):
+				notify()
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// forwardEvents notifies the events of object storage containers until the context is done, returning nil,
+// or until the stream breaks, returning its error
+func (dds *DockerDiscoveryService) forwardEvents(ctx context.Context, messages <-chan events.Message, errs <-chan error, notify func()) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case msg := <-messages:
+			// event attributes hold the container labels along with its name
+			if dds.selected(msg.Actor.Attributes, []string{msg.Actor.Attributes["name"]}) {
+				notify()
+			}
+		}
+	}
 }
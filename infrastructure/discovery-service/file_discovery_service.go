@@ -0,0 +1,216 @@
+package discovery_service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/ports"
+	"storage-gateway/infrastructure/object-storage"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// FileNode describes an object storage node in a discovery file, either an S3 compatible endpoint or a local directory
+type FileNode struct {
+	ID       string `json:"id" yaml:"id"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Path     string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Bucket, Region, Secure, CAFile and BucketLookup configure S3 compatible nodes, see object_storage.S3NodeConfig
+	Bucket       string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	Region       string `json:"region,omitempty" yaml:"region,omitempty"`
+	Secure       bool   `json:"secure,omitempty" yaml:"secure,omitempty"`
+	CAFile       string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	BucketLookup string `json:"bucketLookup,omitempty" yaml:"bucketLookup,omitempty"`
+	// CredentialsProvider is static when empty, using AccessKey and SecretKey
+	CredentialsProvider string `json:"credentialsProvider,omitempty" yaml:"credentialsProvider,omitempty"`
+	AccessKey           string `json:"accessKey,omitempty" yaml:"accessKey,omitempty"`
+	SecretKey           string `json:"secretKey,omitempty" yaml:"secretKey,omitempty"`
+	SessionToken        string `json:"sessionToken,omitempty" yaml:"sessionToken,omitempty"`
+	CredentialsFile     string `json:"credentialsFile,omitempty" yaml:"credentialsFile,omitempty"`
+	CredentialsProfile  string `json:"credentialsProfile,omitempty" yaml:"credentialsProfile,omitempty"`
+	Weight              int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Zone                string `json:"zone,omitempty" yaml:"zone,omitempty"`
+}
+
+// FileNodes is the content of a discovery file
+type FileNodes struct {
+	Nodes []FileNode `json:"nodes" yaml:"nodes"`
+}
+
+// FileDiscoveryService represents a service discovering object storage nodes listed in a JSON or YAML file
+type FileDiscoveryService struct {
+	path          string
+	watchInterval time.Duration
+	// filesystemNodes keep the local directory nodes by ID across discoveries, so that writes in progress
+	// and their lock survive refreshes
+	filesystemNodes map[string]*object_storage.FilesystemObjectStore
+	mu              sync.Mutex
+}
+
+// NewFileDiscoveryService creates a new instance of FileDiscoveryService reading the given file.
+// Files with a .yaml or .yml extension are read as YAML, any other file as JSON
+func NewFileDiscoveryService(path string, watchInterval time.Duration) (*FileDiscoveryService, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("discovery file: %w", err)
+	}
+
+	if watchInterval <= 0 {
+		watchInterval = defaultWatchInterval
+	}
+
+	return &FileDiscoveryService{
+		path:            path,
+		watchInterval:   watchInterval,
+		filesystemNodes: make(map[string]*object_storage.FilesystemObjectStore),
+	}, nil
+}
+
+// DiscoverNodes reads the discovery file and returns an object storage node for each node listed.
+// Misconfigured nodes, and nodes that can't be reached, are skipped with a warning
+func (fds *FileDiscoveryService) DiscoverNodes(ctx context.Context) ([]ports.ObjectStorage, error) {
+	fileNodes, err := fds.readNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	fds.mu.Lock()
+	defer fds.mu.Unlock()
+
+	filesystemNodes := make(map[string]*object_storage.FilesystemObjectStore)
+	var objectStorages []ports.ObjectStorage
+	for _, n := range fileNodes.Nodes {
+		if n.ID == "" || (n.Endpoint == "") == (n.Path == "") {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("skipping node %q: an id and either an endpoint or a path are required", n.ID))
+			continue
+		}
+
+		var (
+			node ports.ObjectStorage
+			err  error
+		)
+
+		if n.Path != "" {
+			node, err = fds.filesystemNode(n, filesystemNodes)
+		} else {
+			node, err = object_storage.NewS3ObjectStore(ctx, n.ID, n.s3NodeConfig())
+		}
+		if err != nil {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("skipping node %s: %s", n.ID, err))
+			continue
+		}
+
+		objectStorages = append(objectStorages, object_storage.WithNodeMetadata(node, n.Weight, n.Zone))
+	}
+
+	fds.filesystemNodes = filesystemNodes
+
+	return objectStorages, nil
+}
+
+// filesystemNode returns the node of a local directory, the one of the previous discovery when the node kept its path,
+// and records it in nodes. The lock must be held
+func (fds *FileDiscoveryService) filesystemNode(n FileNode, nodes map[string]*object_storage.FilesystemObjectStore) (ports.ObjectStorage, error) {
+	node, ok := fds.filesystemNodes[n.ID]
+	if !ok || node.Root() != n.Path {
+		var err error
+		if node, err = object_storage.NewFilesystemObjectStore(n.ID, n.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes[n.ID] = node
+
+	return node, nil
+}
+
+// Watch polls the discovery file and notifies every change of its modification time or size
+func (fds *FileDiscoveryService) Watch(ctx context.Context) (<-chan struct{}, error) {
+	last, err := os.Stat(fds.path)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(fds.watchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// a file being replaced may briefly be missing, the next tick picks it up
+			current, err := os.Stat(fds.path)
+			if err != nil {
+				continue
+			}
+
+			if current.ModTime().Equal(last.ModTime()) && current.Size() == last.Size() {
+				continue
+			}
+			last = current
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+func (fds *FileDiscoveryService) readNodes() (*FileNodes, error) {
+	raw, err := os.ReadFile(fds.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileNodes FileNodes
+	switch filepath.Ext(fds.path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &fileNodes)
+	default:
+		err = json.Unmarshal(raw, &fileNodes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse discovery file %s: %w", fds.path, err)
+	}
+
+	return &fileNodes, nil
+}
+
+// s3NodeConfig returns the configuration of an S3 compatible node
+func (n FileNode) s3NodeConfig() object_storage.S3NodeConfig {
+	return object_storage.S3NodeConfig{
+		Endpoint:     n.Endpoint,
+		Bucket:       n.Bucket,
+		Region:       n.Region,
+		Secure:       n.Secure,
+		CAFile:       n.CAFile,
+		BucketLookup: n.BucketLookup,
+		Credentials: object_storage.S3Credentials{
+			Provider:     n.CredentialsProvider,
+			AccessKey:    n.AccessKey,
+			SecretKey:    n.SecretKey,
+			SessionToken: n.SessionToken,
+			File:         n.CredentialsFile,
+			Profile:      n.CredentialsProfile,
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package discovery_service_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"storage-gateway/infrastructure/discovery-service"
+)
+
+func TestFileDiscoveryServiceKeepsWritesInProgressAcrossRefreshes(t *testing.T) {
+	root := t.TempDir()
+	tmp := filepath.Join(root, "tmp")
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a temporary file left by an earlier process is removed, one of a write in progress is kept
+	stale := filepath.Join(tmp, "data-stale")
+	if err := os.WriteFile(stale, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(stale, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "nodes.json")
+	if err := os.WriteFile(path, []byte(`{"nodes": [{"id": "local", "path": "`+root+`"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := discovery_service.NewFileDiscoveryService(path, 0)
+	if err != nil {
+		t.Fatalf("create file discovery: %v", err)
+	}
+
+	if _, err = fds.DiscoverNodes(context.Background()); err != nil {
+		t.Fatalf("discover nodes: %v", err)
+	}
+	if _, err = os.Stat(stale); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("stale temporary file stat error = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	inProgress := filepath.Join(tmp, "data-in-progress")
+	if err = os.WriteFile(inProgress, []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err := fds.DiscoverNodes(context.Background())
+	if err != nil {
+		t.Fatalf("refresh nodes: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].ID() != "local" {
+		t.Fatalf("refreshed nodes = %v, want the local node", nodes)
+	}
+	if _, err = os.Stat(inProgress); err != nil {
+		t.Fatalf("temporary file of a write in progress removed by a refresh: %v", err)
+	}
+}
+
+func TestFileDiscoveryServiceSkipsFailingNodes(t *testing.T) {
+	root := t.TempDir()
+
+	// a directory node can't be created below a regular file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, []byte("not a directory"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "nodes.yaml")
+	nodes := "nodes:\n" +
+		"  - id: local\n    path: " + root + "\n" +
+		"  - id: broken\n    path: " + filepath.Join(file, "node") + "\n" +
+		"  - id: misconfigured\n"
+	if err := os.WriteFile(path, []byte(nodes), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := discovery_service.NewFileDiscoveryService(path, 0)
+	if err != nil {
+		t.Fatalf("create file discovery: %v", err)
+	}
+
+	discovered, err := fds.DiscoverNodes(context.Background())
+	if err != nil {
+		t.Fatalf("discover nodes: %v", err)
+	}
+	if len(discovered) != 1 || discovered[0].ID() != "local" {
+		t.Fatalf("discovered nodes = %v, want the local node only", discovered)
+	}
+}
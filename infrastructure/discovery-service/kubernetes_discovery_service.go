@@ -0,0 +1,301 @@
+package discovery_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/ports"
+	"storage-gateway/infrastructure/object-storage"
+	"storage-gateway/internal/context-wrapper"
+	"storage-gateway/internal/log"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	defaultSecretAccessKeyField = "accessKey"
+	defaultSecretSecretKeyField = "secretKey"
+	// informerResync is the interval at which the informer replays its cache, the node pool having its own resync
+	informerResync = 10 * time.Minute
+)
+
+// KubernetesOptions selects the EndpointSlices of the object storage nodes and the Secret holding their credentials
+type KubernetesOptions struct {
+	Namespace string
+	// LabelSelector selects the EndpointSlices, such as kubernetes.io/service-name=minio
+	LabelSelector string
+	// PortName is the name of the EndpointSlice port the nodes listen on, the first port when empty
+	PortName string
+	// SecretName is the Secret of the namespace holding the node credentials, only read with static credentials
+	SecretName string
+	// AccessKeyField and SecretKeyField are the keys of the credentials in the Secret data
+	AccessKeyField string
+	SecretKeyField string
+	// Node is the configuration shared by every endpoint, its static credentials being those of the Secret
+	Node object_storage.S3NodeConfig
+}
+
+// KubernetesDiscoveryService represents a service discovering object storage nodes from the ready endpoints of Kubernetes EndpointSlices
+type KubernetesDiscoveryService struct {
+	client   kubernetes.Interface
+	opts     KubernetesOptions
+	selector labels.Selector
+	// lister serves the EndpointSlices from the informer cache once Watch started it
+	lister discoverylisters.EndpointSliceNamespaceLister
+	// credentials are the last ones read from the Secret, used while the API server is unavailable
+	credentials *Credentials
+	mu          sync.Mutex
+}
+
+// NewKubernetesClient creates a Kubernetes client from the kubeconfig file, or from the in-cluster configuration when kubeconfig is empty
+func NewKubernetesClient(kubeconfig string) (kubernetes.Interface, error) {
+	var (
+		cfg *rest.Config
+		err error
+	)
+
+	if kubeconfig == "" {
+		cfg, err = rest.InClusterConfig()
+	} else {
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes config: %w", err)
+	}
+
+	return kubernetes.NewForConfig(cfg)
+}
+
+// NewKubernetesDiscoveryService creates a new instance of KubernetesDiscoveryService
+func NewKubernetesDiscoveryService(client kubernetes.Interface, opts KubernetesOptions) (*KubernetesDiscoveryService, error) {
+	if opts.Namespace == "" {
+		return nil, errors.New("kubernetes discovery namespace is required")
+	}
+
+	if opts.SecretName == "" && staticCredentials(opts.Node.Credentials) {
+		return nil, errors.New("kubernetes discovery secret name is required with static credentials")
+	}
+
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("label selector: %w", err)
+	}
+
+	if opts.AccessKeyField == "" {
+		opts.AccessKeyField = defaultSecretAccessKeyField
+	}
+
+	if opts.SecretKeyField == "" {
+		opts.SecretKeyField = defaultSecretSecretKeyField
+	}
+
+	return &KubernetesDiscoveryService{
+		client:   client,
+		opts:     opts,
+		selector: selector,
+	}, nil
+}
+
+// DiscoverNodes returns an object storage node for each ready endpoint of the selected EndpointSlices.
+// EndpointSlices come from the informer cache once watching, which keeps serving the last known state while the API server is unavailable
+func (kds *KubernetesDiscoveryService) DiscoverNodes(ctx context.Context) ([]ports.ObjectStorage, error) {
+	slices, err := kds.endpointSlices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	template := kds.opts.Node
+	if staticCredentials(template.Credentials) {
+		credentials, err := kds.readCredentials(ctx)
+		if err != nil {
+			return nil, err
+		}
+		template.Credentials.AccessKey, template.Credentials.SecretKey = credentials.AccessKey, credentials.SecretKey
+	}
+
+	seen := make(map[string]bool)
+	var objectStorages []ports.ObjectStorage
+	for _, slice := range slices {
+		port, ok := kds.slicePort(slice)
+		if !ok {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("skipping endpoint slice %s: port not found", slice.Name))
+			continue
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			if !endpointReady(endpoint) || len(endpoint.Addresses) == 0 {
+				continue
+			}
+
+			id := endpoint.Addresses[0]
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Name != "" {
+				id = endpoint.TargetRef.Name
+			}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			cfg := template
+			cfg.Endpoint = net.JoinHostPort(endpoint.Addresses[0], strconv.Itoa(int(port)))
+
+			node, err := object_storage.NewS3ObjectStore(ctx, id, cfg)
+			if err != nil {
+				log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("skipping endpoint %s: %s", id, err))
+				continue
+			}
+
+			zone := ""
+			if endpoint.Zone != nil {
+				zone = *endpoint.Zone
+			}
+
+			objectStorages = append(objectStorages, object_storage.WithNodeMetadata(node, 0, zone))
+		}
+	}
+
+	return objectStorages, nil
+}
+
+// Watch starts an informer on the selected EndpointSlices and notifies every change of them
+func (kds *KubernetesDiscoveryService) Watch(ctx context.Context) (<-chan struct{}, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(kds.client, informerResync,
+		informers.WithNamespace(kds.opts.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = kds.selector.String()
+		}),
+	)
+
+	informer := factory.Discovery().V1().EndpointSlices()
+
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { notify() },
+		UpdateFunc: func(interface{}, interface{}) { notify() },
+		DeleteFunc: func(interface{}) { notify() },
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	factory.Start(ctx.Done())
+
+	go func() {
+		defer close(changes)
+
+		// the informer retries on its own while the API server is unavailable, the cache is used once it synced
+		if cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+			kds.mu.Lock()
+			kds.lister = informer.Lister().EndpointSlices(kds.opts.Namespace)
+			kds.mu.Unlock()
+			notify()
+		}
+
+		<-ctx.Done()
+		factory.Shutdown()
+	}()
+
+	return changes, nil
+}
+
+// endpointSlices returns the selected EndpointSlices ordered by name, from the informer cache when it synced
+func (kds *KubernetesDiscoveryService) endpointSlices(ctx context.Context) ([]*discoveryv1.EndpointSlice, error) {
+	kds.mu.Lock()
+	lister := kds.lister
+	kds.mu.Unlock()
+
+	var slices []*discoveryv1.EndpointSlice
+	if lister != nil {
+		cached, err := lister.List(kds.selector)
+		if err != nil {
+			return nil, err
+		}
+		slices = cached
+	} else {
+		list, err := kds.client.DiscoveryV1().EndpointSlices(kds.opts.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: kds.selector.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list endpoint slices: %w", err)
+		}
+		for i := range list.Items {
+			slices = append(slices, &list.Items[i])
+		}
+	}
+
+	sort.Slice(slices, func(i, j int) bool {
+		return slices[i].Name < slices[j].Name
+	})
+
+	return slices, nil
+}
+
+// readCredentials reads the node credentials from the Secret, falling back to the last ones read when the API server is unavailable
+func (kds *KubernetesDiscoveryService) readCredentials(ctx context.Context) (Credentials, error) {
+	secret, err := kds.client.CoreV1().Secrets(kds.opts.Namespace).Get(ctx, kds.opts.SecretName, metav1.GetOptions{})
+	if err != nil {
+		kds.mu.Lock()
+		defer kds.mu.Unlock()
+
+		if kds.credentials != nil {
+			log.Warnt(context_wrapper.GetCorrelationID(ctx), fmt.Sprintf("could not read secret %s, using the last credentials read: %s", kds.opts.SecretName, err))
+			return *kds.credentials, nil
+		}
+
+		return Credentials{}, fmt.Errorf("read secret %s: %w", kds.opts.SecretName, err)
+	}
+
+	credentials := Credentials{
+		AccessKey: string(secret.Data[kds.opts.AccessKeyField]),
+		SecretKey: string(secret.Data[kds.opts.SecretKeyField]),
+	}
+	if credentials.AccessKey == "" || credentials.SecretKey == "" {
+		return Credentials{}, fmt.Errorf("keys not found in secret %s", kds.opts.SecretName)
+	}
+
+	kds.mu.Lock()
+	kds.credentials = &credentials
+	kds.mu.Unlock()
+
+	return credentials, nil
+}
+
+// slicePort returns the port of the EndpointSlice the nodes listen on
+func (kds *KubernetesDiscoveryService) slicePort(slice *discoveryv1.EndpointSlice) (int32, bool) {
+	for _, port := range slice.Ports {
+		if port.Port == nil {
+			continue
+		}
+		if kds.opts.PortName == "" || (port.Name != nil && *port.Name == kds.opts.PortName) {
+			return *port.Port, true
+		}
+	}
+
+	return 0, false
+}
+
+// endpointReady tells whether an endpoint is ready, an unknown readiness being ready as the EndpointSlice API defines it
+func endpointReady(endpoint discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
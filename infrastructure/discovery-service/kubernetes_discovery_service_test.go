@@ -0,0 +1,159 @@
+package discovery_service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"storage-gateway/infrastructure/discovery-service"
+	"storage-gateway/infrastructure/object-storage"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const kubernetesNamespace = "storage"
+
+func TestKubernetesDiscoveryServiceWatchesEndpointSlices(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	host, port := splitHostPort(t, server.Listener.Addr().String())
+
+	client := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: kubernetesNamespace, Name: "minio"},
+			Data:       map[string][]byte{"accessKey": []byte("access"), "secretKey": []byte("secret")},
+		},
+		endpointSlice("minio-a", "minio", int32(port), endpoint("minio-0", host, true), endpoint("minio-1", host, false)),
+		endpointSlice("other", "other", int32(port), endpoint("other-0", host, true)),
+	)
+
+	kds, err := discovery_service.NewKubernetesDiscoveryService(client, discovery_service.KubernetesOptions{
+		Namespace:     kubernetesNamespace,
+		LabelSelector: discoveryv1.LabelServiceName + "=minio",
+		SecretName:    "minio",
+		Node:          object_storage.S3NodeConfig{Region: "us-east-1", BucketLookup: "path"},
+	})
+	if err != nil {
+		t.Fatalf("create kubernetes discovery: %v", err)
+	}
+
+	// before the informer synced, endpoint slices are listed from the API server
+	assertNodeIDs(t, kds, "minio-0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes, err := kds.Watch(ctx)
+	if err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	waitForChange(t, changes)
+
+	_, err = client.DiscoveryV1().EndpointSlices(kubernetesNamespace).Create(ctx,
+		endpointSlice("minio-b", "minio", int32(port), endpoint("minio-2", host, true)), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("create endpoint slice: %v", err)
+	}
+	waitForChange(t, changes)
+	assertNodeIDs(t, kds, "minio-0", "minio-2")
+
+	err = client.DiscoveryV1().EndpointSlices(kubernetesNamespace).Delete(ctx, "minio-a", metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("delete endpoint slice: %v", err)
+	}
+	waitForChange(t, changes)
+	assertNodeIDs(t, kds, "minio-2")
+
+	// the last credentials read keep being used when the secret can't be read
+	err = client.CoreV1().Secrets(kubernetesNamespace).Delete(ctx, "minio", metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("delete secret: %v", err)
+	}
+	assertNodeIDs(t, kds, "minio-2")
+}
+
+func TestKubernetesDiscoveryServiceKeepsCredentialsProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	host, port := splitHostPort(t, server.Listener.Addr().String())
+	client := fake.NewSimpleClientset(endpointSlice("minio-a", "minio", int32(port), endpoint("minio-0", host, true)))
+
+	// without static credentials no secret is needed
+	kds, err := discovery_service.NewKubernetesDiscoveryService(client, discovery_service.KubernetesOptions{
+		Namespace:     kubernetesNamespace,
+		LabelSelector: discoveryv1.LabelServiceName + "=minio",
+		Node: object_storage.S3NodeConfig{
+			Region:       "us-east-1",
+			BucketLookup: "path",
+			Credentials:  object_storage.S3Credentials{Provider: object_storage.CredentialsEnv},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create kubernetes discovery: %v", err)
+	}
+
+	assertNodeIDs(t, kds, "minio-0")
+}
+
+func assertNodeIDs(t *testing.T, kds *discovery_service.KubernetesDiscoveryService, want ...string) {
+	t.Helper()
+
+	nodes, err := kds.DiscoverNodes(context.Background())
+	if err != nil {
+		t.Fatalf("discover nodes: %v", err)
+	}
+
+	ids := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.ID())
+	}
+	sort.Strings(ids)
+
+	if len(ids) != len(want) {
+		t.Fatalf("discovered nodes %v, want %v", ids, want)
+	}
+	for i := range ids {
+		if ids[i] != want[i] {
+			t.Fatalf("discovered nodes %v, want %v", ids, want)
+		}
+	}
+}
+
+func waitForChange(t *testing.T, changes <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notified after 5s")
+	}
+}
+
+func endpointSlice(name, service string, port int32, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: kubernetesNamespace,
+			Name:      name,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports:       []discoveryv1.EndpointPort{{Port: &port}},
+	}
+}
+
+func endpoint(pod, address string, ready bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{address},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", Namespace: kubernetesNamespace, Name: pod},
+	}
+}
@@ -0,0 +1,115 @@
+package discovery_service
+
+import (
+	"context"
+	"sync"
+
+	"storage-gateway/domain/ports"
+)
+
+// MemoryDiscoveryService represents a programmable discovery service returning the nodes it was given,
+// so the node pool can be driven in-process without any infrastructure
+type MemoryDiscoveryService struct {
+	nodes    []ports.ObjectStorage
+	err      error
+	watchers []chan struct{}
+	mu       sync.Mutex
+}
+
+// NewMemoryDiscoveryService creates a new instance of MemoryDiscoveryService discovering the given nodes
+func NewMemoryDiscoveryService(nodes ...ports.ObjectStorage) *MemoryDiscoveryService {
+	return &MemoryDiscoveryService{
+		nodes: nodes,
+	}
+}
+
+// DiscoverNodes returns the current nodes, or the error set with SetError
+func (mds *MemoryDiscoveryService) DiscoverNodes(_ context.Context) ([]ports.ObjectStorage, error) {
+	mds.mu.Lock()
+	defer mds.mu.Unlock()
+
+	if mds.err != nil {
+		return nil, mds.err
+	}
+
+	return append([]ports.ObjectStorage(nil), mds.nodes...), nil
+}
+
+// SetNodes replaces the discovered nodes and notifies the watchers
+func (mds *MemoryDiscoveryService) SetNodes(nodes ...ports.ObjectStorage) {
+	mds.mu.Lock()
+	mds.nodes = append([]ports.ObjectStorage(nil), nodes...)
+	mds.mu.Unlock()
+
+	mds.notify()
+}
+
+// AddNode adds a node to the discovered ones and notifies the watchers
+func (mds *MemoryDiscoveryService) AddNode(node ports.ObjectStorage) {
+	mds.mu.Lock()
+	mds.nodes = append(mds.nodes, node)
+	mds.mu.Unlock()
+
+	mds.notify()
+}
+
+// RemoveNode removes the node with the given ID from the discovered ones and notifies the watchers
+func (mds *MemoryDiscoveryService) RemoveNode(id string) {
+	mds.mu.Lock()
+	nodes := make([]ports.ObjectStorage, 0, len(mds.nodes))
+	for _, node := range mds.nodes {
+		if node.ID() != id {
+			nodes = append(nodes, node)
+		}
+	}
+	mds.nodes = nodes
+	mds.mu.Unlock()
+
+	mds.notify()
+}
+
+// SetError makes the next discoveries fail with err, until it is reset with a nil error
+func (mds *MemoryDiscoveryService) SetError(err error) {
+	mds.mu.Lock()
+	defer mds.mu.Unlock()
+
+	mds.err = err
+}
+
+// Watch notifies every change of the discovered nodes until the context is done
+func (mds *MemoryDiscoveryService) Watch(ctx context.Context) (<-chan struct{}, error) {
+	changes := make(chan struct{}, 1)
+
+	mds.mu.Lock()
+	mds.watchers = append(mds.watchers, changes)
+	mds.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		mds.mu.Lock()
+		defer mds.mu.Unlock()
+
+		for i, watcher := range mds.watchers {
+			if watcher == changes {
+				mds.watchers = append(mds.watchers[:i], mds.watchers[i+1:]...)
+				break
+			}
+		}
+		close(changes)
+	}()
+
+	return changes, nil
+}
+
+func (mds *MemoryDiscoveryService) notify() {
+	mds.mu.Lock()
+	defer mds.mu.Unlock()
+
+	for _, watcher := range mds.watchers {
+		select {
+		case watcher <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package kms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const masterKeySize = 32
+
+// KeyFile is the content of a master key file. Keys are base64 encoded 256-bit keys indexed by ID,
+// Current being the ID of the key used to wrap new data keys. Former keys must be kept until every data key has been re-wrapped
+type KeyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// KeyFileKMS represents a key management service keeping its master keys in a local file
+type KeyFileKMS struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyFileKMS creates a new instance of KeyFileKMS with the master keys of the given file
+func NewKeyFileKMS(path string) (*KeyFileKMS, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	var keyFile KeyFile
+	if err = json.Unmarshal(raw, &keyFile); err != nil {
+		return nil, fmt.Errorf("parse key file: %w", err)
+	}
+
+	if _, ok := keyFile.Keys[keyFile.Current]; !ok {
+		return nil, fmt.Errorf("current key %q not found in key file", keyFile.Current)
+	}
+
+	keys := make(map[string]cipher.AEAD, len(keyFile.Keys))
+	for id, encoded := range keyFile.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != masterKeySize {
+			return nil, fmt.Errorf("key %q is not a base64 encoded 256-bit key", id)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	return &KeyFileKMS{
+		current: keyFile.Current,
+		keys:    keys,
+	}, nil
+}
+
+// WrapKey encrypts a data key with AES-256-GCM under the current master key, the random nonce prefixing the result
+func (kfk *KeyFileKMS) WrapKey(_ context.Context, plaintext []byte) ([]byte, string, error) {
+	aead := kfk.keys[kfk.current]
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", err
+	}
+
+	// the key ID is authenticated so that a wrapped key can't be presented under another master key
+	return aead.Seal(nonce, nonce, plaintext, []byte(kfk.current)), kfk.current, nil
+}
+
+// UnwrapKey decrypts a data key wrapped with the master key of the given ID
+func (kfk *KeyFileKMS) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := kfk.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q not found", keyID)
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
+
+// CurrentKeyID returns the ID of the master key new data keys are wrapped with
+func (kfk *KeyFileKMS) CurrentKeyID() string {
+	return kfk.current
+}
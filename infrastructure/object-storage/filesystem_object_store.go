@@ -0,0 +1,402 @@
+package object_storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/models"
+)
+
+const (
+	dataDir = "data"
+	metaDir = "meta"
+	tmpDir  = "tmp"
+)
+
+var (
+	// processStart tells the temporary files left by the writes of an earlier process from those of writes in progress
+	processStart = time.Now()
+	// cleanedTmpDirs are the temporary directories whose stale files were already removed by this process
+	cleanedTmpDirs sync.Map
+)
+
+// fileMetadata is the content of the sidecar metadata file of an object
+type fileMetadata struct {
+	ContentType  string            `json:"contentType"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag"`
+	LastModified time.Time         `json:"lastModified"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// FilesystemObjectStore represents an object storage node keeping objects as files under a root directory.
+// The content of an object is stored in data/<id> and its metadata in the sidecar file meta/<id>.json,
+// IDs being path escaped
+type FilesystemObjectStore struct {
+	id   string
+	root string
+	// mu makes the data and metadata files of an object change together
+	mu sync.RWMutex
+}
+
+// NewFilesystemObjectStore creates a new instance of FilesystemObjectStore under the root directory,
+// creating its directories and removing, once per process, the temporary files left by the interrupted writes of an earlier process
+func NewFilesystemObjectStore(id, root string) (*FilesystemObjectStore, error) {
+	for _, dir := range []string{dataDir, metaDir, tmpDir} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := removeStaleTemp(filepath.Join(root, tmpDir)); err != nil {
+		return nil, err
+	}
+
+	return &FilesystemObjectStore{
+		id:   id,
+		root: root,
+	}, nil
+}
+
+// PutObject writes an object to a temporary file and renames it into place along with its metadata, so readers never see a partial object.
+// A negative size means the length is unknown, otherwise the content must have exactly that size
+func (fos *FilesystemObjectStore) PutObject(ctx context.Context, o *models.Object) error {
+	name := o.ID.Value()
+
+	tmpData, err := os.CreateTemp(filepath.Join(fos.root, tmpDir), "data-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpData.Name())
+
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmpData, hash), contextReader{ctx: ctx, r: o.Content})
+	if err == nil {
+		err = tmpData.Sync()
+	}
+	if closeErr := tmpData.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if o.Size >= 0 && written != o.Size {
+		return fmt.Errorf("object size %d differs from the %d bytes read", o.Size, written)
+	}
+
+	tmpMeta, err := fos.writeTemp(fileMetadata{
+		ContentType:  o.ContentType,
+		Size:         written,
+		ETag:         hex.EncodeToString(hash.Sum(nil)),
+		LastModified: time.Now().UTC(),
+		Metadata:     o.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpMeta)
+
+	fos.mu.Lock()
+	defer fos.mu.Unlock()
+
+	if err = os.Rename(tmpData.Name(), fos.dataPath(name)); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpMeta, fos.metaPath(name))
+}
+
+// writeTemp writes the metadata of an object to a temporary file and returns its path
+func (fos *FilesystemObjectStore) writeTemp(meta fileMetadata) (string, error) {
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(fos.root, tmpDir), "meta-")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tmp.Write(raw)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+// GetObject opens an object file and returns the associated object metadata.
+// When rng is not nil only that part of the object is read
+func (fos *FilesystemObjectStore) GetObject(_ context.Context, name string, rng *models.ByteRange) (*models.Object, error) {
+	fos.mu.RLock()
+	meta, err := fos.readMetadata(name)
+	if err != nil {
+		fos.mu.RUnlock()
+		return nil, err
+	}
+
+	// the opened file keeps its content even if the object is replaced or deleted afterwards
+	f, err := os.Open(fos.dataPath(name))
+	fos.mu.RUnlock()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, models.ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	obj := meta.object(name)
+	obj.Content = f
+
+	if rng != nil {
+		if rng.Start < 0 || rng.Start >= meta.Size || rng.End < rng.Start {
+			f.Close()
+			return nil, models.ErrRangeNotSatisfiable
+		}
+
+		if _, err = f.Seek(rng.Start, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		obj.Range = rng
+		obj.Content = readCloser{
+			Reader: io.LimitReader(f, min(rng.End, meta.Size-1)-rng.Start+1),
+			Closer: f,
+		}
+	}
+
+	return obj, nil
+}
+
+// StatObject reads the metadata of an object without opening its content
+func (fos *FilesystemObjectStore) StatObject(_ context.Context, name string) (*models.Object, error) {
+	fos.mu.RLock()
+	defer fos.mu.RUnlock()
+
+	meta, err := fos.readMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta.object(name), nil
+}
+
+// DeleteObject removes the data and metadata files of an object, returning models.ErrObjectNotFound when it doesn't exist
+func (fos *FilesystemObjectStore) DeleteObject(_ context.Context, name string) error {
+	fos.mu.Lock()
+	defer fos.mu.Unlock()
+
+	if err := os.Remove(fos.metaPath(name)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return models.ErrObjectNotFound
+		}
+		return err
+	}
+
+	if err := os.Remove(fos.dataPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// ReplaceMetadata rewrites the sidecar metadata file of an object with the content type and metadata of o,
+// only while its ETag is still o.ETag
+func (fos *FilesystemObjectStore) ReplaceMetadata(_ context.Context, o *models.Object) error {
+	name := o.ID.Value()
+
+	fos.mu.Lock()
+	defer fos.mu.Unlock()
+
+	meta, err := fos.readMetadata(name)
+	if err != nil {
+		return err
+	}
+	if meta.ETag != o.ETag {
+		return models.ErrObjectModified
+	}
+
+	meta.ContentType = o.ContentType
+	meta.Metadata = o.Metadata
+
+	tmpMeta, err := fos.writeTemp(*meta)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpMeta)
+
+	return os.Rename(tmpMeta, fos.metaPath(name))
+}
+
+// ListObjects lists up to limit objects matching prefix and sorted after startAfter
+func (fos *FilesystemObjectStore) ListObjects(_ context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	fos.mu.RLock()
+	defer fos.mu.RUnlock()
+
+	entries, err := os.ReadDir(filepath.Join(fos.root, metaDir))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		escaped, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+
+		name, err := url.PathUnescape(escaped)
+		if err != nil || !strings.HasPrefix(name, prefix) || name <= startAfter {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	objects := make([]*models.Object, 0, min(limit, len(names)))
+	for _, name := range names {
+		if len(objects) == limit {
+			break
+		}
+
+		meta, err := fos.readMetadata(name)
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, meta.object(name))
+	}
+
+	return objects, nil
+}
+
+// readMetadata reads the sidecar metadata file of an object, the caller holding the lock
+func (fos *FilesystemObjectStore) readMetadata(name string) (*fileMetadata, error) {
+	raw, err := os.ReadFile(fos.metaPath(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, models.ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	var meta fileMetadata
+	if err = json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("metadata of %s: %w", name, err)
+	}
+
+	return &meta, nil
+}
+
+func (fos *FilesystemObjectStore) dataPath(name string) string {
+	return filepath.Join(fos.root, dataDir, url.PathEscape(name))
+}
+
+func (fos *FilesystemObjectStore) metaPath(name string) string {
+	return filepath.Join(fos.root, metaDir, url.PathEscape(name)+".json")
+}
+
+// removeStaleTemp removes the files of a temporary directory created before the process started,
+// writes of this process being able to use the directory through other instances of the same root
+func removeStaleTemp(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if _, cleaned := cleanedTmpDirs.LoadOrStore(abs, true); cleaned {
+		return nil
+	}
+
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		cleanedTmpDirs.Delete(abs)
+		return err
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(processStart) {
+			continue
+		}
+
+		if err = os.RemoveAll(filepath.Join(abs, entry.Name())); err != nil {
+			cleanedTmpDirs.Delete(abs)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Root returns the directory the objects are stored under
+func (fos *FilesystemObjectStore) Root() string {
+	return fos.root
+}
+
+// ID returns the unique identifier associated with the FilesystemObjectStore
+func (fos *FilesystemObjectStore) ID() string {
+	return fos.id
+}
+
+// IsOnline checks if the root directory of the FilesystemObjectStore is available
+func (fos *FilesystemObjectStore) IsOnline() bool {
+	info, err := os.Stat(fos.root)
+	return err == nil && info.IsDir()
+}
+
+func (meta *fileMetadata) object(name string) *models.Object {
+	return &models.Object{
+		ID:           models.ObjectID(name),
+		ContentType:  meta.ContentType,
+		Size:         meta.Size,
+		ETag:         meta.ETag,
+		LastModified: meta.LastModified,
+		Metadata:     maps.Clone(meta.Metadata),
+	}
+}
+
+// readCloser reads a part of a file while closing the whole file
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader stops reading once its context is done, like the uploads of the MinIO client
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
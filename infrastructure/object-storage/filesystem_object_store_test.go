@@ -0,0 +1,20 @@
+package object_storage_test
+
+import (
+	"testing"
+
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/ports/storagetest"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestFilesystemObjectStoreConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) ports.ObjectStorage {
+		store, err := object_storage.NewFilesystemObjectStore("filesystem", t.TempDir())
+		if err != nil {
+			t.Fatalf("create filesystem store: %v", err)
+		}
+
+		return store
+	})
+}
@@ -0,0 +1,238 @@
+package object_storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"sort"
+	"strings"
+	"time"
+
+	"storage-gateway/domain/models"
+
+	"github.com/google/uuid"
+)
+
+// memoryUpload is a multipart upload in progress on a MemoryObjectStore
+type memoryUpload struct {
+	id          models.ObjectID
+	contentType string
+	metadata    map[string]string
+	initiated   time.Time
+	parts       map[int]*memoryPart
+}
+
+type memoryPart struct {
+	content      []byte
+	etag         string
+	lastModified time.Time
+}
+
+// NewMultipartUpload starts a multipart upload of an object
+func (mos *MemoryObjectStore) NewMultipartUpload(_ context.Context, o *models.Object) (string, error) {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	if !mos.online {
+		return "", models.ErrObjectStorageNotAvailable
+	}
+
+	uploadID := uuid.New().String()
+	mos.uploads[uploadID] = &memoryUpload{
+		id:          o.ID,
+		contentType: o.ContentType,
+		metadata:    maps.Clone(o.Metadata),
+		initiated:   time.Now().UTC(),
+		parts:       make(map[int]*memoryPart),
+	}
+
+	return uploadID, nil
+}
+
+// PutObjectPart reads the whole part content and stores it, replacing the part of the same number if any.
+// A negative size means the length is unknown, otherwise the content must have exactly that size
+func (mos *MemoryObjectStore) PutObjectPart(ctx context.Context, id, uploadID string, number int, content io.Reader, size int64) (*models.Part, error) {
+	if !models.IsValidPartNumber(number) {
+		return nil, models.ErrPartNotValid
+	}
+
+	raw, err := io.ReadAll(contextReader{ctx: ctx, r: content})
+	if err != nil {
+		return nil, err
+	}
+
+	if size >= 0 && int64(len(raw)) != size {
+		return nil, fmt.Errorf("part size %d differs from the %d bytes read", size, len(raw))
+	}
+
+	sum := md5.Sum(raw)
+	part := &memoryPart{
+		content:      raw,
+		etag:         hex.EncodeToString(sum[:]),
+		lastModified: time.Now().UTC(),
+	}
+
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	upload, err := mos.lookupUpload(id, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	upload.parts[number] = part
+
+	return part.model(number), nil
+}
+
+// ListObjectParts returns the parts of an upload in ascending number order
+func (mos *MemoryObjectStore) ListObjectParts(_ context.Context, id, uploadID string) ([]*models.Part, error) {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	upload, err := mos.lookupUpload(id, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*models.Part, 0, len(upload.parts))
+	for number, part := range upload.parts {
+		parts = append(parts, part.model(number))
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+
+	return parts, nil
+}
+
+// CompleteMultipartUpload stores the object made of the given parts, and drops the upload once the object is stored.
+// Parts must be listed in ascending number order, and all of them but the last one must hold at least models.MinPartSize bytes
+func (mos *MemoryObjectStore) CompleteMultipartUpload(ctx context.Context, id, uploadID string, parts []*models.Part) (*models.Object, error) {
+	mos.mu.Lock()
+	upload, err := mos.lookupUpload(id, uploadID)
+	if err != nil {
+		mos.mu.Unlock()
+		return nil, err
+	}
+
+	contents, err := upload.contents(parts)
+	obj := &models.Object{
+		ID:          upload.id,
+		ContentType: upload.contentType,
+		Metadata:    upload.metadata,
+	}
+	mos.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// part contents are never modified, so they are read without holding the lock
+	var size int64
+	for _, content := range contents {
+		size += int64(len(content))
+	}
+	obj.Content = io.MultiReader(readers(contents)...)
+	obj.Size = size
+
+	if err = mos.PutObject(ctx, obj); err != nil {
+		return nil, err
+	}
+
+	mos.mu.Lock()
+	delete(mos.uploads, uploadID)
+	mos.mu.Unlock()
+
+	return mos.StatObject(ctx, id)
+}
+
+// AbortMultipartUpload drops an upload and its parts
+func (mos *MemoryObjectStore) AbortMultipartUpload(_ context.Context, id, uploadID string) error {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	if _, err := mos.lookupUpload(id, uploadID); err != nil {
+		return err
+	}
+	delete(mos.uploads, uploadID)
+
+	return nil
+}
+
+// ListMultipartUploads returns the uploads in progress initiated before the given time
+func (mos *MemoryObjectStore) ListMultipartUploads(_ context.Context, initiatedBefore time.Time) ([]*models.MultipartUpload, error) {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	if !mos.online {
+		return nil, models.ErrObjectStorageNotAvailable
+	}
+
+	uploads := make([]*models.MultipartUpload, 0)
+	for uploadID, upload := range mos.uploads {
+		if upload.initiated.Before(initiatedBefore) {
+			uploads = append(uploads, &models.MultipartUpload{ID: upload.id, UploadID: uploadID, Initiated: upload.initiated})
+		}
+	}
+
+	return uploads, nil
+}
+
+// lookupUpload returns an upload of the object, the caller holding the lock
+func (mos *MemoryObjectStore) lookupUpload(id, uploadID string) (*memoryUpload, error) {
+	if !mos.online {
+		return nil, models.ErrObjectStorageNotAvailable
+	}
+
+	upload, ok := mos.uploads[uploadID]
+	if !ok || upload.id.Value() != id {
+		return nil, models.ErrUploadNotFound
+	}
+
+	return upload, nil
+}
+
+// contents returns the contents of the given parts after checking them against the stored ones
+func (upload *memoryUpload) contents(parts []*models.Part) ([][]byte, error) {
+	if len(parts) == 0 {
+		return nil, models.ErrPartNotValid
+	}
+
+	for i, part := range parts {
+		stored, ok := upload.parts[part.Number]
+		if !ok || strings.Trim(part.ETag, `"`) != stored.etag || (i > 0 && part.Number <= parts[i-1].Number) {
+			return nil, models.ErrPartNotValid
+		}
+	}
+
+	contents := make([][]byte, 0, len(parts))
+	for i, part := range parts {
+		content := upload.parts[part.Number].content
+		if i < len(parts)-1 && len(content) < models.MinPartSize {
+			return nil, models.ErrPartTooSmall
+		}
+
+		contents = append(contents, content)
+	}
+
+	return contents, nil
+}
+
+func (part *memoryPart) model(number int) *models.Part {
+	return &models.Part{
+		Number:       number,
+		ETag:         part.etag,
+		Size:         int64(len(part.content)),
+		LastModified: part.lastModified,
+	}
+}
+
+func readers(contents [][]byte) []io.Reader {
+	rs := make([]io.Reader, 0, len(contents))
+	for _, content := range contents {
+		rs = append(rs, bytes.NewReader(content))
+	}
+
+	return rs
+}
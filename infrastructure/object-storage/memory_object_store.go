@@ -0,0 +1,286 @@
+package object_storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"storage-gateway/domain/models"
+)
+
+// MemoryStats reports the usage of a MemoryObjectStore
+type MemoryStats struct {
+	Objects       int
+	UsedBytes     int64
+	CapacityBytes int64
+	Evictions     int
+	EvictedBytes  int64
+}
+
+// memoryObject is an object held by a MemoryObjectStore, its content never being modified once stored
+type memoryObject struct {
+	meta    models.Object
+	content []byte
+	// lru is the element of the object in the least recently used list
+	lru *list.Element
+}
+
+// MemoryObjectStore represents a thread-safe object storage node keeping objects in memory.
+// When a capacity is set, the least recently used objects are evicted to make room for new ones
+type MemoryObjectStore struct {
+	id       string
+	capacity int64
+	objects  map[string]*memoryObject
+	// lru orders the object IDs from the most to the least recently used
+	lru *list.List
+	// uploads are the multipart uploads in progress by upload ID, their parts being held outside of the capacity
+	uploads map[string]*memoryUpload
+	stats   MemoryStats
+	online  bool
+	mu      sync.Mutex
+}
+
+// NewMemoryObjectStore creates a new online instance of MemoryObjectStore holding up to capacity bytes, without limit when capacity is not positive
+func NewMemoryObjectStore(id string, capacity int64) *MemoryObjectStore {
+	if capacity < 0 {
+		capacity = 0
+	}
+
+	return &MemoryObjectStore{
+		id:       id,
+		capacity: capacity,
+		objects:  make(map[string]*memoryObject),
+		lru:      list.New(),
+		uploads:  make(map[string]*memoryUpload),
+		stats:    MemoryStats{CapacityBytes: capacity},
+		online:   true,
+	}
+}
+
+// SetOnline switches the node online or offline, an offline node failing every operation with models.ErrObjectStorageNotAvailable
+func (mos *MemoryObjectStore) SetOnline(online bool) {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	mos.online = online
+}
+
+// Stats returns the current usage of the node
+func (mos *MemoryObjectStore) Stats() MemoryStats {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	stats := mos.stats
+	stats.Objects = len(mos.objects)
+
+	return stats
+}
+
+// PutObject reads the whole object content and stores it, evicting the least recently used objects when the capacity is reached.
+// A negative size means the length is unknown, otherwise the content must have exactly that size
+func (mos *MemoryObjectStore) PutObject(ctx context.Context, o *models.Object) error {
+	if !mos.IsOnline() {
+		return models.ErrObjectStorageNotAvailable
+	}
+
+	content, err := io.ReadAll(contextReader{ctx: ctx, r: o.Content})
+	if err != nil {
+		return err
+	}
+
+	if o.Size >= 0 && int64(len(content)) != o.Size {
+		return fmt.Errorf("object size %d differs from the %d bytes read", o.Size, len(content))
+	}
+
+	if mos.capacity > 0 && int64(len(content)) > mos.capacity {
+		return models.ErrObjectTooLarge
+	}
+
+	sum := md5.Sum(content)
+	obj := &memoryObject{
+		meta: models.Object{
+			ID:           o.ID,
+			ContentType:  o.ContentType,
+			Size:         int64(len(content)),
+			ETag:         hex.EncodeToString(sum[:]),
+			LastModified: time.Now().UTC(),
+			Metadata:     maps.Clone(o.Metadata),
+		},
+		content: content,
+	}
+
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	if !mos.online {
+		return models.ErrObjectStorageNotAvailable
+	}
+
+	mos.remove(o.ID.Value())
+
+	for mos.capacity > 0 && mos.stats.UsedBytes+obj.meta.Size > mos.capacity {
+		oldest := mos.lru.Back().Value.(string)
+		mos.stats.Evictions++
+		mos.stats.EvictedBytes += mos.objects[oldest].meta.Size
+		mos.remove(oldest)
+	}
+
+	obj.lru = mos.lru.PushFront(o.ID.Value())
+	mos.objects[o.ID.Value()] = obj
+	mos.stats.UsedBytes += obj.meta.Size
+
+	return nil
+}
+
+// GetObject returns an object with a reader on its content, only on the given part of it when rng is not nil
+func (mos *MemoryObjectStore) GetObject(_ context.Context, name string, rng *models.ByteRange) (*models.Object, error) {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	obj, err := mos.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	mos.lru.MoveToFront(obj.lru)
+
+	meta := obj.meta
+	meta.Metadata = maps.Clone(meta.Metadata)
+	content := obj.content
+
+	if rng != nil {
+		if rng.Start < 0 || rng.Start >= meta.Size || rng.End < rng.Start {
+			return nil, models.ErrRangeNotSatisfiable
+		}
+
+		meta.Range = rng
+		content = content[rng.Start : min(rng.End, meta.Size-1)+1]
+	}
+
+	meta.Content = bytes.NewReader(content)
+
+	return &meta, nil
+}
+
+// StatObject returns the metadata of an object
+func (mos *MemoryObjectStore) StatObject(_ context.Context, name string) (*models.Object, error) {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	obj, err := mos.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := obj.meta
+	meta.Metadata = maps.Clone(meta.Metadata)
+
+	return &meta, nil
+}
+
+// DeleteObject removes an object, returning models.ErrObjectNotFound when it doesn't exist
+func (mos *MemoryObjectStore) DeleteObject(_ context.Context, name string) error {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	if _, err := mos.lookup(name); err != nil {
+		return err
+	}
+
+	mos.remove(name)
+
+	return nil
+}
+
+// ReplaceMetadata replaces the content type and metadata of an object while its ETag is still o.ETag, keeping its content
+func (mos *MemoryObjectStore) ReplaceMetadata(_ context.Context, o *models.Object) error {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	obj, err := mos.lookup(o.ID.Value())
+	if err != nil {
+		return err
+	}
+	if obj.meta.ETag != o.ETag {
+		return models.ErrObjectModified
+	}
+
+	obj.meta.ContentType = o.ContentType
+	obj.meta.Metadata = maps.Clone(o.Metadata)
+
+	return nil
+}
+
+// ListObjects lists up to limit objects matching prefix and sorted after startAfter
+func (mos *MemoryObjectStore) ListObjects(_ context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	if !mos.online {
+		return nil, models.ErrObjectStorageNotAvailable
+	}
+
+	names := make([]string, 0, len(mos.objects))
+	for name := range mos.objects {
+		if strings.HasPrefix(name, prefix) && name > startAfter {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	objects := make([]*models.Object, 0, min(limit, len(names)))
+	for _, name := range names[:min(limit, len(names))] {
+		meta := mos.objects[name].meta
+		objects = append(objects, &meta)
+	}
+
+	return objects, nil
+}
+
+// lookup returns a stored object, the caller holding the lock
+func (mos *MemoryObjectStore) lookup(name string) (*memoryObject, error) {
+	if !mos.online {
+		return nil, models.ErrObjectStorageNotAvailable
+	}
+
+	obj, ok := mos.objects[name]
+	if !ok {
+		return nil, models.ErrObjectNotFound
+	}
+
+	return obj, nil
+}
+
+// remove drops an object if it exists, the caller holding the lock
+func (mos *MemoryObjectStore) remove(name string) {
+	obj, ok := mos.objects[name]
+	if !ok {
+		return
+	}
+
+	mos.lru.Remove(obj.lru)
+	mos.stats.UsedBytes -= obj.meta.Size
+	delete(mos.objects, name)
+}
+
+// ID returns the unique identifier associated with the MemoryObjectStore
+func (mos *MemoryObjectStore) ID() string {
+	return mos.id
+}
+
+// IsOnline tells whether the MemoryObjectStore has been switched online
+func (mos *MemoryObjectStore) IsOnline() bool {
+	mos.mu.Lock()
+	defer mos.mu.Unlock()
+
+	return mos.online
+}
@@ -0,0 +1,15 @@
+package object_storage_test
+
+import (
+	"testing"
+
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/ports/storagetest"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestMemoryObjectStoreConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) ports.ObjectStorage {
+		return object_storage.NewMemoryObjectStore("memory", 0)
+	})
+}
@@ -0,0 +1,41 @@
+package object_storage
+
+import (
+	"storage-gateway/domain/ports"
+)
+
+// nodeWithMetadata decorates an object storage node with the placement metadata provided by discovery.
+// It implements ports.NodeDecorator, the optional interfaces of the node being reached through Unwrap
+type nodeWithMetadata struct {
+	ports.ObjectStorage
+	weight int
+	zone   string
+}
+
+// WithNodeMetadata returns the node decorated with a weight and a zone, a weight lower than one defaulting to one
+func WithNodeMetadata(node ports.ObjectStorage, weight int, zone string) ports.ObjectStorage {
+	if weight < 1 {
+		weight = 1
+	}
+
+	return &nodeWithMetadata{
+		ObjectStorage: node,
+		weight:        weight,
+		zone:          zone,
+	}
+}
+
+// Weight returns the weight of the node
+func (n *nodeWithMetadata) Weight() int {
+	return n.weight
+}
+
+// Zone returns the zone of the node
+func (n *nodeWithMetadata) Zone() string {
+	return n.zone
+}
+
+// Unwrap returns the decorated node
+func (n *nodeWithMetadata) Unwrap() ports.ObjectStorage {
+	return n.ObjectStorage
+}
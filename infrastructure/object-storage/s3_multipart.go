@@ -0,0 +1,136 @@
+package object_storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"storage-gateway/domain/models"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// listPageSize is the page size of the multipart listings of S3 compatible servers
+const listPageSize = 1000
+
+// NewMultipartUpload starts a multipart upload of an object in the bucket, Metadata being stored as user metadata
+func (sos *S3ObjectStore) NewMultipartUpload(ctx context.Context, o *models.Object) (string, error) {
+	return sos.core().NewMultipartUpload(ctx, sos.bucket, o.ID.Value(), minio.PutObjectOptions{ContentType: o.ContentType, UserMetadata: o.Metadata})
+}
+
+// PutObjectPart streams a part of an upload to the bucket, its size being required by S3
+func (sos *S3ObjectStore) PutObjectPart(ctx context.Context, id, uploadID string, number int, content io.Reader, size int64) (*models.Part, error) {
+	if !models.IsValidPartNumber(number) {
+		return nil, models.ErrPartNotValid
+	}
+	if size < 0 {
+		return nil, models.ErrPartLengthNotValid
+	}
+
+	part, err := sos.core().PutObjectPart(ctx, sos.bucket, id, uploadID, number, content, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return nil, multipartError(err)
+	}
+
+	return &models.Part{
+		Number:       part.PartNumber,
+		ETag:         strings.Trim(part.ETag, `"`),
+		Size:         part.Size,
+		LastModified: part.LastModified,
+	}, nil
+}
+
+// ListObjectParts returns the parts of an upload in ascending number order, reading every page of the listing
+func (sos *S3ObjectStore) ListObjectParts(ctx context.Context, id, uploadID string) ([]*models.Part, error) {
+	parts := make([]*models.Part, 0)
+	marker := 0
+	for {
+		result, err := sos.core().ListObjectParts(ctx, sos.bucket, id, uploadID, marker, listPageSize)
+		if err != nil {
+			return nil, multipartError(err)
+		}
+
+		for _, part := range result.ObjectParts {
+			parts = append(parts, &models.Part{
+				Number:       part.PartNumber,
+				ETag:         strings.Trim(part.ETag, `"`),
+				Size:         part.Size,
+				LastModified: part.LastModified,
+			})
+		}
+
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// CompleteMultipartUpload assembles the object from the given parts and returns its metadata
+func (sos *S3ObjectStore) CompleteMultipartUpload(ctx context.Context, id, uploadID string, parts []*models.Part) (*models.Object, error) {
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+
+	if _, err := sos.core().CompleteMultipartUpload(ctx, sos.bucket, id, uploadID, completed, minio.PutObjectOptions{}); err != nil {
+		return nil, multipartError(err)
+	}
+
+	return sos.StatObject(ctx, id)
+}
+
+// AbortMultipartUpload drops an upload and its parts from the bucket
+func (sos *S3ObjectStore) AbortMultipartUpload(ctx context.Context, id, uploadID string) error {
+	return multipartError(sos.core().AbortMultipartUpload(ctx, sos.bucket, id, uploadID))
+}
+
+// ListMultipartUploads returns the uploads in progress in the bucket initiated before the given time, reading every page of the listing
+func (sos *S3ObjectStore) ListMultipartUploads(ctx context.Context, initiatedBefore time.Time) ([]*models.MultipartUpload, error) {
+	uploads := make([]*models.MultipartUpload, 0)
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		result, err := sos.core().ListMultipartUploads(ctx, sos.bucket, "", keyMarker, uploadIDMarker, "", listPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, upload := range result.Uploads {
+			if upload.Initiated.Before(initiatedBefore) {
+				uploads = append(uploads, &models.MultipartUpload{
+					ID:        models.ObjectID(upload.Key),
+					UploadID:  upload.UploadID,
+					Initiated: upload.Initiated,
+				})
+			}
+		}
+
+		if !result.IsTruncated {
+			return uploads, nil
+		}
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+func (sos *S3ObjectStore) core() minio.Core {
+	return minio.Core{Client: sos.c}
+}
+
+// multipartError maps the multipart errors of S3 compatible servers to the domain ones
+func multipartError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchUpload":
+		return models.ErrUploadNotFound
+	case "InvalidPart", "InvalidPartOrder":
+		return models.ErrPartNotValid
+	case "EntityTooSmall":
+		return models.ErrPartTooSmall
+	}
+
+	return err
+}
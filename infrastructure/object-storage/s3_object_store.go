@@ -0,0 +1,392 @@
+package object_storage
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"storage-gateway/domain/models"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// DefaultBucket is the bucket of the nodes that don't configure one
+	DefaultBucket = "object-store"
+	// unknownSizePartSize is the multipart chunk size used when the object size is not known upfront.
+	// minio-go would otherwise size parts for a 5TiB object and buffer each of them in memory
+	unknownSizePartSize = 16 << 20
+)
+
+// Credential providers of S3 compatible nodes
+const (
+	CredentialsStatic = "static"
+	CredentialsEnv    = "env"
+	CredentialsFile   = "file"
+	CredentialsIAM    = "iam"
+	CredentialsChain  = "chain"
+)
+
+// S3NodeConfig describes how to reach the bucket of an S3 compatible object storage node,
+// such as AWS S3, Ceph RGW, SeaweedFS or MinIO
+type S3NodeConfig struct {
+	Endpoint string
+	// Bucket holds the objects of the node, DefaultBucket when empty
+	Bucket string
+	Region string
+	Secure bool
+	// CAFile is a PEM file of the certificate authorities trusted over TLS, the system ones being used when empty
+	CAFile string
+	// BucketLookup is "path", "dns" for virtual-host style requests, or detected from the endpoint when empty
+	BucketLookup string
+	Credentials  S3Credentials
+}
+
+// S3Credentials selects the credential provider of a node
+type S3Credentials struct {
+	// Provider is CredentialsStatic when empty, CredentialsChain trying the env, file and IAM providers in that order
+	Provider     string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// File and Profile locate the shared AWS credentials file, the AWS defaults being used when empty
+	File    string
+	Profile string
+}
+
+// S3ObjectStore represents an object storage node backed by a bucket of an S3 compatible server
+type S3ObjectStore struct {
+	id     string
+	bucket string
+	region string
+	c      *minio.Client
+}
+
+// NewMinioObjectStore creates a new S3ObjectStore for a MinIO server reached without TLS with static credentials, using the default bucket
+func NewMinioObjectStore(ctx context.Context, id, endpoint, accessKeyID, secretAccessKey string) (*S3ObjectStore, error) {
+	return NewS3ObjectStore(ctx, id, S3NodeConfig{
+		Endpoint: endpoint,
+		Credentials: S3Credentials{
+			AccessKey: accessKeyID,
+			SecretKey: secretAccessKey,
+		},
+	})
+}
+
+// NewS3ObjectStore creates a new S3ObjectStore instance with the provided node configuration.
+// It establishes a connection to the server, creates the storage
+// bucket if it doesn't exist, and returns the initialized S3ObjectStore
+func NewS3ObjectStore(ctx context.Context, id string, cfg S3NodeConfig) (*S3ObjectStore, error) {
+	creds, err := s3Credentials(cfg.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup, err := bucketLookup(cfg.BucketLookup)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := s3Transport(cfg.Secure, cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       cfg.Secure,
+		Transport:    transport,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Bucket == "" {
+		cfg.Bucket = DefaultBucket
+	}
+
+	sos := &S3ObjectStore{
+		id:     id,
+		bucket: cfg.Bucket,
+		region: cfg.Region,
+		c:      client,
+	}
+
+	if err = sos.createStorage(ctx); err != nil {
+		return nil, err
+	}
+
+	return sos, nil
+}
+
+// s3Credentials creates the credentials of the selected provider
+func s3Credentials(cfg S3Credentials) (*credentials.Credentials, error) {
+	switch cfg.Provider {
+	case "", CredentialsStatic:
+		if cfg.AccessKey == "" || cfg.SecretKey == "" {
+			return nil, errors.New("static credentials require an access key and a secret key")
+		}
+		return credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, cfg.SessionToken), nil
+	case CredentialsEnv:
+		return credentials.NewChainCredentials([]credentials.Provider{&credentials.EnvAWS{}, &credentials.EnvMinio{}}), nil
+	case CredentialsFile:
+		return credentials.NewFileAWSCredentials(cfg.File, cfg.Profile), nil
+	case CredentialsIAM:
+		return credentials.NewIAM(""), nil
+	case CredentialsChain:
+		return credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{Filename: cfg.File, Profile: cfg.Profile},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown credentials provider %q", cfg.Provider)
+	}
+}
+
+// bucketLookup maps a configured lookup style to its minio-go value
+func bucketLookup(style string) (minio.BucketLookupType, error) {
+	switch style {
+	case "", "auto":
+		return minio.BucketLookupAuto, nil
+	case "path":
+		return minio.BucketLookupPath, nil
+	case "dns", "virtual-host":
+		return minio.BucketLookupDNS, nil
+	default:
+		return 0, fmt.Errorf("unknown bucket lookup %q", style)
+	}
+}
+
+// s3Transport returns the default minio-go transport, trusting the certificate authorities of caFile when it is set
+func s3Transport(secure bool, caFile string) (http.RoundTripper, error) {
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, err
+	}
+
+	if caFile == "" {
+		return transport, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read ca file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", caFile)
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.RootCAs = pool
+
+	return transport, nil
+}
+
+// createStorage checks if the bucket of the node exists and creates it if not
+func (sos *S3ObjectStore) createStorage(ctx context.Context) error {
+	exists, err := sos.c.BucketExists(ctx, sos.bucket)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	return sos.c.MakeBucket(ctx, sos.bucket, minio.MakeBucketOptions{Region: sos.region})
+}
+
+// PutObject streams an object into the bucket with the provided object metadata, Metadata being stored as user metadata.
+// A negative size means the length is unknown and the content is uploaded in multipart chunks
+func (sos *S3ObjectStore) PutObject(ctx context.Context, o *models.Object) error {
+	opts := minio.PutObjectOptions{ContentType: o.ContentType, UserMetadata: o.Metadata}
+	if o.Size < 0 {
+		opts.PartSize = unknownSizePartSize
+	}
+
+	_, err := sos.c.PutObject(ctx, sos.bucket, o.ID.Value(), o.Content, o.Size, opts)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetObject retrieves an object from the bucket by its name and returns the associated object metadata.
+// When rng is not nil only that part of the object is fetched
+func (sos *S3ObjectStore) GetObject(ctx context.Context, name string, rng *models.ByteRange) (*models.Object, error) {
+	opts := minio.GetObjectOptions{}
+	if rng != nil {
+		if err := opts.SetRange(rng.Start, rng.End); err != nil {
+			return nil, err
+		}
+	}
+
+	// the core client is used because minio.Object drops the range on Stat and doesn't expose Content-Range
+	content, objStat, header, err := sos.core().GetObject(ctx, sos.bucket, name, opts)
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchKey":
+			return nil, models.ErrObjectNotFound
+		case "InvalidRange":
+			return nil, models.ErrRangeNotSatisfiable
+		}
+		return nil, err
+	}
+
+	obj := &models.Object{
+		ID:           models.ObjectID(name),
+		Content:      content,
+		ContentType:  objStat.ContentType,
+		Size:         objStat.Size,
+		ETag:         objStat.ETag,
+		LastModified: objStat.LastModified,
+		Metadata:     userMetadata(objStat.UserMetadata),
+	}
+
+	if rng != nil {
+		obj.Range = rng
+		if obj.Size, err = contentRangeSize(header.Get("Content-Range")); err != nil {
+			content.Close()
+			return nil, err
+		}
+	}
+
+	return obj, nil
+}
+
+// contentRangeSize extracts the full object size from a "bytes start-end/size" Content-Range header
+func contentRangeSize(contentRange string) (int64, error) {
+	_, size, found := strings.Cut(contentRange, "/")
+	if !found {
+		return 0, fmt.Errorf("unexpected content range %q", contentRange)
+	}
+
+	return strconv.ParseInt(size, 10, 64)
+}
+
+// StatObject retrieves the metadata of an object from the bucket without opening a reader on its content
+func (sos *S3ObjectStore) StatObject(ctx context.Context, name string) (*models.Object, error) {
+	objStat, err := sos.c.StatObject(ctx, sos.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, models.ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return &models.Object{
+		ID:           models.ObjectID(name),
+		ContentType:  objStat.ContentType,
+		Size:         objStat.Size,
+		ETag:         objStat.ETag,
+		LastModified: objStat.LastModified,
+		Metadata:     userMetadata(objStat.UserMetadata),
+	}, nil
+}
+
+// userMetadata returns the user metadata of an object, nil when it has none
+func userMetadata(metadata minio.StringMap) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	return metadata
+}
+
+// DeleteObject removes an object from the bucket by its name.
+// S3 treats removals of missing keys as successful, so the object is stat'ed first to report models.ErrObjectNotFound
+func (sos *S3ObjectStore) DeleteObject(ctx context.Context, name string) error {
+	if _, err := sos.StatObject(ctx, name); err != nil {
+		return err
+	}
+
+	return sos.c.RemoveObject(ctx, sos.bucket, name, minio.RemoveObjectOptions{})
+}
+
+// ReplaceMetadata copies an object onto itself with the content type and metadata of o, the content being copied server side.
+// The copy is conditional on the ETag of the object still being o.ETag
+func (sos *S3ObjectStore) ReplaceMetadata(ctx context.Context, o *models.Object) error {
+	metadata := maps.Clone(o.Metadata)
+	if metadata == nil {
+		metadata = make(map[string]string, 1)
+	}
+	if o.ContentType != "" {
+		metadata["Content-Type"] = o.ContentType
+	}
+
+	_, err := sos.c.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: sos.bucket, Object: o.ID.Value(), UserMetadata: metadata, ReplaceMetadata: true},
+		minio.CopySrcOptions{Bucket: sos.bucket, Object: o.ID.Value(), MatchETag: o.ETag},
+	)
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchKey":
+			return models.ErrObjectNotFound
+		case "PreconditionFailed":
+			return models.ErrObjectModified
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ListObjects lists up to limit objects of the bucket matching prefix and sorted after startAfter
+func (sos *S3ObjectStore) ListObjects(ctx context.Context, prefix, startAfter string, limit int) ([]*models.Object, error) {
+	// the listing goroutine of minio-go is stopped as soon as enough objects have been read
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objects := make([]*models.Object, 0, limit)
+	for info := range sos.c.ListObjects(ctx, sos.bucket, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: startAfter,
+		Recursive:  true,
+		MaxKeys:    limit,
+	}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+
+		objects = append(objects, &models.Object{
+			ID:           models.ObjectID(info.Key),
+			ContentType:  info.ContentType,
+			Size:         info.Size,
+			ETag:         info.ETag,
+			LastModified: info.LastModified,
+		})
+
+		if len(objects) == limit {
+			break
+		}
+	}
+
+	return objects, nil
+}
+
+// ID returns the unique identifier associated with the S3ObjectStore
+func (sos *S3ObjectStore) ID() string {
+	return sos.id
+}
+
+// IsOnline checks if the S3ObjectStore is online and available
+func (sos *S3ObjectStore) IsOnline() bool {
+	return sos.c.IsOnline()
+}
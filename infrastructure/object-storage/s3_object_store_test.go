@@ -0,0 +1,29 @@
+package object_storage_test
+
+import (
+	"context"
+	"testing"
+
+	"storage-gateway/domain/ports"
+	"storage-gateway/domain/ports/storagetest"
+	"storage-gateway/infrastructure/object-storage"
+)
+
+func TestS3ObjectStoreConformance(t *testing.T) {
+	endpoint, accessKey, secretKey := storagetest.MinioServer(t)
+
+	// subtests share the store, each one writing under its own prefix
+	store, err := object_storage.NewS3ObjectStore(context.Background(), endpoint, object_storage.S3NodeConfig{
+		Endpoint:     endpoint,
+		Region:       "us-east-1",
+		BucketLookup: "path",
+		Credentials:  object_storage.S3Credentials{AccessKey: accessKey, SecretKey: secretKey},
+	})
+	if err != nil {
+		t.Fatalf("create s3 store: %v", err)
+	}
+
+	storagetest.RunConformance(t, func(t *testing.T) ports.ObjectStorage {
+		return store
+	})
+}
@@ -8,8 +8,11 @@ import (
 
 type CorrelationIDKey string
 
+type AcceptEncodingKey string
+
 const (
-	correlationIDKey CorrelationIDKey = "CorrelationID"
+	correlationIDKey  CorrelationIDKey  = "CorrelationID"
+	acceptEncodingKey AcceptEncodingKey = "AcceptEncoding"
 )
 
 func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
@@ -24,3 +27,13 @@ func GetCorrelationID(ctx context.Context) string {
 
 	return val.(string)
 }
+
+func WithAcceptEncoding(ctx context.Context, acceptEncoding string) context.Context {
+	return context.WithValue(ctx, acceptEncodingKey, acceptEncoding)
+}
+
+// GetAcceptEncoding returns the Accept-Encoding of the request, empty when the content must not be encoded
+func GetAcceptEncoding(ctx context.Context) string {
+	val, _ := ctx.Value(acceptEncodingKey).(string)
+	return val
+}
@@ -9,16 +9,6 @@ import (
 
 var host, _ = os.Hostname()
 
-const (
-	logType = "json"
-)
-
-type trackingLog struct {
-	Hostname string `json:"hostName"`
-	TrackID  string `json:"trackID"`
-	Message  string `json:"message"`
-}
-
 func Debug(message string) {
 	Debugt("", message)
 }
@@ -28,7 +18,7 @@ func Debugf(format string, args ...interface{}) {
 }
 
 func Debugt(trackID, message string) {
-	log.Debugf(logType, trackMessage(trackID, message))
+	log.Debugj(trackMessage(trackID, message))
 }
 
 func Info(message string) {
@@ -40,7 +30,7 @@ func Infof(format string, args ...interface{}) {
 }
 
 func Infot(trackID, message string) {
-	log.Infof(logType, trackMessage(trackID, message))
+	log.Infoj(trackMessage(trackID, message))
 }
 
 func Warn(message string) {
@@ -52,7 +42,7 @@ func Warnf(format string, args ...interface{}) {
 }
 
 func Warnt(trackID, message string) {
-	log.Warnf(logType, trackMessage(trackID, message))
+	log.Warnj(trackMessage(trackID, message))
 }
 
 func Error(message string) {
@@ -64,7 +54,7 @@ func Errorf(format string, args ...interface{}) {
 }
 
 func Errort(trackID, message string) {
-	log.Errorf(logType, trackMessage(trackID, message))
+	log.Errorj(trackMessage(trackID, message))
 }
 
 func Fatal(message string) {
@@ -76,7 +66,7 @@ func Fatalf(format string, args ...interface{}) {
 }
 
 func Fatalt(trackID, message string) {
-	log.Fatalf(logType, trackMessage(trackID, message))
+	log.Fatalj(trackMessage(trackID, message))
 }
 
 func SetupLogging(logLevel string) {
@@ -109,10 +99,11 @@ func Lvl(l string) log.Lvl {
 	}[l]
 }
 
-func trackMessage(trackID, message string) trackingLog {
-	return trackingLog{
-		Hostname: host,
-		TrackID:  trackID,
-		Message:  message,
+// trackMessage is the tracking log, marshaled as JSON by gommon
+func trackMessage(trackID, message string) log.JSON {
+	return log.JSON{
+		"hostName": host,
+		"trackID":  trackID,
+		"message":  message,
 	}
 }